@@ -1,76 +1,157 @@
-//go:build docker
-// +build docker
-
-package main
-
-import (
-	"fmt"
-	"os"
-	"strconv"
-)
-
-var flags struct {
-	// The address to listen on.
-	address string
-	// The port to listen on.
-	port int
-	// The directory to store the cache in.
-	cacheDir string
-	// The timeout for requests.
-	timeout int
-	//The logfile to write to.
-	logfile string
-	// Log level.
-	loglevel string
-	// Use an in-memory cache.
-	memcache bool
-	// Use the built-in cli
-	cli bool
-
-	// The init file to use.
-	initFile string
-	// period to save cache in milliseconds
-	savePeriod int
-	// save on interrupt
-	saveOnInterrupt bool
-}
-
-func setup() {
-	var (
-		err1, err2, err3 error
-	)
-	flags.address = "0.0.0.0"
-	flags.port, err1 = strconv.Atoi(getEnv("PORT", "2392"))
-	flags.cacheDir = getEnv("CACHE_DIR", "/netcache/cache")
-	flags.timeout, err2 = strconv.Atoi(getEnv("TIMEOUT", "60"))
-	flags.logfile = getEnv("LOGFILE")
-	flags.loglevel = getEnv("LOGLEVEL", "INFO")
-	flags.memcache, err3 = strconv.ParseBool(getEnv("MEMCACHE", "false"))
-	flags.cli = false
-	flags.initFile = getEnv("INIT_FILE", "/netcache/init.netcache")
-	flags.savePeriod, _ = strconv.Atoi(getEnv("SAVE_PERIOD", "500"))
-	flags.saveOnInterrupt, _ = strconv.ParseBool(getEnv("SAVE_ON_INTERRUPT", "false"))
-
-	if err1 != nil || err2 != nil || err3 != nil {
-		panic("Invalid environment variables")
-	}
-
-	if flags.savePeriod == 0 {
-		fmt.Println("Save period is set to 0, cache will not be saved periodically.")
-	}
-
-	if flags.savePeriod < 0 {
-		flags.savePeriod = 500
-	}
-
-}
-
-func getEnv(key string, def ...string) string {
-	if val, ok := os.LookupEnv(key); ok {
-		return val
-	}
-	if len(def) > 0 {
-		return def[0]
-	}
-	return ""
-}
+//go:build docker
+// +build docker
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Nigel2392/netcache/src/cache"
+)
+
+var flags struct {
+	// The address to listen on.
+	address string
+	// The port to listen on.
+	port int
+	// The directory to store the cache in.
+	cacheDir string
+	// The timeout for requests.
+	timeout int
+	//The logfile to write to.
+	logfile string
+	// Log level.
+	loglevel string
+	// Use an in-memory cache.
+	memcache bool
+	// Maximum amount of items in the in-memory cache, of every namespace.
+	maxItems int
+	// Maximum amount of bytes in the in-memory cache, of every namespace.
+	maxBytes int64
+	// Maximum amount of namespaces besides the default namespace.
+	maxNamespaces int
+	// The eviction policy of the in-memory cache.
+	eviction string
+	// Amount of shards to split the in-memory cache into.
+	shards int
+	// When the file cache and the append-only log flush writes to disk.
+	fsync string
+	// Record every change in an append-only log, which is replayed on startup.
+	aof bool
+	// The size in bytes at which the append-only log is rewritten.
+	aofRewriteSize int64
+	// Rebuild the index of the file cache from the cache directory on startup.
+	rebuild bool
+	// Use a log-structured cache, which appends items to segment files.
+	segments bool
+	// The size in bytes at which a new segment is started.
+	segmentSize int64
+	// Keep the hot items of the file cache in a bounded in-memory cache.
+	tiered bool
+	// How the tiered cache writes items to the file cache.
+	writeMode string
+	// Compress values larger than the compression threshold.
+	compress bool
+	// The size in bytes above which values are compressed.
+	compressThreshold int
+	// The file holding the encryption keys, one per line with the current key first.
+	keyFile string
+	// The encryption keys, separated by commas with the current key first.
+	keys string
+	// Use the built-in cli
+	cli bool
+
+	// The init file to use.
+	initFile string
+	// period to save cache in milliseconds
+	savePeriod int
+	// save on interrupt
+	saveOnInterrupt bool
+}
+
+func setup() {
+	var env envParser
+	flags.address = "0.0.0.0"
+	flags.port = env.int("PORT", 2392)
+	flags.cacheDir = getEnv("CACHE_DIR", "/netcache/cache")
+	flags.timeout = env.int("TIMEOUT", 60)
+	flags.logfile = getEnv("LOGFILE")
+	flags.loglevel = getEnv("LOGLEVEL", "INFO")
+	flags.memcache = env.bool("MEMCACHE", false)
+	flags.maxItems = env.int("MAX_ITEMS", 0)
+	flags.maxBytes = env.int64("MAX_BYTES", 0)
+	flags.maxNamespaces = env.int("MAX_NAMESPACES", 16)
+	flags.eviction = getEnv("EVICTION", "LRU")
+	flags.shards = env.int("SHARDS", 0)
+	flags.fsync = getEnv("FSYNC", "periodic")
+	flags.aof = env.bool("AOF", false)
+	flags.aofRewriteSize = env.int64("AOF_REWRITE_SIZE", cache.DefaultRewriteSize)
+	flags.rebuild = env.bool("REBUILD", false)
+	flags.segments = env.bool("SEGMENTS", false)
+	flags.segmentSize = env.int64("SEGMENT_SIZE", cache.DefaultSegmentSize)
+	flags.tiered = env.bool("TIERED", false)
+	flags.writeMode = getEnv("WRITE_MODE", "through")
+	flags.compress = env.bool("COMPRESS", false)
+	flags.compressThreshold = env.int("COMPRESS_THRESHOLD", cache.DefaultCompressionThreshold)
+	flags.keyFile = getEnv("KEY_FILE")
+	flags.keys = getEnv("ENCRYPTION_KEYS")
+	flags.cli = false
+	flags.initFile = getEnv("INIT_FILE", "/netcache/init.netcache")
+	flags.savePeriod, _ = strconv.Atoi(getEnv("SAVE_PERIOD", "500"))
+	flags.saveOnInterrupt, _ = strconv.ParseBool(getEnv("SAVE_ON_INTERRUPT", "false"))
+
+	if len(env.errs) > 0 {
+		panic(fmt.Sprintf("Invalid environment variables: %s", errors.Join(env.errs...)))
+	}
+
+	if flags.savePeriod == 0 {
+		fmt.Println("Save period is set to 0, cache will not be saved periodically.")
+	}
+
+	if flags.savePeriod < 0 {
+		flags.savePeriod = 500
+	}
+
+}
+
+func getEnv(key string, def ...string) string {
+	if val, ok := os.LookupEnv(key); ok {
+		return val
+	}
+	if len(def) > 0 {
+		return def[0]
+	}
+	return ""
+}
+
+// Parses environment variables, collecting the errors of the variables which could not be parsed.
+type envParser struct {
+	errs []error
+}
+
+func (p *envParser) int(key string, def int) int {
+	var v, err = strconv.Atoi(getEnv(key, strconv.Itoa(def)))
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("%s: %w", key, err))
+	}
+	return v
+}
+
+func (p *envParser) int64(key string, def int64) int64 {
+	var v, err = strconv.ParseInt(getEnv(key, strconv.FormatInt(def, 10)), 10, 64)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("%s: %w", key, err))
+	}
+	return v
+}
+
+func (p *envParser) bool(key string, def bool) bool {
+	var v, err = strconv.ParseBool(getEnv(key, strconv.FormatBool(def)))
+	if err != nil {
+		p.errs = append(p.errs, fmt.Errorf("%s: %w", key, err))
+	}
+	return v
+}
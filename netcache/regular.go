@@ -1,50 +1,107 @@
-//go:build !docker
-// +build !docker
-
-package main
-
-import "flag"
-
-var flags struct {
-	// The address to listen on.
-	address string
-	// The port to listen on.
-	port int
-	// The directory to store the cache in.
-	cacheDir string
-	// The timeout for requests.
-	timeout int
-	//The logfile to write to.
-	logfile string
-	// Log level.
-	loglevel string
-	// Use an in-memory cache.
-	memcache bool
-	// Use the built-in cli
-	cli bool
-
-	// The init file to use.
-	initFile string
-	// period to save cache in milliseconds
-	savePeriod int
-	// save on interrupt
-	saveOnInterrupt bool
-}
-
-func setup() {
-	flag.StringVar(&flags.address, "address", "127.0.0.1", "The address to listen on.")
-	flag.IntVar(&flags.port, "port", 2392, "The port to listen on.")
-	flag.StringVar(&flags.cacheDir, "cache-dir", "./cache", "The directory to store the cache in.")
-	flag.IntVar(&flags.timeout, "timeout", 5, "The timeout for requests in seconds.")
-	flag.StringVar(&flags.logfile, "logfile", "", "The logfile to write to (none for stdout).")
-	flag.StringVar(&flags.loglevel, "loglevel", "INFO", "The log level to use. (\"CRITICAL\", \"ERROR\", \"WARNING\", \"INFO\", \"DEBUG\", \"TEST\")")
-	flag.BoolVar(&flags.memcache, "memory", false, "Use an in-memory cache.")
-	flag.BoolVar(&flags.cli, "cli", false, "Use the built-in cli.")
-	flag.StringVar(&flags.initFile, "dump.netcache", "", "The init file to use.")
-	flag.BoolVar(&flags.saveOnInterrupt, "soi", false, "Save cache on interrupt.")
-	flag.IntVar(&flags.savePeriod, "saveperiod", 500, "Period to save cache in milliseconds.")
-	flag.Parse()
-	if flags.savePeriod < 0 {
-		flags.savePeriod = 500
-	}
-}
+//go:build !docker
+// +build !docker
+
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/Nigel2392/netcache/src/cache"
+)
+
+var flags struct {
+	// The address to listen on.
+	address string
+	// The port to listen on.
+	port int
+	// The directory to store the cache in.
+	cacheDir string
+	// The timeout for requests.
+	timeout int
+	//The logfile to write to.
+	logfile string
+	// Log level.
+	loglevel string
+	// Use an in-memory cache.
+	memcache bool
+	// Maximum amount of items in the in-memory cache, of every namespace.
+	maxItems int
+	// Maximum amount of bytes in the in-memory cache, of every namespace.
+	maxBytes int64
+	// Maximum amount of namespaces besides the default namespace.
+	maxNamespaces int
+	// The eviction policy of the in-memory cache.
+	eviction string
+	// Amount of shards to split the in-memory cache into.
+	shards int
+	// When the file cache and the append-only log flush writes to disk.
+	fsync string
+	// Record every change in an append-only log, which is replayed on startup.
+	aof bool
+	// The size in bytes at which the append-only log is rewritten.
+	aofRewriteSize int64
+	// Rebuild the index of the file cache from the cache directory on startup.
+	rebuild bool
+	// Use a log-structured cache, which appends items to segment files.
+	segments bool
+	// The size in bytes at which a new segment is started.
+	segmentSize int64
+	// Keep the hot items of the file cache in a bounded in-memory cache.
+	tiered bool
+	// How the tiered cache writes items to the file cache.
+	writeMode string
+	// Compress values larger than the compression threshold.
+	compress bool
+	// The size in bytes above which values are compressed.
+	compressThreshold int
+	// The file holding the encryption keys, one per line with the current key first.
+	keyFile string
+	// The encryption keys, separated by commas with the current key first.
+	keys string
+	// Use the built-in cli
+	cli bool
+
+	// The init file to use.
+	initFile string
+	// period to save cache in milliseconds
+	savePeriod int
+	// save on interrupt
+	saveOnInterrupt bool
+}
+
+func setup() {
+	flag.StringVar(&flags.address, "address", "127.0.0.1", "The address to listen on.")
+	flag.IntVar(&flags.port, "port", 2392, "The port to listen on.")
+	flag.StringVar(&flags.cacheDir, "cache-dir", "./cache", "The directory to store the cache in.")
+	flag.IntVar(&flags.timeout, "timeout", 5, "The timeout for requests in seconds.")
+	flag.StringVar(&flags.logfile, "logfile", "", "The logfile to write to (none for stdout).")
+	flag.StringVar(&flags.loglevel, "loglevel", "INFO", "The log level to use. (\"CRITICAL\", \"ERROR\", \"WARNING\", \"INFO\", \"DEBUG\", \"TEST\")")
+	flag.BoolVar(&flags.memcache, "memory", false, "Use an in-memory cache.")
+	flag.IntVar(&flags.maxItems, "max-items", 0, "Maximum amount of items in the in-memory cache of every namespace (0 for unbounded).")
+	flag.Int64Var(&flags.maxBytes, "max-bytes", 0, "Maximum amount of bytes in the in-memory cache of every namespace (0 for unbounded).")
+	flag.IntVar(&flags.maxNamespaces, "max-namespaces", 16, "Maximum amount of namespaces besides the default namespace, every namespace has its own cache (0 for unlimited).")
+	flag.IntVar(&flags.shards, "shards", 0, "Amount of shards to split the in-memory cache into (0 for no sharding).")
+	flag.StringVar(&flags.eviction, "eviction", "LRU", "The eviction policy of the in-memory cache. (\"LRU\", \"LFU\", \"FIFO\")")
+	flag.StringVar(&flags.fsync, "fsync", "periodic", "When the file cache and the append-only log flush writes to disk. (\"always\", \"periodic\", \"never\") The file cache flushes every value file before renaming it into place unless this is \"never\", the policy decides when the renames are flushed.")
+	flag.BoolVar(&flags.aof, "aof", false, "Record every change in an append-only log, which is replayed on startup. The init file is only loaded while the log is empty.")
+	flag.Int64Var(&flags.aofRewriteSize, "aof-rewrite-size", cache.DefaultRewriteSize, "The size in bytes at which the append-only log is rewritten (-1 to never rewrite).")
+	flag.BoolVar(&flags.rebuild, "rebuild", false, "Rebuild the index of the file cache from the cache directory on startup, so no init file is needed.")
+	flag.BoolVar(&flags.segments, "segments", false, "Use a log-structured cache, which appends items to segment files instead of writing a file per item.")
+	flag.Int64Var(&flags.segmentSize, "segment-size", cache.DefaultSegmentSize, "The size in bytes at which a new segment is started.")
+	flag.BoolVar(&flags.tiered, "tiered", false, "Keep the hot items of the file cache in memory, bounded by -max-items and -max-bytes.")
+	flag.StringVar(&flags.writeMode, "write-mode", "through", "How the tiered cache writes items to disk. (\"through\", \"back\")")
+	flag.BoolVar(&flags.compress, "compress", false, "Compress values larger than -compress-threshold before storing them. Once a disk cache stores compressed values, the server refuses to start on its directory without this flag.")
+	flag.IntVar(&flags.compressThreshold, "compress-threshold", cache.DefaultCompressionThreshold, "The size in bytes above which values are compressed.")
+	flag.StringVar(&flags.keyFile, "key-file", "", "The file holding the hex or base64 encoded keys to encrypt the file cache and the init file with, one per line with the current key first.")
+	flag.BoolVar(&flags.cli, "cli", false, "Use the built-in cli.")
+	flag.StringVar(&flags.initFile, "dump.netcache", "", "The init file to use.")
+	flag.BoolVar(&flags.saveOnInterrupt, "soi", false, "Save cache on interrupt.")
+	flag.IntVar(&flags.savePeriod, "saveperiod", 500, "Period to save cache in milliseconds, not used with -aof.")
+	flag.Parse()
+	// Keys are not passed as flags, so they do not show up in the process list.
+	flags.keys = os.Getenv("NETCACHE_ENCRYPTION_KEYS")
+	if flags.savePeriod < 0 {
+		flags.savePeriod = 500
+	}
+}
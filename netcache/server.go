@@ -1,214 +1,576 @@
-package main
-
-import (
-	"fmt"
-	"io"
-	"os"
-	"strings"
-	"time"
-
-	"github.com/Nigel2392/netcache/src/cache"
-	"github.com/Nigel2392/netcache/src/client"
-	"github.com/Nigel2392/netcache/src/logger"
-	"github.com/Nigel2392/netcache/src/server"
-)
-
-const VERSION = "1.2.1"
-
-func main() {
-	setup()
-
-	if flags.cli {
-		startCLI()
-		return
-	}
-
-	if flags.cacheDir == "" {
-		flags.cacheDir = "./netcache-data"
-	}
-
-	var c cache.Cache
-	if flags.memcache {
-		c = cache.NewMemoryCache()
-	} else {
-		c = cache.NewFileCache(flags.cacheDir)
-	}
-
-	var shouldLoad bool
-	if flags.initFile == "" {
-		flags.initFile = fmt.Sprintf("%s/init.netcache", flags.cacheDir)
-	} else {
-		shouldLoad = true
-	}
-
-	var savePeriod time.Duration
-	if flags.savePeriod > 0 {
-		savePeriod = time.Duration(flags.savePeriod) * time.Millisecond
-	}
-
-	var server = server.New(flags.address, flags.port, time.Duration(flags.timeout)*time.Second, c)
-	var std io.Writer
-	var err error
-	if flags.logfile != "" {
-		std, err = logger.NewLogFile(flags.logfile)
-	} else {
-		std = os.Stdout
-	}
-	var logger = logger.Newlogger(logger.LoglevelFromString(flags.loglevel), std)
-	server.NewLogger(
-		logger,
-	)
-
-	dumpFlags(logger)
-
-	if shouldLoad {
-		err = server.Load(flags.initFile)
-		if err != nil {
-			logger.Error(err)
-		}
-	}
-
-	if flags.saveOnInterrupt {
-		server.SaveOnInterrupt(flags.initFile)
-	}
-
-	if savePeriod > 0 {
-		server.SavePeriodically(flags.initFile, savePeriod)
-	}
-
-	err = server.ListenAndServe()
-	if err != nil {
-		panic(err)
-	}
-}
-
-func dumpFlags(logger logger.Logger) {
-	logger.Info("Flags:")
-	logger.Infof("  Address: %s\n", flags.address)
-	logger.Infof("  Port: %d\n", flags.port)
-	logger.Infof("  CacheDir: %s\n", flags.cacheDir)
-	logger.Infof("  Timeout: %d\n", flags.timeout)
-	logger.Infof("  LogLevel: %s\n", flags.loglevel)
-	logger.Infof("  LogFile: %s\n", flags.logfile)
-	logger.Infof("  Memcache: %t\n", flags.memcache)
-	logger.Infof("  InitFile: %s\n", flags.initFile)
-	logger.Infof("  SavePeriod: %d\n", flags.savePeriod)
-	logger.Infof("  SaveOnInterrupt: %t\n", flags.saveOnInterrupt)
-	logger.Infof("  Version: %s\n", VERSION)
-}
-
-func startCLI() {
-	var client = client.New(fmt.Sprintf("%s:%d", flags.address, flags.port), nil, time.Duration(flags.timeout)*time.Second, 10)
-	var err = client.Connect()
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	var cmd string
-	printHelp()
-	fmt.Println()
-	for {
-		fmt.Printf("%snetcache> %s", logger.Purple, logger.Reset)
-		_, err = fmt.Scanln(&cmd)
-		if err != nil {
-			fmt.Println(err)
-			continue
-		}
-		switch strings.ToLower(cmd) {
-		case "quit", "exit", "q", "leave":
-			fmt.Printf("%s%s%s\n", logger.Green, "GOODBYE...", logger.Reset)
-			return
-		case "get":
-			var key string
-			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
-			_, err := fmt.Scanln(&key)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			fmt.Printf("%s%s%s\n", logger.Green, "GETTING", logger.Reset)
-			value, err := client.Get(key, nil)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			fmt.Printf("%s%s%s\n", logger.Green, value.Value(), logger.Reset)
-		case "set":
-			var (
-				key   string
-				value string
-			)
-			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
-			_, err := fmt.Scanln(&key)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			fmt.Printf("%svalue> %s", logger.Blue, logger.Reset)
-			_, err = fmt.Scanln(&value)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-
-			fmt.Printf("%sttl> %s", logger.Blue, logger.Reset)
-			var ttl int
-			_, err = fmt.Scanln(&ttl)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			err = client.Set(key, value, time.Duration(ttl)*time.Second)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			fmt.Printf("%s%s%s\n", logger.Green, "OK", logger.Reset)
-		case "delete":
-			var key string
-			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
-			_, err := fmt.Scanln(&key)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			err = client.Delete(key)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			fmt.Printf("%s%s%s\n", logger.Green, "OK", logger.Reset)
-		case "clear":
-			err := client.Clear()
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			fmt.Printf("%s%s%s\n", logger.Green, "OK", logger.Reset)
-		case "keys":
-			keys, err := client.Keys()
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-			for _, key := range keys {
-				fmt.Printf("%s%s%s\n", logger.Green, key, logger.Reset)
-			}
-		case "help":
-			printHelp()
-		default:
-			fmt.Printf("%sUnknown command. Type \"help\" for a list of commands.%s\n", logger.Red, logger.Reset)
-		}
-	}
-}
-
-func printHelp() {
-	fmt.Println(logger.Purple + "netcache - Available Commands" + logger.Reset)
-	fmt.Printf("\t%sget%s    args: [KEY]\n", logger.Green, logger.Reset)
-	fmt.Printf("\t%sset%s    args: [KEY, VALUE, TTL]\n", logger.Green, logger.Reset)
-	fmt.Printf("\t%sdelete%s args: [KEY]\n", logger.Green, logger.Reset)
-	fmt.Printf("\t%sclear%s\n", logger.Green, logger.Reset)
-	fmt.Printf("\t%skeys%s\n", logger.Green, logger.Reset)
-	fmt.Printf("\t%shelp%s\n", logger.Green, logger.Reset)
-	fmt.Printf("\t%squit%s\n", logger.Green, logger.Reset)
-}
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/client"
+	"github.com/Nigel2392/netcache/src/logger"
+	"github.com/Nigel2392/netcache/src/server"
+)
+
+const VERSION = "1.2.1"
+
+func main() {
+	setup()
+
+	if flags.cli {
+		startCLI()
+		return
+	}
+
+	if flags.cacheDir == "" {
+		flags.cacheDir = "./netcache-data"
+	}
+
+	var policy, err = cache.EvictionPolicyFromString(flags.eviction)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	syncPolicy, err := cache.SyncPolicyFromString(flags.fsync)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	writeMode, err := cache.WriteModeFromString(flags.writeMode)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// The file cache and the init file are encrypted if keys are given, by a key file or the environment.
+	var keyring *cache.Keyring
+	switch {
+	case flags.keyFile != "":
+		keyring, err = cache.ReadKeyFile(flags.keyFile)
+	case flags.keys != "":
+		keyring, err = cache.KeyringFromString(flags.keys)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if keyring != nil && (flags.segments || flags.aof) {
+		fmt.Println("encryption is not supported by the segment cache and the append-only log")
+		os.Exit(1)
+	}
+
+	// Disk backends store compressed items with a flag in their type, which only a compressed cache reads.
+	// The cache directory is marked once compression is used, so the server does not start on it without compression.
+	var compressedMarker = filepath.Join(flags.cacheDir, "compressed.netcache")
+	if !flags.memcache {
+		if flags.compress {
+			if err = os.MkdirAll(flags.cacheDir, 0755); err == nil {
+				err = os.WriteFile(compressedMarker, nil, 0644)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		} else if _, err := os.Stat(compressedMarker); err == nil {
+			fmt.Printf("the cache directory %s holds compressed items, start the server with compression enabled\n", flags.cacheDir)
+			os.Exit(1)
+		}
+	}
+
+	// Disk backends store every item, the segment cache or the file cache.
+	var newDiskBackend = func(dir string) cache.Cache {
+		if flags.segments {
+			var c, err = cache.NewSegmentCache(dir, syncPolicy, flags.segmentSize)
+			if err != nil {
+				fmt.Println(err)
+				if !cache.IsIntegrityError(err) {
+					os.Exit(1)
+				}
+			}
+			return c
+		}
+		var c = cache.NewSyncedFileCache(dir, syncPolicy, cache.DefaultSyncInterval)
+		if keyring != nil {
+			c.(*cache.FileCache).UseKeyring(keyring)
+		}
+		if flags.rebuild {
+			if err := c.(*cache.FileCache).Rebuild(); err != nil {
+				fmt.Println(err)
+				if !cache.IsIntegrityError(err) {
+					os.Exit(1)
+				}
+			}
+		}
+		return c
+	}
+
+	// Every namespace gets its own cache, file caches store namespaces in subdirectories.
+	var newStore = func(namespace string) cache.Cache {
+		if flags.memcache {
+			if flags.shards > 0 {
+				return cache.NewShardedMemoryCache(flags.shards, flags.maxItems, flags.maxBytes, policy)
+			}
+			return cache.NewBoundedMemoryCache(flags.maxItems, flags.maxBytes, policy)
+		}
+		var dir = cache.NamespaceDir(flags.cacheDir, namespace)
+		if flags.tiered {
+			var l1 = cache.NewGenericBoundedMemoryCache[[]byte](flags.maxItems, flags.maxBytes, policy)
+			return cache.NewTieredCache(l1, newDiskBackend(dir), writeMode)
+		}
+		return newDiskBackend(dir)
+	}
+
+	// Values larger than the threshold are compressed before they are stored by the backend.
+	var newBackend = func(namespace string) cache.Cache {
+		var c = newStore(namespace)
+		if !flags.compress {
+			return c
+		}
+		var compressed, err = cache.NewCompressedCache(c, flags.compressThreshold)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return compressed
+	}
+
+	// The append-only log of a namespace is stored next to its files, and replayed before the server starts serving.
+	var logPath = func(namespace string) string {
+		return filepath.Join(cache.NamespaceDir(flags.cacheDir, namespace), "appendonly.netcache")
+	}
+	var newCache = func(namespace string) cache.Cache {
+		var c = newBackend(namespace)
+		if !flags.aof {
+			return c
+		}
+		var logged, err = cache.NewLoggedCache(c, logPath(namespace), syncPolicy, flags.aofRewriteSize)
+		if err != nil {
+			fmt.Println(err)
+			if !cache.IsIntegrityError(err) {
+				os.Exit(1)
+			}
+		}
+		return logged
+	}
+	// Reports whether any namespace has an append-only log with records in it.
+	var hasLogs = func() bool {
+		var paths, _ = filepath.Glob(logPath("*"))
+		for _, path := range append(paths, logPath(cache.DefaultNamespace)) {
+			if info, err := os.Stat(path); err == nil && info.Size() > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	// Checked before the log of the default namespace is opened.
+	var logged = flags.aof && hasLogs()
+	var c = newCache(cache.DefaultNamespace)
+
+	var shouldLoad bool
+	if flags.initFile == "" {
+		flags.initFile = fmt.Sprintf("%s/init.netcache", flags.cacheDir)
+	} else {
+		shouldLoad = true
+	}
+
+	var savePeriod time.Duration
+	if flags.savePeriod > 0 {
+		savePeriod = time.Duration(flags.savePeriod) * time.Millisecond
+	}
+
+	var server = server.New(flags.address, flags.port, time.Duration(flags.timeout)*time.Second, c)
+	server.UseNamespaces(newCache)
+	server.LimitNamespaces(flags.maxNamespaces)
+	server.UseKeyring(keyring)
+	var std io.Writer
+	if flags.logfile != "" {
+		std, err = logger.NewLogFile(flags.logfile)
+	} else {
+		std = os.Stdout
+	}
+	var logger = logger.Newlogger(logger.LoglevelFromString(flags.loglevel), std)
+	server.NewLogger(
+		logger,
+	)
+
+	dumpFlags(logger)
+
+	// The append-only log holds every change, so the init file is only loaded to fill an empty log,
+	// and the cache is not dumped periodically.
+	if shouldLoad && logged {
+		logger.Info("Not loading the init file, the append-only log is not empty.")
+		shouldLoad = false
+	}
+	if savePeriod > 0 && flags.aof {
+		logger.Info("Not saving the cache periodically, changes are recorded in the append-only log.")
+		savePeriod = 0
+	}
+
+	// The logs of the other namespaces are replayed before serving, like the log of the default namespace.
+	if flags.aof {
+		var paths, _ = filepath.Glob(logPath("*"))
+		for _, path := range paths {
+			var namespace = filepath.Base(filepath.Dir(path))
+			if _, err := server.Namespace(namespace); err != nil {
+				logger.Errorf("Replaying the append-only log of namespace '%s': %s\n", namespace, err)
+			}
+		}
+	}
+
+	if shouldLoad {
+		err = server.Load(flags.initFile)
+		if err != nil {
+			logger.Error(err)
+		}
+	}
+
+	if flags.saveOnInterrupt {
+		server.SaveOnInterrupt(flags.initFile)
+	}
+
+	if savePeriod > 0 {
+		server.SavePeriodically(flags.initFile, savePeriod)
+	}
+
+	err = server.ListenAndServe()
+	if err != nil {
+		panic(err)
+	}
+}
+
+func dumpFlags(logger logger.Logger) {
+	logger.Info("Flags:")
+	logger.Infof("  Address: %s\n", flags.address)
+	logger.Infof("  Port: %d\n", flags.port)
+	logger.Infof("  CacheDir: %s\n", flags.cacheDir)
+	logger.Infof("  Timeout: %d\n", flags.timeout)
+	logger.Infof("  LogLevel: %s\n", flags.loglevel)
+	logger.Infof("  LogFile: %s\n", flags.logfile)
+	logger.Infof("  Memcache: %t\n", flags.memcache)
+	logger.Infof("  MaxItems: %d\n", flags.maxItems)
+	logger.Infof("  MaxBytes: %d\n", flags.maxBytes)
+	logger.Infof("  MaxNamespaces: %d\n", flags.maxNamespaces)
+	logger.Infof("  Eviction: %s\n", flags.eviction)
+	logger.Infof("  Shards: %d\n", flags.shards)
+	logger.Infof("  Fsync: %s\n", flags.fsync)
+	logger.Infof("  AOF: %t\n", flags.aof)
+	logger.Infof("  AOFRewriteSize: %d\n", flags.aofRewriteSize)
+	logger.Infof("  Rebuild: %t\n", flags.rebuild)
+	logger.Infof("  Segments: %t\n", flags.segments)
+	logger.Infof("  SegmentSize: %d\n", flags.segmentSize)
+	logger.Infof("  Tiered: %t\n", flags.tiered)
+	logger.Infof("  WriteMode: %s\n", flags.writeMode)
+	logger.Infof("  Compress: %t\n", flags.compress)
+	logger.Infof("  CompressThreshold: %d\n", flags.compressThreshold)
+	logger.Infof("  KeyFile: %s\n", flags.keyFile)
+	logger.Infof("  Encrypted: %t\n", flags.keyFile != "" || flags.keys != "")
+	logger.Infof("  InitFile: %s\n", flags.initFile)
+	logger.Infof("  SavePeriod: %d\n", flags.savePeriod)
+	logger.Infof("  SaveOnInterrupt: %t\n", flags.saveOnInterrupt)
+	logger.Infof("  Version: %s\n", VERSION)
+}
+
+// Connect the cli to the server, selecting the namespace.
+func connectCLI(namespace string) (*client.CacheClient, error) {
+	var c = client.New(fmt.Sprintf("%s:%d", flags.address, flags.port), nil, time.Duration(flags.timeout)*time.Second, 10)
+	if namespace != cache.DefaultNamespace {
+		c.Namespace = namespace
+	}
+	return c, c.Connect()
+}
+
+func startCLI() {
+	var namespace = cache.DefaultNamespace
+	var client, err = connectCLI(namespace)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	var cmd string
+	printHelp()
+	fmt.Println()
+	for {
+		if namespace != cache.DefaultNamespace {
+			fmt.Printf("%snetcache[%s]> %s", logger.Purple, namespace, logger.Reset)
+		} else {
+			fmt.Printf("%snetcache> %s", logger.Purple, logger.Reset)
+		}
+		_, err = fmt.Scanln(&cmd)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		switch strings.ToLower(cmd) {
+		case "quit", "exit", "q", "leave":
+			fmt.Printf("%s%s%s\n", logger.Green, "GOODBYE...", logger.Reset)
+			return
+		case "get":
+			var key string
+			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%s%s%s\n", logger.Green, "GETTING", logger.Reset)
+			value, err := client.Get(key, nil)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%s%s (version %d)%s\n", logger.Green, value.Value(), value.Version(), logger.Reset)
+		case "set":
+			var (
+				key   string
+				value string
+			)
+			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%svalue> %s", logger.Blue, logger.Reset)
+			_, err = fmt.Scanln(&value)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+
+			fmt.Printf("%sttl> %s", logger.Blue, logger.Reset)
+			var ttl int
+			_, err = fmt.Scanln(&ttl)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			err = client.Set(key, value, time.Duration(ttl)*time.Second)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%s%s%s\n", logger.Green, "OK", logger.Reset)
+		case "incr", "decr":
+			var (
+				key   string
+				delta int64
+				ttl   int
+			)
+			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%sdelta> %s", logger.Blue, logger.Reset)
+			_, err = fmt.Scanln(&delta)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%sttl> %s", logger.Blue, logger.Reset)
+			_, err = fmt.Scanln(&ttl)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			var value int64
+			if strings.ToLower(cmd) == "incr" {
+				value, err = client.Incr(key, delta, 0, time.Duration(ttl)*time.Second)
+			} else {
+				value, err = client.Decr(key, delta, 0, time.Duration(ttl)*time.Second)
+			}
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%s%d%s\n", logger.Green, value, logger.Reset)
+		case "ttl":
+			var key string
+			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			ttl, err := client.TTL(key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if ttl == cache.NoExpiry {
+				fmt.Printf("%s%s%s\n", logger.Green, "NO EXPIRY", logger.Reset)
+				continue
+			}
+			fmt.Printf("%s%s%s\n", logger.Green, ttl.Round(time.Second), logger.Reset)
+		case "touch":
+			var (
+				key string
+				ttl int
+			)
+			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%sttl> %s", logger.Blue, logger.Reset)
+			_, err = fmt.Scanln(&ttl)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			err = client.Touch(key, time.Duration(ttl)*time.Second)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%s%s%s\n", logger.Green, "OK", logger.Reset)
+		case "persist":
+			var key string
+			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			err = client.Persist(key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%s%s%s\n", logger.Green, "OK", logger.Reset)
+		case "invalidate":
+			var tag string
+			fmt.Printf("%stag> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&tag)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			deleted, err := client.InvalidateTag(tag)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%sDELETED %d%s\n", logger.Green, deleted, logger.Reset)
+		case "select":
+			var selected string
+			fmt.Printf("%snamespace> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&selected)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			selectedClient, err := connectCLI(selected)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			client.Close()
+			client = selectedClient
+			namespace = selected
+			fmt.Printf("%s%s%s\n", logger.Green, "OK", logger.Reset)
+		case "delete":
+			var key string
+			fmt.Printf("%skey> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			err = client.Delete(key)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%s%s%s\n", logger.Green, "OK", logger.Reset)
+		case "clear":
+			err := client.Clear()
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			fmt.Printf("%s%s%s\n", logger.Green, "OK", logger.Reset)
+		case "keys":
+			keys, err := client.Keys()
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			for _, key := range keys {
+				fmt.Printf("%s%s%s\n", logger.Green, key, logger.Reset)
+			}
+		case "scan":
+			var match string
+			fmt.Printf("%smatch> %s", logger.Blue, logger.Reset)
+			_, err := fmt.Scanln(&match)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			var it = client.Iterate(match, 100)
+			for it.Next() {
+				fmt.Printf("%s%s%s\n", logger.Green, it.Key(), logger.Reset)
+			}
+			if err = it.Err(); err != nil {
+				fmt.Println(err)
+				continue
+			}
+		case "stats":
+			stats, err := client.Stats()
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			var counters = []struct {
+				name  string
+				value int64
+			}{
+				{"clients", stats.Clients},
+				{"items", stats.Items},
+				{"bytes", stats.Bytes},
+				{"hits", stats.Hits},
+				{"misses", stats.Misses},
+				{"sets", stats.Sets},
+				{"deletes", stats.Deletes},
+				{"expirations", stats.Expirations},
+				{"evictions", stats.Evictions},
+				{"cleared", stats.Cleared},
+				{"compressed values", stats.Compression.Values},
+			}
+			for _, counter := range counters {
+				fmt.Printf("%s%s: %d%s\n", logger.Green, counter.name, counter.value, logger.Reset)
+			}
+			fmt.Printf("%scompression ratio: %.2f%s\n", logger.Green, stats.Compression.Ratio(), logger.Reset)
+		case "help":
+			printHelp()
+		default:
+			fmt.Printf("%sUnknown command. Type \"help\" for a list of commands.%s\n", logger.Red, logger.Reset)
+		}
+	}
+}
+
+func printHelp() {
+	fmt.Println(logger.Purple + "netcache - Available Commands" + logger.Reset)
+	fmt.Printf("\t%sget%s    args: [KEY]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sset%s    args: [KEY, VALUE, TTL]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sincr%s   args: [KEY, DELTA, TTL]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sdecr%s   args: [KEY, DELTA, TTL]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sttl%s    args: [KEY]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%stouch%s  args: [KEY, TTL]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%spersist%s args: [KEY]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sdelete%s args: [KEY]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sinvalidate%s args: [TAG]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sclear%s\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%skeys%s\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sscan%s   args: [PATTERN]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sselect%s args: [NAMESPACE]\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%sstats%s\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%shelp%s\n", logger.Green, logger.Reset)
+	fmt.Printf("\t%squit%s\n", logger.Green, logger.Reset)
+}
@@ -0,0 +1,377 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// The operations recorded in an append-only log.
+type logOp byte
+
+const (
+	// Store an entry, the record holds the key, value, expiry, type and tags.
+	logSet logOp = iota + 1
+	// Delete a key, the record holds the key.
+	logDelete
+	// Clear the cache, the record holds nothing.
+	logClear
+	// Set the expiry of a key, the record holds the key and expiry.
+	logExpire
+	// Delete all items with a tag, the record holds the tag.
+	logInvalidate
+)
+
+// A record in an append-only log.
+//
+// The key of an invalidate record is the tag.
+type logRecord struct {
+	op  logOp
+	key string
+	e   *Entry
+}
+
+// Encode a record, it is framed by its length and a checksum so a partially written record can be detected.
+//
+// Record: Length (uvarint) | CRC32 (uint32) | Op (byte) | Fields (encodeValues)
+func (r *logRecord) encode() []byte {
+	var fields [][]byte
+	switch r.op {
+	case logSet:
+		fields = entryFields(r.key, r.e)
+	case logDelete, logInvalidate:
+		fields = [][]byte{[]byte(r.key)}
+	case logExpire:
+		fields = [][]byte{[]byte(r.key), encodeExpiry(r.e.Expires)}
+	}
+	return frameRecord(append([]byte{byte(r.op)}, encodeValues(fields)...))
+}
+
+// Frame the body of a record by its length and a checksum, so a partially written record can be detected.
+//
+// Frame: Length (uvarint) | CRC32 (uint32) | Body
+func frameRecord(body []byte) []byte {
+	var b = binary.AppendUvarint(nil, uint64(len(body)))
+	b = binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(body))
+	return append(b, body...)
+}
+
+// Read a framed record, returning its body and the size of the frame.
+//
+// Returns io.EOF at the end of the reader, io.ErrUnexpectedEOF if the reader ends inside the record,
+// or ErrCorruptValue if the record fails its checksum.
+func readFrame(r *bufio.Reader) (body []byte, size int64, err error) {
+	var length uint64
+	if length, err = binary.ReadUvarint(r); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, err
+		}
+		return nil, 0, ErrCorruptValue
+	}
+	if length > math.MaxInt64 {
+		return nil, 0, ErrCorruptValue
+	}
+	var header [4]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	// Copied instead of allocated up front, so a corrupt length cannot allocate more than the rest of the log.
+	var buf bytes.Buffer
+	if _, err = io.CopyN(&buf, r, int64(length)); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	body = buf.Bytes()
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[:]) {
+		return nil, 0, ErrCorruptValue
+	}
+	return body, int64(len(binary.AppendUvarint(nil, length))) + int64(len(header)) + int64(length), nil
+}
+
+// Decode the body of a record.
+func decodeLogRecord(body []byte) (*logRecord, error) {
+	if len(body) == 0 {
+		return nil, ErrCorruptValue
+	}
+	var fields, err = decodeValues(body[1:])
+	if err != nil {
+		return nil, err
+	}
+	var r = &logRecord{op: logOp(body[0])}
+	switch r.op {
+	case logSet:
+		if len(fields) != entryFieldCount {
+			return nil, ErrCorruptValue
+		}
+		if r.key, r.e, err = parseEntryFields(fields); err != nil {
+			return nil, err
+		}
+	case logDelete, logInvalidate:
+		if len(fields) != 1 {
+			return nil, ErrCorruptValue
+		}
+		r.key = string(fields[0])
+	case logClear:
+	case logExpire:
+		if len(fields) != 2 {
+			return nil, ErrCorruptValue
+		}
+		r.key = string(fields[0])
+		r.e = &Entry{}
+		if r.e.Expires, err = decodeExpiry(fields[1]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrCorruptValue
+	}
+	return r, nil
+}
+
+// Apply a record to a cache.
+func (r *logRecord) apply(c Cache) error {
+	var err error
+	switch r.op {
+	case logSet:
+		err = c.SetEntry(r.key, r.e)
+	case logDelete:
+		_, err = c.Delete(r.key)
+	case logClear:
+		err = c.Clear()
+	case logExpire:
+		err = c.Expire(r.key, r.e.Expires)
+	case logInvalidate:
+		_, err = c.InvalidateTag(r.key)
+	}
+	// The key may already be gone, because it expired since the record was written.
+	if ErrItemNotFound.Is(err) {
+		return nil
+	}
+	return err
+}
+
+// Read the records from a log, and apply them to the cache.
+//
+// Returns the size of the valid part of the log, a partially written record at the end is not applied.
+// A corrupt record followed by more records is an error, cutting it off would lose the records after it.
+func replayLog(r io.Reader, c Cache) (size int64, err error) {
+	var br = bufio.NewReader(r)
+	for {
+		var body, n, err = readFrame(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, nil
+		}
+		var record *logRecord
+		if err == nil {
+			record, err = decodeLogRecord(body)
+		}
+		if err != nil {
+			// The last record may have been torn by a crash while it was written.
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				return size, nil
+			}
+			return size, fmt.Errorf("%w: record at offset %d of the log is corrupt, and followed by more records", ErrCorruptValue, size)
+		}
+		if err = record.apply(c); err != nil {
+			return size, err
+		}
+		size += n
+	}
+}
+
+// An append-only log of the changes made to a cache.
+//
+// The log is rewritten from the contents of the cache when it grows too large,
+// changes made while it is rewritten are buffered and appended to the new log.
+type appendLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	// The size of the log, and its size after it was last rewritten.
+	size        int64
+	rewriteBase int64
+	rewriteSize int64
+	// Changes made while the log is rewritten, nil if the log is not being rewritten.
+	rewriteBuf *bytes.Buffer
+	syncPolicy SyncPolicy
+	unsynced   bool
+	// The background rewrites in progress, waited for when the log is closed.
+	rewrites sync.WaitGroup
+}
+
+// Append a record to the log, flushing it to disk if the sync policy requires it.
+//
+// Reports whether the log should be rewritten.
+func (l *appendLog) append(r *logRecord) (rewrite bool, err error) {
+	var b = r.encode()
+	if _, err = l.file.Write(b); err != nil {
+		return false, err
+	}
+	l.size += int64(len(b))
+	if l.rewriteBuf != nil {
+		l.rewriteBuf.Write(b)
+	}
+	switch l.syncPolicy {
+	case SyncAlways:
+		if err = l.file.Sync(); err != nil {
+			return false, err
+		}
+	case SyncPeriodic:
+		l.unsynced = true
+	}
+	return l.rewriteBuf == nil && l.rewriteSize > 0 && l.size >= l.rewriteSize && l.size >= 2*l.rewriteBase, nil
+}
+
+// Flush the log to disk if records were appended since the last sync.
+func (l *appendLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.unsynced {
+		return nil
+	}
+	l.unsynced = false
+	return l.file.Sync()
+}
+
+// Rewrite the log from the contents of the cache.
+//
+// The cache is read without holding the mutex of the log, so the cache can be changed while it is rewritten.
+// Every record is idempotent, so changes which are both in the new log and in the buffer are applied correctly.
+func (l *appendLog) rewrite(c Cache) (err error) {
+	l.mu.Lock()
+	if l.rewriteBuf != nil {
+		l.mu.Unlock()
+		return nil
+	}
+	l.rewriteBuf = new(bytes.Buffer)
+	l.mu.Unlock()
+
+	var tmp *os.File
+	defer func() {
+		if err != nil {
+			l.mu.Lock()
+			l.rewriteBuf = nil
+			l.mu.Unlock()
+			if tmp != nil {
+				tmp.Close()
+				os.Remove(tmp.Name())
+			}
+		}
+	}()
+
+	tmp, err = os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+tempFileMarker+"*")
+	if err != nil {
+		return err
+	}
+	var w = bufio.NewWriter(tmp)
+	for _, key := range c.Keys() {
+		var e, err = peekEntry(c, key)
+		if err != nil {
+			if ErrItemNotFound.Is(err) {
+				continue
+			}
+			return err
+		}
+		var r = &logRecord{op: logSet, key: key, e: e}
+		if _, err = w.Write(r.encode()); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err = l.rewriteBuf.WriteTo(w); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	var info os.FileInfo
+	if info, err = tmp.Stat(); err != nil {
+		return err
+	}
+	// The old log is closed first, open files cannot be replaced on windows.
+	l.file.Close()
+	if err = os.Rename(tmp.Name(), l.path); err != nil {
+		var file, openErr = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0644)
+		if openErr != nil {
+			return openErr
+		}
+		l.file = file
+		return err
+	}
+	syncDir(filepath.Dir(l.path))
+	l.file = tmp
+	l.size = info.Size()
+	l.rewriteBase = l.size
+	l.rewriteBuf = nil
+	return nil
+}
+
+// Close the log, flushing it to disk unless the sync policy is SyncNever.
+func (l *appendLog) close() error {
+	l.rewrites.Wait()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.syncPolicy != SyncNever {
+		l.file.Sync()
+	}
+	return l.file.Close()
+}
+
+// Open an append-only log, replaying its records into the cache.
+//
+// A partially written record at the end of the log is cut off,
+// it is reported as an integrity error after the log has been opened.
+// A corrupt record in the middle of the log fails the open, and the log is left as it is.
+func openLog(path string, c Cache, policy SyncPolicy, rewriteSize int64) (*appendLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	var file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	size, err := replayLog(file, c)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	var info os.FileInfo
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	var integrityErr error
+	if info.Size() > size {
+		if err = file.Truncate(size); err != nil {
+			file.Close()
+			return nil, err
+		}
+		integrityErr = NewIntegrityError([]error{
+			fmt.Errorf("cut off %d bytes of a partially written record at the end of %s", info.Size()-size, path),
+		})
+	}
+	if _, err = file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &appendLog{
+		path:        path,
+		file:        file,
+		size:        size,
+		rewriteBase: size,
+		rewriteSize: rewriteSize,
+		syncPolicy:  policy,
+	}, integrityErr
+}
@@ -0,0 +1,126 @@
+package binarytree
+
+import "fmt"
+
+// A self-balancing (AVL) binary search tree implementation which works with any type that implements the Comparable[T] interface.
+//
+// It has the same API as the InterfacedBST, but the height of the tree is kept at O(log n),
+// no matter the order in which values are inserted.
+type InterfacedAVL[T Comparable[T]] struct {
+	Root   *IF_AVLNode[T]
+	Length int
+}
+
+// Return the AVL tree as a string.
+func (t *InterfacedAVL[T]) String() string {
+	if t.Root == nil {
+		return ""
+	}
+
+	IF_AVLNodes := make([][]string, t.Root.getHeight())
+
+	fillIF_AVLNodes(IF_AVLNodes, t.Root, 0)
+
+	return formatLevels(IF_AVLNodes)
+}
+
+// Initialize a new AVL tree with the given initial value.
+func NewInterfacedAVL[T Comparable[T]](initial T) *InterfacedAVL[T] {
+	return &InterfacedAVL[T]{
+		Root:   &IF_AVLNode[T]{Val: initial, Height: 1},
+		Length: 1,
+	}
+}
+
+// Insert a value into the AVL tree.
+//
+// If the value is already present, it is replaced.
+func (t *InterfacedAVL[T]) Insert(value T) (inserted bool) {
+	t.Root, inserted = t.Root.insert(value)
+	if inserted {
+		t.Length++
+	}
+	return inserted
+}
+
+// Search for, and return, a value in the AVL tree.
+func (t *InterfacedAVL[T]) Search(value T) (v T, ok bool) {
+	return t.Root.search(value)
+}
+
+// Delete a value from the AVL tree.
+func (t *InterfacedAVL[T]) Delete(value T) (deleted bool) {
+	t.Root, deleted = t.Root.delete(value)
+	if deleted {
+		t.Length--
+	}
+	return deleted
+}
+
+// Delete all values from the AVL tree that match the given predicate.
+//
+// The predicate is called once for every value, in order.
+func (t *InterfacedAVL[T]) DeleteIf(predicate func(T) bool) (deleted int) {
+	var matches []T
+	t.Root.traverse(func(v T) {
+		if predicate(v) {
+			matches = append(matches, v)
+		}
+	})
+	for _, v := range matches {
+		if t.Delete(v) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Traverse the AVL tree in-order.
+func (t *InterfacedAVL[T]) Traverse(f func(T)) {
+	t.Root.traverse(f)
+}
+
+// Traverse the AVL tree in-order, starting at the first value which is not less than from.
+//
+// The traversal stops when f returns false.
+func (t *InterfacedAVL[T]) AscendFrom(from T, f func(T) bool) {
+	t.Root.ascendFrom(from, f)
+}
+
+// Return the number of values in the AVL tree.
+func (t *InterfacedAVL[T]) Len() int {
+	return t.Length
+}
+
+// Return the height of the AVL tree.
+func (t *InterfacedAVL[T]) Height() int {
+	return t.Root.getHeight()
+}
+
+// Clear the AVL tree.
+func (t *InterfacedAVL[T]) Clear() {
+	t.Root = nil
+	t.Length = 0
+}
+
+// Rebuild the AVL tree from its values.
+//
+// This restores the balance of a tree which was decoded from
+// a dump made by an unbalanced tree, or a dump without node heights.
+func (t *InterfacedAVL[T]) Rebuild() {
+	var root = t.Root
+	t.Clear()
+	root.traverse(func(v T) {
+		t.Insert(v)
+	})
+}
+
+func fillIF_AVLNodes[T Comparable[T]](IF_AVLNodes [][]string, n *IF_AVLNode[T], depth int) {
+	if n == nil {
+		return
+	}
+
+	IF_AVLNodes[depth] = append(IF_AVLNodes[depth], fmt.Sprintf("%v", n.Val))
+	fillIF_AVLNodes(IF_AVLNodes, n.Left, depth+1)
+	fillIF_AVLNodes(IF_AVLNodes, n.Right, depth+1)
+}
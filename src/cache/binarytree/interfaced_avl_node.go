@@ -0,0 +1,168 @@
+package binarytree
+
+// A node of the AVL tree.
+//
+// Height is the height of the subtree rooted at this node, a leaf has a height of 1.
+type IF_AVLNode[T Comparable[T]] struct {
+	Val    T
+	Left   *IF_AVLNode[T]
+	Right  *IF_AVLNode[T]
+	Height int
+}
+
+func (n *IF_AVLNode[T]) Value() T {
+	return n.Val
+}
+
+func (n *IF_AVLNode[T]) getHeight() int {
+	if n == nil {
+		return 0
+	}
+	return n.Height
+}
+
+func (n *IF_AVLNode[T]) balanceFactor() int {
+	return n.Left.getHeight() - n.Right.getHeight()
+}
+
+func (n *IF_AVLNode[T]) updateHeight() {
+	var left, right = n.Left.getHeight(), n.Right.getHeight()
+	if left > right {
+		n.Height = left + 1
+	} else {
+		n.Height = right + 1
+	}
+}
+
+func (n *IF_AVLNode[T]) rotateRight() *IF_AVLNode[T] {
+	var left = n.Left
+	n.Left = left.Right
+	left.Right = n
+	n.updateHeight()
+	left.updateHeight()
+	return left
+}
+
+func (n *IF_AVLNode[T]) rotateLeft() *IF_AVLNode[T] {
+	var right = n.Right
+	n.Right = right.Left
+	right.Left = n
+	n.updateHeight()
+	right.updateHeight()
+	return right
+}
+
+// Restore the balance of the subtree rooted at this node,
+// returns the new root of the subtree.
+func (n *IF_AVLNode[T]) rebalance() *IF_AVLNode[T] {
+	n.updateHeight()
+	var balance = n.balanceFactor()
+	if balance > 1 {
+		if n.Left.balanceFactor() < 0 {
+			n.Left = n.Left.rotateLeft()
+		}
+		return n.rotateRight()
+	}
+	if balance < -1 {
+		if n.Right.balanceFactor() > 0 {
+			n.Right = n.Right.rotateRight()
+		}
+		return n.rotateLeft()
+	}
+	return n
+}
+
+func (n *IF_AVLNode[T]) insert(v T) (newRoot *IF_AVLNode[T], inserted bool) {
+	if n == nil {
+		return &IF_AVLNode[T]{Val: v, Height: 1}, true
+	}
+
+	if n.Val.Lt(v) {
+		n.Right, inserted = n.Right.insert(v)
+	} else if n.Val.Gt(v) {
+		n.Left, inserted = n.Left.insert(v)
+	} else if n.Val.Equals(v) {
+		n.Val = v
+		return n, false
+	}
+
+	if !inserted {
+		return n, false
+	}
+	return n.rebalance(), true
+}
+
+func (n *IF_AVLNode[T]) search(value T) (v T, ok bool) {
+	for n != nil {
+		if n.Val.Lt(value) {
+			n = n.Right
+		} else if n.Val.Gt(value) {
+			n = n.Left
+		} else if n.Val.Equals(value) {
+			return n.Val, true
+		} else {
+			return
+		}
+	}
+	return
+}
+
+func (n *IF_AVLNode[T]) traverse(f func(T)) {
+	if n == nil {
+		return
+	}
+
+	n.Left.traverse(f)
+	f(n.Val)
+	n.Right.traverse(f)
+}
+
+func (n *IF_AVLNode[T]) ascendFrom(from T, f func(T) bool) bool {
+	if n == nil {
+		return true
+	}
+
+	// Values in the left subtree are all less than this node,
+	// skip them if this node is already less than from.
+	if n.Val.Lt(from) {
+		return n.Right.ascendFrom(from, f)
+	}
+
+	return n.Left.ascendFrom(from, f) && f(n.Val) && n.Right.ascendFrom(from, f)
+}
+
+func (n *IF_AVLNode[T]) delete(v T) (newRoot *IF_AVLNode[T], deleted bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	if v.Lt(n.Val) {
+		n.Left, deleted = n.Left.delete(v)
+	} else if v.Gt(n.Val) {
+		n.Right, deleted = n.Right.delete(v)
+	} else if v.Equals(n.Val) {
+		deleted = true
+		if n.Left == nil {
+			return n.Right, deleted
+		} else if n.Right == nil {
+			return n.Left, deleted
+		}
+
+		var minRight = n.Right.findMin()
+		n.Val = minRight.Val
+		n.Right, _ = n.Right.delete(minRight.Val)
+	}
+
+	if !deleted {
+		return n, false
+	}
+	return n.rebalance(), deleted
+}
+
+func (n *IF_AVLNode[T]) findMin() *IF_AVLNode[T] {
+	current := n
+	for current.Left != nil {
+		current = current.Left
+	}
+	return current
+}
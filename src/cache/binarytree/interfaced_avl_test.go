@@ -0,0 +1,78 @@
+package binarytree_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Nigel2392/netcache/src/cache/binarytree"
+)
+
+type intValue int
+
+func (i intValue) Equals(other intValue) bool { return i == other }
+func (i intValue) Lt(other intValue) bool     { return i < other }
+func (i intValue) Gt(other intValue) bool     { return i > other }
+
+func TestInterfacedAVL(t *testing.T) {
+	const n = 10000
+	var tree binarytree.InterfacedAVL[intValue]
+
+	// Sorted inserts turn an unbalanced tree into a linked list.
+	for i := 0; i < n; i++ {
+		if !tree.Insert(intValue(i)) {
+			t.Fatalf("value not inserted %d", i)
+		}
+	}
+	if tree.Insert(intValue(0)) {
+		t.Fatal("duplicate value inserted")
+	}
+
+	var maxHeight = int(1.45*math.Log2(n)) + 1
+	if tree.Height() > maxHeight {
+		t.Fatalf("tree is not balanced, height %d > %d", tree.Height(), maxHeight)
+	}
+
+	for i := 0; i < n; i += 2 {
+		if !tree.Delete(intValue(i)) {
+			t.Fatalf("value not deleted %d", i)
+		}
+	}
+
+	var matched int
+	var deleted = tree.DeleteIf(func(v intValue) bool {
+		if v%3 == 0 {
+			matched++
+		}
+		return v%3 == 0
+	})
+	if deleted != matched || tree.Len() != n/2-matched {
+		t.Fatalf("expected %d values deleted, got %d", matched, deleted)
+	}
+
+	var last = intValue(-1)
+	var count int
+	tree.Traverse(func(v intValue) {
+		if v <= last {
+			t.Fatalf("values out of order %d <= %d", v, last)
+		}
+		if v%2 == 0 || v%3 == 0 {
+			t.Fatalf("deleted value still present %d", v)
+		}
+		last = v
+		count++
+	})
+	if count != tree.Len() {
+		t.Fatalf("length mismatch %d != %d", count, tree.Len())
+	}
+
+	if tree.Height() > maxHeight {
+		t.Fatalf("tree is not balanced after deletes, height %d > %d", tree.Height(), maxHeight)
+	}
+
+	if _, ok := tree.Search(intValue(1)); !ok {
+		t.Fatal("value not found 1")
+	}
+	if _, ok := tree.Search(intValue(3)); ok {
+		t.Fatal("deleted value found 3")
+	}
+}
@@ -1,100 +1,2158 @@
-package cache_test
-
-import (
-	"strconv"
-	"testing"
-	"time"
-
-	"github.com/Nigel2392/netcache/src/cache"
-)
-
-const CACHE_DIR = "./cache-tests"
-
-type cacheItem struct {
-	key   string
-	value []byte
-}
-
-var cacheItems [128]*cacheItem
-
-func init() {
-	for i := 0; i < len(cacheItems); i++ {
-		cacheItems[i] = &cacheItem{
-			key:   "key" + strconv.Itoa(i),
-			value: []byte("value" + strconv.Itoa(i)),
-		}
-	}
-}
-
-func TestFileCache(t *testing.T) {
-	var c = cache.NewFileCache(CACHE_DIR)
-	c.Run(1 * time.Second)
-
-	for _, item := range cacheItems {
-		var inserted, err = c.Set(item.key, item.value, 5*time.Second)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if !inserted {
-			t.Fatalf("item not inserted %s", item.key)
-		}
-	}
-
-	var keys = c.Keys()
-	for _, item := range cacheItems {
-		var found = false
-		for _, key := range keys {
-			if key == item.key {
-				found = true
-				break
-			}
-		}
-		if !found {
-			t.Fatalf("key not found %s", item.key)
-		}
-	}
-
-	for _, item := range cacheItems {
-		var value, ttl, err = c.Get(item.key)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		if ttl <= 0 {
-			t.Fatalf("ttl not positive %s", item.key)
-		}
-
-		if string(value) != string(item.value) {
-			t.Fatalf("value mismatch %s != %s", string(value), string(item.value))
-		}
-	}
-
-	for _, item := range cacheItems {
-		if ttl, has := c.Has(item.key); !has || ttl <= 0 {
-			t.Fatalf("item expired %s", item.key)
-		}
-	}
-
-	for _, item := range cacheItems {
-		var deleted, err = c.Delete(item.key)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if !deleted {
-			t.Fatalf("item not deleted %s", item.key)
-		}
-	}
-
-	for _, item := range cacheItems {
-		var value, ttl, err = c.Get(item.key)
-		if !cache.ErrItemNotFound.Is(err) {
-			t.Fatal(err)
-		}
-		if value != nil {
-			t.Fatalf("value not nil %s", item.key)
-		}
-		if ttl > 0 {
-			t.Fatalf("ttl not zero %s", item.key)
-		}
-	}
-}
+package cache_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+)
+
+const CACHE_DIR = "./cache-tests"
+
+type cacheItem struct {
+	key   string
+	value []byte
+}
+
+var cacheItems [128]*cacheItem
+
+func init() {
+	for i := 0; i < len(cacheItems); i++ {
+		cacheItems[i] = &cacheItem{
+			key:   "key" + strconv.Itoa(i),
+			value: []byte("value" + strconv.Itoa(i)),
+		}
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	var c = cache.NewFileCache(CACHE_DIR)
+	c.Run(1 * time.Second)
+
+	for _, item := range cacheItems {
+		var inserted, err = c.Set(item.key, item.value, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !inserted {
+			t.Fatalf("item not inserted %s", item.key)
+		}
+	}
+
+	var keys = c.Keys()
+	for _, item := range cacheItems {
+		var found = false
+		for _, key := range keys {
+			if key == item.key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("key not found %s", item.key)
+		}
+	}
+
+	for _, item := range cacheItems {
+		var value, ttl, err = c.Get(item.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ttl <= 0 {
+			t.Fatalf("ttl not positive %s", item.key)
+		}
+
+		if string(value) != string(item.value) {
+			t.Fatalf("value mismatch %s != %s", string(value), string(item.value))
+		}
+	}
+
+	for _, item := range cacheItems {
+		if ttl, has := c.Has(item.key); !has || ttl <= 0 {
+			t.Fatalf("item expired %s", item.key)
+		}
+	}
+
+	for _, item := range cacheItems {
+		var deleted, err = c.Delete(item.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !deleted {
+			t.Fatalf("item not deleted %s", item.key)
+		}
+	}
+
+	for _, item := range cacheItems {
+		var value, ttl, err = c.Get(item.key)
+		if !cache.ErrItemNotFound.Is(err) {
+			t.Fatal(err)
+		}
+		if value != nil {
+			t.Fatalf("value not nil %s", item.key)
+		}
+		if ttl > 0 {
+			t.Fatalf("ttl not zero %s", item.key)
+		}
+	}
+}
+
+func TestFileCacheAtomicWrites(t *testing.T) {
+	for _, policy := range []string{"always", "periodic", "never"} {
+		t.Run(policy, func(t *testing.T) {
+			var syncPolicy, err = cache.SyncPolicyFromString(policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var dir = t.TempDir()
+			var c = cache.NewSyncedFileCache(dir, syncPolicy, 10*time.Millisecond)
+			c.Run(time.Minute)
+
+			for _, value := range []string{"first", "second"} {
+				if _, err = c.Set("atomic", []byte(value), cache.NoExpiry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			c.Close()
+
+			// Writes leave no temporary files behind.
+			var files, _ = filepath.Glob(filepath.Join(dir, "*", "*"))
+			if len(files) != 1 || filepath.Base(files[0]) != "atomic" {
+				t.Fatalf("expected only the item file, got %v", files)
+			}
+
+			// Simulate a crash in the middle of a write.
+			var tempFile = files[0] + "~12345"
+			if err = os.WriteFile(tempFile, []byte("sec"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			dump, err := c.Dump()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded = cache.NewSyncedFileCache(dir, syncPolicy, 0)
+			if err = loaded.Load(dump); !cache.IsIntegrityError(err) || !strings.Contains(err.Error(), "leftover temporary file") {
+				t.Fatalf("expected the temporary file to be reported, got %v", err)
+			}
+			if _, err = os.Stat(tempFile); !os.IsNotExist(err) {
+				t.Fatalf("expected the temporary file to be removed, got %v", err)
+			}
+			value, _, err := loaded.Get("atomic")
+			if err != nil || string(value) != "second" {
+				t.Fatalf("expected second, got %s %v", value, err)
+			}
+		})
+	}
+
+	if _, err := cache.SyncPolicyFromString("sometimes"); err == nil {
+		t.Fatal("expected an error for an unknown sync policy")
+	}
+}
+
+func TestFileCacheRebuild(t *testing.T) {
+	var dir = t.TempDir()
+	var c = cache.NewSyncedFileCache(dir, cache.SyncAlways, 0)
+	if _, err := c.Set("rebuild.string", []byte("value"), time.Minute, "tag"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RPush("rebuild.list", []byte("a"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetEntry("rebuild.expired", &cache.Entry{Value: []byte("value"), Expires: time.Now().Add(50 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("rebuild.legacy", []byte("value"), cache.NoExpiry); err != nil {
+		t.Fatal(err)
+	}
+	var entry, err = c.GetEntry("rebuild.string")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Files written by older versions hold nothing but the value.
+	legacyFiles, _ := filepath.Glob(filepath.Join(dir, "*", "rebuild.legacy"))
+	if len(legacyFiles) != 1 {
+		t.Fatalf("expected the legacy file, got %v", legacyFiles)
+	}
+	if err = os.WriteFile(legacyFiles[0], []byte("legacy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	// A new cache starts empty, until its index is rebuilt from the files.
+	var rebuilt = cache.NewSyncedFileCache(dir, cache.SyncAlways, 0)
+	if rebuilt.Len() != 0 {
+		t.Fatalf("expected an empty cache, got %d items", rebuilt.Len())
+	}
+	if err = rebuilt.(*cache.FileCache).Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Len() != 3 {
+		t.Fatalf("expected 3 items, got %v", rebuilt.Keys())
+	}
+	e, err := rebuilt.GetEntry("rebuild.string")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(e.Value) != "value" || e.Version != entry.Version || !e.Expires.Equal(entry.Expires) || len(e.Tags) != 1 {
+		t.Fatalf("expected the metadata to be restored, got %+v", e)
+	}
+	if values, err := rebuilt.LRange("rebuild.list", 0, -1); err != nil || len(values) != 2 {
+		t.Fatalf("expected the list to be restored, got %q %v", values, err)
+	}
+	if value, ttl, err := rebuilt.Get("rebuild.legacy"); err != nil || string(value) != "legacy" || ttl != cache.NoExpiry {
+		t.Fatalf("expected the legacy value, got %s %s %v", value, ttl, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*", "rebuild.expired")); len(files) != 0 {
+		t.Fatalf("expected the expired file to be deleted, got %v", files)
+	}
+
+	// New versions are never lower than the restored versions.
+	version, err := rebuilt.CompareAndSwap("rebuild.string", []byte("swapped"), cache.NoExpiry, entry.Version)
+	if err != nil || version <= entry.Version {
+		t.Fatalf("expected a newer version than %d, got %d %v", entry.Version, version, err)
+	}
+
+	// Stray files are reported.
+	if err = os.WriteFile(filepath.Join(filepath.Dir(legacyFiles[0]), "stray"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = rebuilt.(*cache.FileCache).Rebuild(); !cache.IsIntegrityError(err) || !strings.Contains(err.Error(), "unexpected file") {
+		t.Fatalf("expected the stray file to be reported, got %v", err)
+	}
+}
+
+func TestSegmentCache(t *testing.T) {
+	var dir = t.TempDir()
+	var open = func() *cache.SegmentCache {
+		// Small segments, so segments are rolled over and merged.
+		var c, err = cache.NewSegmentCache(dir, cache.SyncNever, 512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	var c = open()
+	for i := 0; i < 10; i++ {
+		for _, item := range cacheItems[:16] {
+			if _, err := c.Set(item.key, item.value, cache.NoExpiry, "tag"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := c.HSet("segment.hash", map[string][]byte{"field": []byte("value")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Delete(cacheItems[0].key); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetEntry("segment.expired", &cache.Entry{Value: []byte("value"), Expires: time.Now().Add(50 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	var entry, err = c.GetEntry(cacheItems[1].key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var segments, _ = filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segments) < 2 {
+		t.Fatalf("expected the segments to be rolled over, got %v", segments)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	var check = func(c cache.Cache) {
+		t.Helper()
+		if c.Len() != 16 {
+			t.Fatalf("expected 16 items, got %d", c.Len())
+		}
+		for _, item := range cacheItems[1:16] {
+			var value, _, err = c.Get(item.key)
+			if err != nil || string(value) != string(item.value) {
+				t.Fatalf("expected %s, got %s %v", item.value, value, err)
+			}
+		}
+		if _, has := c.Has(cacheItems[0].key); has {
+			t.Fatal("expected the deleted key to stay deleted")
+		}
+		if _, has := c.Has("segment.expired"); has {
+			t.Fatal("expected the expired key to be gone")
+		}
+		if field, err := c.HGet("segment.hash", "field"); err != nil || string(field) != "value" {
+			t.Fatalf("expected the hash, got %s %v", field, err)
+		}
+		if e, err := c.GetEntry(cacheItems[1].key); err != nil || e.Version != entry.Version || len(e.Tags) != 1 {
+			t.Fatalf("expected the metadata to be restored, got %+v %v", e, err)
+		}
+	}
+
+	// The index is rebuilt from the segments.
+	c.Close()
+	c = open()
+	check(c)
+
+	// Merging leaves a single segment with a hint file, next to the active segment.
+	if err = c.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	check(c)
+	segments, _ = filepath.Glob(filepath.Join(dir, "*.seg"))
+	hints, _ := filepath.Glob(filepath.Join(dir, "*.hint"))
+	if len(segments) != 2 || len(hints) != 1 {
+		t.Fatalf("expected 2 segments and a hint file, got %v %v", segments, hints)
+	}
+	c.Close()
+	c = open()
+	check(c)
+
+	// A partially written record is cut off.
+	if _, err = c.Set("segment.partial", []byte("value"), cache.NoExpiry); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	segments, _ = filepath.Glob(filepath.Join(dir, "*.seg"))
+	var last = segments[len(segments)-1]
+	info, err := os.Stat(last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Truncate(last, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	c, err = cache.NewSegmentCache(dir, cache.SyncNever, 512)
+	if !cache.IsIntegrityError(err) || !strings.Contains(err.Error(), "partially written record") {
+		t.Fatalf("expected the partial record to be reported, got %v", err)
+	}
+	check(c)
+
+	// Dumps can be loaded by other caches, and the other way around.
+	dump, err := c.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mem = cache.NewMemoryCache()
+	if err = mem.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	if mem.Len() != 16 {
+		t.Fatalf("expected 16 items, got %d", mem.Len())
+	}
+	if dump, err = mem.Dump(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c = open()
+	if c.Len() != 16 {
+		t.Fatalf("expected the loaded items to survive a restart, got %d items", c.Len())
+	}
+
+	// A clear survives a restart.
+	if err = c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c = open()
+	defer c.Close()
+	if c.Len() != 0 {
+		t.Fatalf("expected an empty cache, got %v", c.Keys())
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	for _, mode := range []cache.WriteMode{cache.WriteThrough, cache.WriteBack} {
+		t.Run(mode.String(), func(t *testing.T) {
+			var l1 = cache.NewGenericBoundedMemoryCache[[]byte](4, 0, cache.EvictLRU)
+			var l2 = cache.NewFileCache(t.TempDir())
+			var c = cache.NewTieredCache(l1, l2, mode)
+			c.Run(time.Minute)
+			defer c.Close()
+
+			for _, item := range cacheItems[:10] {
+				if _, err := c.Set(item.key, item.value, time.Minute, "tag"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, has := l2.Has(cacheItems[0].key); has != (mode == cache.WriteThrough) {
+				t.Fatalf("expected the second tier to be written by %s, got %t", mode, has)
+			}
+			if l1.Len() != 4 {
+				t.Fatalf("expected 4 items in memory, got %d", l1.Len())
+			}
+			if c.Len() != 10 {
+				t.Fatalf("expected 10 items, got %d", c.Len())
+			}
+
+			// Items are promoted on read.
+			var value, _, err = c.Get(cacheItems[0].key)
+			if err != nil || string(value) != string(cacheItems[0].value) {
+				t.Fatalf("expected %s, got %s %v", cacheItems[0].value, value, err)
+			}
+			if _, has := l1.Has(cacheItems[0].key); !has {
+				t.Fatal("expected the item to be promoted")
+			}
+
+			// Both tiers keep the same expiry.
+			if err = c.Touch(cacheItems[0].key, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			c.Keys()
+			memEntry, err := l1.GetEntry(cacheItems[0].key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fileEntry, err := l2.GetEntry(cacheItems[0].key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !memEntry.Expires.Equal(fileEntry.Expires) || memEntry.TTL() < 59*time.Minute {
+				t.Fatalf("expected the same expiry, got %s and %s", memEntry.Expires, fileEntry.Expires)
+			}
+
+			// Versions are consistent, whichever tier serves the item.
+			entry, err := c.GetEntry(cacheItems[0].key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = c.CompareAndSwap(cacheItems[0].key, []byte("swapped"), time.Minute, entry.Version); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = c.CompareAndSwap(cacheItems[0].key, []byte("swapped"), time.Minute, entry.Version); !cache.ErrVersionMismatch.Is(err) {
+				t.Fatalf("expected ErrVersionMismatch, got %v", err)
+			}
+
+			if _, err = c.Delete(cacheItems[1].key); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err = c.Get(cacheItems[1].key); !cache.ErrItemNotFound.Is(err) {
+				t.Fatalf("expected ErrItemNotFound, got %v", err)
+			}
+
+			// Dumps cover both tiers.
+			dump, err := c.Dump()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded = cache.NewTieredCache(cache.NewGenericBoundedMemoryCache[[]byte](4, 0, cache.EvictLRU), cache.NewFileCache(t.TempDir()), mode)
+			if err = loaded.Load(dump); err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Len() != 9 {
+				t.Fatalf("expected 9 items, got %d", loaded.Len())
+			}
+			if value, _, err = loaded.Get(cacheItems[0].key); err != nil || string(value) != "swapped" {
+				t.Fatalf("expected swapped, got %s %v", value, err)
+			}
+			// The swapped item lost its tag.
+			if deleted, err := loaded.InvalidateTag("tag"); err != nil || deleted != 8 {
+				t.Fatalf("expected 8 deleted items, got %d %v", deleted, err)
+			}
+		})
+	}
+}
+
+func TestTieredCacheLargeItem(t *testing.T) {
+	for _, mode := range []cache.WriteMode{cache.WriteThrough, cache.WriteBack} {
+		t.Run(mode.String(), func(t *testing.T) {
+			var l1 = cache.NewGenericBoundedMemoryCache[[]byte](4, 64, cache.EvictLRU)
+			var c = cache.NewTieredCache(l1, cache.NewFileCache(t.TempDir()), mode)
+			c.Run(time.Minute)
+			defer c.Close()
+
+			var large = bytes.Repeat([]byte("a"), 128)
+			if _, err := c.Set("large", large, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			// Flush the pending write, so the item is read from the second tier.
+			c.Keys()
+			if _, has := l1.Has("large"); has {
+				t.Fatal("expected the item to be too large for memory")
+			}
+
+			// Reads do not change the version of an item kept only by the second tier.
+			var first, err = c.GetEntry("large")
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := c.GetEntry("large")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Version != second.Version {
+				t.Fatalf("expected the same version, got %d and %d", first.Version, second.Version)
+			}
+			if _, err = c.CompareAndSwap("large", large[:100], time.Minute, second.Version); err != nil {
+				t.Fatal(err)
+			}
+			c.Keys()
+			swapped, err := c.GetEntry("large")
+			if err != nil || len(swapped.Value) != 100 || swapped.Version == second.Version {
+				t.Fatalf("expected the swapped item with a new version, got %+v %v", swapped, err)
+			}
+		})
+	}
+}
+
+func TestCompressedCache(t *testing.T) {
+	var file = cache.NewFileCache(t.TempDir())
+	var c, err = cache.NewCompressedCache(file, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Run(time.Minute)
+	defer c.Close()
+
+	var large = []byte(strings.Repeat("<p>compressible</p>", 64))
+	if _, err = c.Set("large", large, time.Minute, "tag"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Set("small", []byte("small"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// Large values are stored compressed, and decompressed on read.
+	stored, err := file.GetEntry("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Value) >= len(large) {
+		t.Fatalf("expected the value to be compressed, got %d bytes", len(stored.Value))
+	}
+	value, _, err := c.Get("large")
+	if err != nil || string(value) != string(large) {
+		t.Fatalf("expected the decompressed value, got %d bytes %v", len(value), err)
+	}
+	stored, err = file.GetEntry("small")
+	if err != nil || string(stored.Value) != "small" {
+		t.Fatalf("expected small values to be stored as they are, got %s %v", stored.Value, err)
+	}
+
+	var stats = c.CompressionStats()
+	if stats.Values != 1 || stats.OriginalBytes != int64(len(large)) || stats.Ratio() <= 1 {
+		t.Fatalf("unexpected compression stats %+v", stats)
+	}
+
+	// Commands work on compressed items of every type.
+	if _, err = c.RPush("list", large, large); err != nil {
+		t.Fatal(err)
+	}
+	values, err := c.LRange("list", 0, -1)
+	if err != nil || len(values) != 2 || string(values[1]) != string(large) {
+		t.Fatalf("expected the list to be decompressed, got %d values %v", len(values), err)
+	}
+	entry, err := c.GetEntry("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Type != cache.StringValue {
+		t.Fatalf("expected the compressed flag to be removed, got %v", entry.Type)
+	}
+	if _, err = c.CompareAndSwap("large", []byte("swapped"), time.Minute, entry.Version); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, err = c.Get("large"); err != nil || string(value) != "swapped" {
+		t.Fatalf("expected swapped, got %s %v", value, err)
+	}
+
+	// Dumps hold the decompressed values, so any cache can load them.
+	var dumped = bytes.Repeat([]byte("compressible "), 200)
+	if _, err = c.Set("dumped", dumped, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	dump, err := c.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain = cache.NewMemoryCache()
+	if err = plain.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, err = plain.Get("dumped"); err != nil || !bytes.Equal(value, dumped) {
+		t.Fatalf("expected the decompressed value, got %d bytes %v", len(value), err)
+	}
+
+	if _, err = cache.NewCompressedCache(&cache.LoggedCache{}, 0); !cache.ErrNotAtomic.Is(err) {
+		t.Fatalf("expected ErrNotAtomic, got %v", err)
+	}
+}
+
+func TestEncryptedFileCache(t *testing.T) {
+	var dir = t.TempDir()
+	var oldKeyring, err = cache.NewKeyring([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c = cache.NewFileCache(dir).(*cache.FileCache)
+	c.UseKeyring(oldKeyring)
+	if _, err = c.Set("secret", []byte("personal data"), time.Minute, "tag"); err != nil {
+		t.Fatal(err)
+	}
+	var paths, _ = filepath.Glob(filepath.Join(dir, "*", "secret"))
+	if len(paths) != 1 {
+		t.Fatalf("expected one value file, got %v", paths)
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "personal data") {
+		t.Fatal("expected the value file to be encrypted")
+	}
+	if value, _, err := c.Get("secret"); err != nil || string(value) != "personal data" {
+		t.Fatalf("expected personal data, got %s %v", value, err)
+	}
+
+	// After a key rotation, values written with the old key are read and encrypted again with the new key.
+	rotated, err := cache.NewKeyring([]byte("fedcba9876543210"), []byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reopened = cache.NewFileCache(dir).(*cache.FileCache)
+	reopened.UseKeyring(rotated)
+	if err = reopened.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, err := reopened.Get("secret"); err != nil || string(value) != "personal data" {
+		t.Fatalf("expected personal data, got %s %v", value, err)
+	}
+	newKeyring, err := cache.NewKeyring([]byte("fedcba9876543210"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rotatedOnly = cache.NewFileCache(dir).(*cache.FileCache)
+	rotatedOnly.UseKeyring(newKeyring)
+	if err = rotatedOnly.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, err := rotatedOnly.Get("secret"); err != nil || string(value) != "personal data" {
+		t.Fatalf("expected the value to be encrypted with the new key, got %s %v", value, err)
+	}
+
+	// Reading with the wrong key, or without a key, fails instead of returning the encrypted value.
+	for _, keyring := range []*cache.Keyring{oldKeyring, nil} {
+		var wrong = cache.NewFileCache(dir).(*cache.FileCache)
+		wrong.UseKeyring(keyring)
+		if err = wrong.Rebuild(); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err = wrong.Get("secret"); !errors.Is(err, cache.ErrWrongKey) {
+			t.Fatalf("expected ErrWrongKey, got %v", err)
+		}
+	}
+
+	// Values are bound to their key, a value copied to another key fails to authenticate.
+	if _, err = rotatedOnly.Set("other", []byte("other data"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	otherPaths, _ := filepath.Glob(filepath.Join(dir, "*", "other"))
+	data, _ = os.ReadFile(paths[0])
+	if err = os.WriteFile(otherPaths[0], data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = rotatedOnly.Get("other"); !errors.Is(err, cache.ErrCorruptValue) {
+		t.Fatalf("expected ErrCorruptValue, got %v", err)
+	}
+
+	// Whether a value is encrypted is stored in the header of its file, not guessed from the value.
+	var plainDir = t.TempDir()
+	var plain = cache.NewFileCache(plainDir).(*cache.FileCache)
+	var lookalike = []byte("NCENC\x00\x01\x02\x03\x04 not encrypted")
+	if _, err = plain.Set("lookalike", lookalike, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, err := plain.Get("lookalike"); err != nil || !bytes.Equal(value, lookalike) {
+		t.Fatalf("expected %q, got %q %v", lookalike, value, err)
+	}
+	var keyed = cache.NewFileCache(plainDir).(*cache.FileCache)
+	keyed.UseKeyring(newKeyring)
+	if err = keyed.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, err := keyed.Get("lookalike"); err != nil || !bytes.Equal(value, lookalike) {
+		t.Fatalf("expected %q, got %q %v", lookalike, value, err)
+	}
+	// The value written before the keyring was used is encrypted once it is read.
+	var reread = cache.NewFileCache(plainDir).(*cache.FileCache)
+	if err = reread.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = reread.Get("lookalike"); !errors.Is(err, cache.ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+}
+
+func TestRemovalObserver(t *testing.T) {
+	type observable interface {
+		cache.Cache
+		OnRemove(observer cache.RemovalObserver)
+	}
+	var caches = map[string]observable{
+		"memory": cache.NewGenericBoundedMemoryCache[[]byte](2, 0, cache.EvictLRU),
+		"file":   cache.NewFileCache(t.TempDir()).(*cache.FileCache),
+	}
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var removed = make(map[string]cache.RemovalReason)
+			c.OnRemove(func(key string, reason cache.RemovalReason) {
+				// The mutex of the cache is released before the observer is called.
+				c.Has(key)
+				mu.Lock()
+				removed[key] = reason
+				mu.Unlock()
+			})
+			var reason = func(key string) cache.RemovalReason {
+				mu.Lock()
+				defer mu.Unlock()
+				return removed[key]
+			}
+
+			if _, err := c.Set("expires", []byte("value"), 1100*time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Set("deleted", []byte("value"), time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Delete("deleted"); err != nil {
+				t.Fatal(err)
+			}
+			if reason("deleted") != cache.RemovedDeleted {
+				t.Fatalf("expected deleted, got %s", reason("deleted"))
+			}
+
+			c.Run(100 * time.Millisecond)
+			defer c.Close()
+			var deadline = time.Now().Add(5 * time.Second)
+			for reason("expires") == 0 && time.Now().Before(deadline) {
+				time.Sleep(50 * time.Millisecond)
+			}
+			if reason("expires") != cache.RemovedExpired {
+				t.Fatalf("expected expired, got %s", reason("expires"))
+			}
+
+			for _, key := range []string{"evicted", "key1", "key2"} {
+				if _, err := c.Set(key, []byte("value"), time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if name == "memory" && reason("evicted") != cache.RemovedEvicted {
+				t.Fatalf("expected evicted, got %s", reason("evicted"))
+			}
+
+			if err := c.Clear(); err != nil {
+				t.Fatal(err)
+			}
+			if reason("key1") != cache.RemovedCleared || reason("key2") != cache.RemovedCleared {
+				t.Fatalf("expected cleared, got %s and %s", reason("key1"), reason("key2"))
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	var segment, err = cache.NewSegmentCache(t.TempDir(), cache.SyncNever, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer segment.Close()
+	logged, err := cache.NewLoggedCache(cache.NewBoundedMemoryCache(2, 0, cache.EvictLRU), filepath.Join(t.TempDir(), "appendonly.netcache"), cache.SyncNever, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logged.Close()
+	logged.Run(time.Minute)
+
+	var caches = map[string]cache.Cache{
+		"memory":  cache.NewBoundedMemoryCache(2, 0, cache.EvictLRU),
+		"sharded": cache.NewShardedMemoryCache(1, 2, 0, cache.EvictLRU),
+		"file":    cache.NewFileCache(t.TempDir()),
+		"segment": segment,
+		// The items the logged cache reads to record them are not counted.
+		"logged": logged,
+	}
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			for _, item := range cacheItems[:3] {
+				if _, err := c.Set(item.key, item.value, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c.Get(cacheItems[2].key)
+			c.Get("missing")
+			if _, err := c.Delete(cacheItems[2].key); err != nil {
+				t.Fatal(err)
+			}
+
+			var stats = c.Stats()
+			var evictions, items int64 = 0, 2
+			if name != "file" && name != "segment" {
+				evictions, items = 1, 1
+			}
+			if stats.Hits != 1 || stats.Misses != 1 || stats.Sets != 3 || stats.Deletes != 1 || stats.Evictions != evictions {
+				t.Fatalf("unexpected statistics %+v", stats)
+			}
+			if stats.Items != items || stats.Bytes <= 0 {
+				t.Fatalf("expected %d items using some bytes, got %d items and %d bytes", items, stats.Items, stats.Bytes)
+			}
+
+			// Reading an item as another type than its own is a miss.
+			if _, _, err := c.Get(cacheItems[1].key); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.LRange(cacheItems[1].key, 0, -1); !cache.ErrWrongType.Is(err) {
+				t.Fatalf("expected ErrWrongType, got %v", err)
+			}
+			if stats = c.Stats(); stats.Hits != 2 || stats.Misses != 2 {
+				t.Fatalf("expected 2 hits and 2 misses, got %+v", stats)
+			}
+
+			if err := c.Clear(); err != nil {
+				t.Fatal(err)
+			}
+			if stats = c.Stats(); stats.Cleared != items || stats.Items != 0 {
+				t.Fatalf("expected %d cleared items, got %+v", items, stats)
+			}
+		})
+	}
+}
+
+// A JSON dump made by the first version of the in-memory cache, holding the remaining TTL of every item.
+const legacyJSONDump = `{"key1":{"Key":"key1","Value":"eyJ2YWx1ZSI6InZhbHVlMSIsImtleWFibGUiOiJrZXkxIn0=","TTL":5000000000},` +
+	`"key2":{"Key":"key2","Value":"eyJ2YWx1ZSI6InZhbHVlMiIsImtleWFibGUiOiJrZXkyIn0=","TTL":5000000000},` +
+	`"expired":{"Key":"expired","Value":"dmFsdWU=","TTL":-1000000000}}`
+
+// The index of a gob dump made by the first version of the file cache.
+type legacyFileItem struct {
+	Key      string
+	Hash     uint64
+	TTL      time.Duration
+	Filepath string
+}
+
+type legacyFileNode struct {
+	Val   *legacyFileItem
+	Left  *legacyFileNode
+	Right *legacyFileNode
+}
+
+type legacyFileTree struct {
+	Root *legacyFileNode
+}
+
+func TestLoadLegacyDump(t *testing.T) {
+	var newSegmentCache = func() cache.Cache {
+		var c, err = cache.NewSegmentCache(t.TempDir(), cache.SyncNever, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	var caches = map[string]cache.Cache{
+		"memory":   cache.NewMemoryCache(),
+		"sharded":  cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU),
+		"segments": newSegmentCache(),
+	}
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			defer c.Close()
+			if err := c.Load([]byte(legacyJSONDump)); err != nil {
+				t.Fatal(err)
+			}
+			if c.Len() != 2 {
+				t.Fatalf("expected 2 items, got %v", c.Keys())
+			}
+			var value, ttl, err = c.Get("key1")
+			if err != nil || !strings.Contains(string(value), "value1") {
+				t.Fatalf("expected value1, got %s %v", value, err)
+			}
+			if ttl <= 0 || ttl > 5*time.Second {
+				t.Fatalf("expected the TTL of the dump to be kept, got %v", ttl)
+			}
+		})
+	}
+
+	t.Run("file", func(t *testing.T) {
+		var c = cache.NewFileCache(t.TempDir())
+		// Old dumps only hold the index, the values are already in the cache directory.
+		for _, key := range []string{"key1", "expired"} {
+			if _, err := c.Set(key, []byte("value"), cache.NoExpiry); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var tree = legacyFileTree{Root: &legacyFileNode{
+			Val:  &legacyFileItem{Key: "key1", TTL: time.Hour},
+			Left: &legacyFileNode{Val: &legacyFileItem{Key: "expired", TTL: -time.Second}},
+		}}
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(tree); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Load(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if c.Len() != 1 {
+			t.Fatalf("expected 1 item, got %v", c.Keys())
+		}
+		var ttl, has = c.Has("key1")
+		if !has || ttl <= 59*time.Minute || ttl > time.Hour {
+			t.Fatalf("expected the TTL of the dump to be kept, got %v %v", ttl, has)
+		}
+	})
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	var tests = []struct {
+		policy  cache.EvictionPolicy
+		evicted string
+	}{
+		{cache.EvictLRU, "key1"},
+		{cache.EvictLFU, "key2"},
+		{cache.EvictFIFO, "key0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			var c = cache.NewBoundedMemoryCache(3, 0, test.policy)
+			for i := 0; i < 3; i++ {
+				if _, err := c.Set(cacheItems[i].key, cacheItems[i].value, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// key2 is the least frequently used, key1 the least recently used.
+			c.Get("key1")
+			c.Get("key1")
+			c.Get("key0")
+			c.Get("key0")
+			c.Get("key2")
+
+			if _, err := c.Set(cacheItems[3].key, cacheItems[3].value, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Len() != 3 {
+				t.Fatalf("expected 3 items, got %d", c.Len())
+			}
+			if _, has := c.Has(test.evicted); has {
+				t.Fatalf("expected %s to be evicted", test.evicted)
+			}
+			if _, has := c.Has(cacheItems[3].key); !has {
+				t.Fatalf("newest item %s was evicted", cacheItems[3].key)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	// Every item is 4 bytes of key and 6 bytes of value.
+	var c = cache.NewBoundedMemoryCache(0, 30, cache.EvictLRU)
+	for i := 0; i < 5; i++ {
+		if _, err := c.Set(cacheItems[i].key, cacheItems[i].value, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if c.Len() != 3 {
+		t.Fatalf("expected 3 items, got %d", c.Len())
+	}
+
+	if _, err := c.Set("key", make([]byte, 64), time.Minute); !cache.ErrItemTooLarge.Is(err) {
+		t.Fatalf("expected ErrItemTooLarge, got %v", err)
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	var c = cache.NewMemoryCache()
+	if _, err := c.Set("key", []byte("value"), 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading the item must not shorten its lifetime.
+	var start = time.Now()
+	for i := 0; i < 100; i++ {
+		c.Get("key")
+		c.Has("key")
+	}
+	var _, ttl, err = c.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl > 2*time.Second || ttl < 2*time.Second-time.Since(start)-10*time.Millisecond {
+		t.Fatalf("ttl drifted: %s", ttl)
+	}
+
+	dump, err := c.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded = cache.NewMemoryCache()
+	if err = loaded.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	loadedTTL, has := loaded.Has("key")
+	if !has || loadedTTL > ttl || loadedTTL <= 0 {
+		t.Fatalf("ttl not restored: %s (was %s)", loadedTTL, ttl)
+	}
+
+	time.Sleep(2 * time.Second)
+	if _, _, err = loaded.Get("key"); !cache.ErrItemNotFound.Is(err) {
+		t.Fatalf("expected item to be expired, got %v", err)
+	}
+}
+
+func TestShardedMemoryCache(t *testing.T) {
+	var c = cache.NewShardedMemoryCache(8, 0, 0, cache.EvictLRU)
+	c.Run(time.Second)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for _, item := range cacheItems {
+		wg.Add(1)
+		go func(item *cacheItem) {
+			defer wg.Done()
+			if _, err := c.Set(item.key, item.value, time.Minute); err != nil {
+				t.Error(err)
+				return
+			}
+			var value, _, err = c.Get(item.key)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(value) != string(item.value) {
+				t.Errorf("value mismatch %s != %s", string(value), string(item.value))
+			}
+		}(item)
+	}
+	wg.Wait()
+
+	if c.Len() != len(cacheItems) {
+		t.Fatalf("expected %d items, got %d", len(cacheItems), c.Len())
+	}
+
+	// Dumps are interchangeable with the regular in-memory cache.
+	dump, err := c.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded = cache.NewMemoryCache()
+	if err = loaded.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Keys()) != len(cacheItems) {
+		t.Fatalf("expected %d keys, got %d", len(cacheItems), len(loaded.Keys()))
+	}
+
+	if err = c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range cacheItems {
+		if _, has := c.Has(item.key); !has {
+			t.Fatalf("key not found after load %s", item.key)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	var mem = cache.NewMemoryCache()
+	if _, err := mem.Set("snapshot.string", []byte("value"), time.Minute, "tag"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.HSet("snapshot.hash", map[string][]byte{"field": []byte("value")}); err != nil {
+		t.Fatal(err)
+	}
+	var version, err = mem.CompareAndSwap("snapshot.cas", []byte("value"), cache.NoExpiry, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshots can be loaded by every cache.
+	dump, err := mem.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file = cache.NewFileCache(t.TempDir())
+	if err = file.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump, err = file.Dump(); err != nil {
+		t.Fatal(err)
+	}
+	var sharded = cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU)
+	if err = sharded.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []cache.Cache{file, sharded} {
+		var value, ttl, err = c.Get("snapshot.string")
+		if err != nil || string(value) != "value" || ttl <= 0 {
+			t.Fatalf("expected value with a ttl, got %s %s %v", value, ttl, err)
+		}
+		if e, err := c.GetEntry("snapshot.string"); err != nil || len(e.Tags) != 1 || e.Tags[0] != "tag" {
+			t.Fatalf("expected the tags to be loaded, got %v", err)
+		}
+		if field, err := c.HGet("snapshot.hash", "field"); err != nil || string(field) != "value" {
+			t.Fatalf("expected the hash to be loaded, got %s %v", field, err)
+		}
+		if _, err = c.CompareAndSwap("snapshot.cas", []byte("swapped"), cache.NoExpiry, version); err != nil {
+			t.Fatalf("expected the version to be loaded, got %v", err)
+		}
+	}
+
+	// Corrupt snapshots are rejected, and leave the cache untouched.
+	for _, i := range []int{len("NETCACHE-SNAPSHOT\n"), len(dump) / 2, len(dump) - 1} {
+		var corrupt = append([]byte(nil), dump...)
+		corrupt[i] ^= 0xff
+		if err = sharded.Load(corrupt); !errors.Is(err, cache.ErrCorruptSnapshot) {
+			t.Fatalf("expected a corrupt snapshot error, got %v", err)
+		}
+	}
+	if err = file.Load(dump[:len(dump)-1]); !errors.Is(err, cache.ErrCorruptSnapshot) {
+		t.Fatalf("expected a corrupt snapshot error, got %v", err)
+	}
+	if _, _, err = file.Get("snapshot.string"); err != nil {
+		t.Fatalf("expected the cache to be untouched, got %v", err)
+	}
+
+	// Dumps made by older versions are still loaded.
+	var legacy = `{"legacy.key":{"Key":"legacy.key","Value":"dmFsdWU=","Expires":"0001-01-01T00:00:00Z","Version":3,"Tags":null,"Type":0}}`
+	for _, c := range []cache.Cache{cache.NewMemoryCache(), sharded} {
+		if err = c.Load([]byte(legacy)); err != nil {
+			t.Fatal(err)
+		}
+		var value, _, err = c.Get("legacy.key")
+		if err != nil || string(value) != "value" {
+			t.Fatalf("expected the legacy dump to be loaded, got %s %v", value, err)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	var caches = map[string]cache.Cache{
+		"memory":  cache.NewMemoryCache(),
+		"sharded": cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU),
+		"file":    cache.NewFileCache(CACHE_DIR),
+	}
+
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Clear()
+
+			for _, item := range cacheItems {
+				if _, err := c.Set(item.key, item.value, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// key1, key10 - key19 and key100 - key127
+			var expected = 1 + 10 + 28
+			var scanned []string
+			var cursor string
+			for {
+				var keys, next, err = c.Scan(cursor, "key1*", 7)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(keys) > 7 {
+					t.Fatalf("expected at most 7 keys, got %d", len(keys))
+				}
+				scanned = append(scanned, keys...)
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+
+			if len(scanned) != expected {
+				t.Fatalf("expected %d keys, got %d: %v", expected, len(scanned), scanned)
+			}
+			for i, key := range scanned {
+				if key[:4] != "key1" {
+					t.Fatalf("key does not match pattern %s", key)
+				}
+				if i > 0 && key <= scanned[i-1] {
+					t.Fatalf("keys out of order %s <= %s", key, scanned[i-1])
+				}
+			}
+
+			var keys, _, err = c.Scan("", "key?", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != 10 {
+				t.Fatalf("expected 10 keys, got %d: %v", len(keys), keys)
+			}
+
+			if _, _, err = c.Scan("", "[", 0); err == nil {
+				t.Fatal("expected error for malformed pattern")
+			}
+		})
+	}
+}
+
+func TestIncr(t *testing.T) {
+	var caches = map[string]cache.Cache{
+		"memory":  cache.NewMemoryCache(),
+		"sharded": cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU),
+		"file":    cache.NewFileCache(CACHE_DIR),
+	}
+
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Delete("counter")
+
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := c.Incr("counter", 2, 10, time.Minute); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			var value, err = c.Incr("counter", -10, 0, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != 100 {
+				t.Fatalf("expected 100, got %d", value)
+			}
+
+			stored, _, err := c.Get("counter")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(stored) != "100" {
+				t.Fatalf("expected stored value 100, got %s", stored)
+			}
+
+			if _, err = c.Set("counter", []byte("not a number"), time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = c.Incr("counter", 1, 0, time.Minute); !cache.ErrNotInteger.Is(err) {
+				t.Fatalf("expected ErrNotInteger, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	var caches = map[string]cache.Cache{
+		"memory":  cache.NewMemoryCache(),
+		"sharded": cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU),
+		"file":    cache.NewFileCache(CACHE_DIR),
+	}
+
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Delete("cas")
+
+			if _, err := c.CompareAndSwap("cas", []byte("value"), time.Minute, 1); !cache.ErrVersionMismatch.Is(err) {
+				t.Fatalf("expected ErrVersionMismatch for missing key, got %v", err)
+			}
+			var version, err = c.CompareAndSwap("cas", []byte("value1"), time.Minute, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entry, err := c.GetEntry("cas")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Version != version || string(entry.Value) != "value1" {
+				t.Fatalf("expected value1 at version %d, got %s at version %d", version, entry.Value, entry.Version)
+			}
+
+			if _, err = c.Set("cas", []byte("value2"), time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = c.CompareAndSwap("cas", []byte("value3"), time.Minute, version); !cache.ErrVersionMismatch.Is(err) {
+				t.Fatalf("expected ErrVersionMismatch, got %v", err)
+			}
+
+			entry, err = c.GetEntry("cas")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Version <= version || string(entry.Value) != "value2" {
+				t.Fatalf("expected value2 at a newer version than %d, got %s at version %d", version, entry.Value, entry.Version)
+			}
+			if _, err = c.CompareAndSwap("cas", []byte("value3"), time.Minute, entry.Version); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	var caches = map[string]cache.Cache{
+		"memory":  cache.NewMemoryCache(),
+		"sharded": cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU),
+		"file":    cache.NewFileCache(CACHE_DIR),
+	}
+
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Delete("token")
+
+			if replaced, err := c.Replace("token", []byte("value"), time.Minute); err != nil || replaced {
+				t.Fatalf("expected missing key not to be replaced, got %v %v", replaced, err)
+			}
+			if _, has := c.Has("token"); has {
+				t.Fatal("key created by Replace")
+			}
+
+			var set, err = c.SetNX("token", []byte("value1"), time.Minute)
+			if err != nil || !set {
+				t.Fatalf("expected key to be set, got %v %v", set, err)
+			}
+			if set, err = c.SetNX("token", []byte("value2"), time.Minute); err != nil || set {
+				t.Fatalf("expected existing key not to be set, got %v %v", set, err)
+			}
+
+			replaced, err := c.Replace("token", []byte("value3"), time.Minute)
+			if err != nil || !replaced {
+				t.Fatalf("expected key to be replaced, got %v %v", replaced, err)
+			}
+
+			old, err := c.GetAndSet("token", []byte("value4"), time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if old == nil || string(old.Value) != "value3" {
+				t.Fatalf("expected old value value3, got %v", old)
+			}
+
+			old, err = c.GetAndDelete("token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(old.Value) != "value4" {
+				t.Fatalf("expected deleted value value4, got %s", old.Value)
+			}
+			if _, err = c.GetAndDelete("token"); !cache.ErrItemNotFound.Is(err) {
+				t.Fatalf("expected ErrItemNotFound, got %v", err)
+			}
+
+			if old, err = c.GetAndSet("token", []byte("value5"), time.Minute); err != nil || old != nil {
+				t.Fatalf("expected no old value, got %v %v", old, err)
+			}
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	var caches = map[string]cache.Cache{
+		"memory":  cache.NewMemoryCache(),
+		"sharded": cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU),
+		"file":    cache.NewFileCache(CACHE_DIR),
+	}
+
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Delete("persistent")
+
+			if _, err := c.Set("persistent", []byte("value"), cache.NoExpiry); err != nil {
+				t.Fatal(err)
+			}
+			if ttl, has := c.Has("persistent"); !has || ttl != cache.NoExpiry {
+				t.Fatalf("expected persistent key, got %s %v", ttl, has)
+			}
+
+			if err := c.Touch("persistent", time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if ttl, _ := c.Has("persistent"); ttl <= 0 || ttl > time.Minute {
+				t.Fatalf("expected ttl of a minute, got %s", ttl)
+			}
+
+			if err := c.Persist("persistent"); err != nil {
+				t.Fatal(err)
+			}
+			var value, ttl, err = c.Get("persistent")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ttl != cache.NoExpiry || string(value) != "value" {
+				t.Fatalf("expected persistent value, got %s %s", value, ttl)
+			}
+
+			if err = c.Expire("persistent", time.Now().Add(-time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			if _, has := c.Has("persistent"); has {
+				t.Fatal("key not expired")
+			}
+			if err = c.Touch("persistent", time.Minute); !cache.ErrItemNotFound.Is(err) {
+				t.Fatalf("expected ErrItemNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidateTag(t *testing.T) {
+	var caches = map[string]func() cache.Cache{
+		"memory":  cache.NewMemoryCache,
+		"sharded": func() cache.Cache { return cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU) },
+		"file":    func() cache.Cache { return cache.NewFileCache(CACHE_DIR) },
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			var c = newCache()
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Clear()
+
+			var sets = []struct {
+				key  string
+				tags []string
+			}{
+				{"fragment1", []string{"user.1"}},
+				{"fragment2", []string{"user.1", "user.2"}},
+				{"fragment3", []string{"user.2"}},
+				{"fragment4", nil},
+			}
+			for _, set := range sets {
+				if _, err := c.Set(set.key, []byte("value"), time.Minute, set.tags...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Overwriting an item replaces its tags.
+			if _, err := c.Set("fragment3", []byte("value"), time.Minute, "user.3"); err != nil {
+				t.Fatal(err)
+			}
+
+			var dump, err = c.Dump()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded = newCache()
+			if err = loaded.Load(dump); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, c := range []cache.Cache{c, loaded} {
+				deleted, err := c.InvalidateTag("user.2")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if deleted != 1 {
+					t.Fatalf("expected 1 item deleted, got %d", deleted)
+				}
+				if _, has := c.Has("fragment2"); has {
+					t.Fatal("tagged item not deleted")
+				}
+				for _, key := range []string{"fragment1", "fragment3", "fragment4"} {
+					if _, has := c.Has(key); !has {
+						t.Fatalf("untagged item deleted %s", key)
+					}
+				}
+
+				entry, err := c.GetEntry("fragment3")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entry.Tags) != 1 || entry.Tags[0] != "user.3" {
+					t.Fatalf("expected tags [user.3], got %v", entry.Tags)
+				}
+
+				// The file cache shares its directory with the loaded cache.
+				if name == "file" {
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestNamespaceDir(t *testing.T) {
+	if dir := cache.NamespaceDir("data", cache.DefaultNamespace); dir != "data" {
+		t.Fatalf("expected the default namespace in the root directory, got %s", dir)
+	}
+	if dir := cache.NamespaceDir("data", "1"); dir != filepath.Join("data", "namespaces", "1") {
+		t.Fatalf("expected a subdirectory, got %s", dir)
+	}
+	for _, namespace := range []string{"", "..", "a/b", strings.Repeat("a", 65)} {
+		if cache.IsValidNamespace(namespace) == nil {
+			t.Fatalf("expected namespace %q to be invalid", namespace)
+		}
+	}
+}
+
+func TestInvalidateExpiredTag(t *testing.T) {
+	var segment, err = cache.NewSegmentCache(t.TempDir(), cache.SyncNever, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer segment.Close()
+	var caches = map[string]cache.Cache{
+		"memory":  cache.NewMemoryCache(),
+		"segment": segment,
+	}
+	for name, c := range caches {
+		t.Run(name, func(t *testing.T) {
+			if _, err := c.Set("expired", []byte("value"), 10*time.Millisecond, "tag"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.Set("live", []byte("value"), time.Minute, "tag"); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(20 * time.Millisecond)
+
+			// The expired item is removed as expired, only the live item is deleted.
+			if deleted, err := c.InvalidateTag("tag"); err != nil || deleted != 1 {
+				t.Fatalf("expected 1 deleted item, got %d %v", deleted, err)
+			}
+			if stats := c.Stats(); stats.Deletes != 1 || stats.Expirations != 1 || stats.Items != 0 {
+				t.Fatalf("expected 1 delete and 1 expiration, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestFileCacheShortTTL(t *testing.T) {
+	var c = cache.NewFileCache(t.TempDir())
+	// Items with a ttl under a second are accepted by every write, like in the other caches.
+	if _, err := c.Set("set", []byte("value"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if set, err := c.SetNX("setnx", []byte("value"), 50*time.Millisecond); err != nil || !set {
+		t.Fatalf("expected the item to be set, got %t %v", set, err)
+	}
+	if _, _, err := c.Get("set"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	for _, key := range []string{"set", "setnx"} {
+		if _, _, err := c.Get(key); !cache.ErrItemNotFound.Is(err) {
+			t.Fatalf("expected %s to expire, got %v", key, err)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	var caches = map[string]func() cache.Cache{
+		"memory":  cache.NewMemoryCache,
+		"sharded": func() cache.Cache { return cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU) },
+		"file":    func() cache.Cache { return cache.NewFileCache(t.TempDir()) },
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			var c = newCache()
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Clear()
+
+			var added, err = c.HSet("profile", map[string][]byte{
+				"name":  []byte("nigel"),
+				"email": []byte("nigel@example.com"),
+			})
+			if err != nil || added != 2 {
+				t.Fatalf("expected 2 fields added, got %d %v", added, err)
+			}
+			if added, err = c.HSet("profile", map[string][]byte{"name": []byte("jane"), "visits": []byte("1")}); err != nil || added != 1 {
+				t.Fatalf("expected 1 field added, got %d %v", added, err)
+			}
+
+			value, err := c.HGet("profile", "name")
+			if err != nil || string(value) != "jane" {
+				t.Fatalf("expected jane, got %s %v", value, err)
+			}
+			if _, err = c.HGet("profile", "missing"); !cache.ErrItemNotFound.Is(err) {
+				t.Fatalf("expected ErrItemNotFound, got %v", err)
+			}
+
+			visits, err := c.HIncrBy("profile", "visits", 41)
+			if err != nil || visits != 42 {
+				t.Fatalf("expected 42 visits, got %d %v", visits, err)
+			}
+			if _, err = c.HIncrBy("profile", "name", 1); !cache.ErrNotInteger.Is(err) {
+				t.Fatalf("expected ErrNotInteger, got %v", err)
+			}
+
+			deleted, err := c.HDel("profile", "email", "missing")
+			if err != nil || deleted != 1 {
+				t.Fatalf("expected 1 field deleted, got %d %v", deleted, err)
+			}
+			if n, err := c.HLen("profile"); err != nil || n != 2 {
+				t.Fatalf("expected 2 fields, got %d %v", n, err)
+			}
+
+			dump, err := c.Dump()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded = newCache()
+			if err = loaded.Load(dump); err != nil {
+				t.Fatal(err)
+			}
+			fields, err := loaded.HGetAll("profile")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fields) != 2 || string(fields["name"]) != "jane" || string(fields["visits"]) != "42" {
+				t.Fatalf("hash not restored: %v", fields)
+			}
+
+			// String commands on a hash, and hash commands on a string, are type errors.
+			if _, _, err = c.Get("profile"); !cache.ErrWrongType.Is(err) {
+				t.Fatalf("expected ErrWrongType, got %v", err)
+			}
+			if _, err = c.Incr("profile", 1, 0, time.Minute); !cache.ErrWrongType.Is(err) {
+				t.Fatalf("expected ErrWrongType, got %v", err)
+			}
+			if _, err = c.Set("string", []byte("value"), time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = c.HSet("string", map[string][]byte{"field": nil}); !cache.ErrWrongType.Is(err) {
+				t.Fatalf("expected ErrWrongType, got %v", err)
+			}
+
+			// Deleting the last field deletes the hash.
+			if _, err = c.HDel("profile", "name", "visits"); err != nil {
+				t.Fatal(err)
+			}
+			if _, has := c.Has("profile"); has {
+				t.Fatal("empty hash not deleted")
+			}
+			if fields, err := c.HGetAll("profile"); err != nil || len(fields) != 0 {
+				t.Fatalf("expected an empty hash, got %v %v", fields, err)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	var caches = map[string]func() cache.Cache{
+		"memory":  cache.NewMemoryCache,
+		"sharded": func() cache.Cache { return cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU) },
+		"file":    func() cache.Cache { return cache.NewFileCache(t.TempDir()) },
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			var c = newCache()
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Clear()
+
+			if n, err := c.RPush("list", []byte("b"), []byte("c")); err != nil || n != 2 {
+				t.Fatalf("expected a length of 2, got %d %v", n, err)
+			}
+			if n, err := c.LPush("list", []byte("a"), []byte("z")); err != nil || n != 4 {
+				t.Fatalf("expected a length of 4, got %d %v", n, err)
+			}
+
+			var expectRange = func(start, stop int, expected string) {
+				t.Helper()
+				var values, err = c.LRange("list", start, stop)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got = make([]string, len(values))
+				for i, v := range values {
+					got[i] = string(v)
+				}
+				if strings.Join(got, ",") != expected {
+					t.Fatalf("expected range %d:%d to be %q, got %q", start, stop, expected, strings.Join(got, ","))
+				}
+			}
+			expectRange(0, -1, "z,a,b,c")
+			expectRange(1, 2, "a,b")
+			expectRange(-2, 10, "b,c")
+			expectRange(3, 1, "")
+
+			if value, err := c.LPop("list"); err != nil || string(value) != "z" {
+				t.Fatalf("expected z, got %s %v", value, err)
+			}
+			if value, err := c.RPop("list"); err != nil || string(value) != "c" {
+				t.Fatalf("expected c, got %s %v", value, err)
+			}
+			if n, err := c.LLen("list"); err != nil || n != 2 {
+				t.Fatalf("expected a length of 2, got %d %v", n, err)
+			}
+
+			var dump, err = c.Dump()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded = newCache()
+			if err = loaded.Load(dump); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := loaded.LLen("list"); err != nil || n != 2 {
+				t.Fatalf("list not restored: %d %v", n, err)
+			}
+
+			if _, _, err := c.Get("list"); !cache.ErrWrongType.Is(err) {
+				t.Fatalf("expected ErrWrongType, got %v", err)
+			}
+
+			// Popping the last value deletes the list.
+			c.LPop("list")
+			c.LPop("list")
+			if _, has := c.Has("list"); has {
+				t.Fatal("empty list not deleted")
+			}
+			if _, err := c.RPop("list"); !cache.ErrItemNotFound.Is(err) {
+				t.Fatalf("expected ErrItemNotFound, got %v", err)
+			}
+
+			// Blocking pops time out on an empty list.
+			var start = time.Now()
+			if _, err := c.BLPop("list", 50*time.Millisecond); !cache.ErrItemNotFound.Is(err) {
+				t.Fatalf("expected ErrItemNotFound, got %v", err)
+			}
+			if time.Since(start) < 50*time.Millisecond {
+				t.Fatal("blocking pop returned before the timeout")
+			}
+
+			// Waiting clients are served in the order they started waiting.
+			const waiters = 3
+			var popped = make([]chan string, waiters)
+			for i := range popped {
+				popped[i] = make(chan string, 1)
+				go func(i int) {
+					var value, err = c.BRPop("list", 5*time.Second)
+					if err != nil {
+						value = []byte(err.Error())
+					}
+					popped[i] <- string(value)
+				}(i)
+				// Wait for the client to block before the next one starts.
+				time.Sleep(20 * time.Millisecond)
+			}
+			if _, err := c.RPush("list", []byte("0"), []byte("1"), []byte("2")); err != nil {
+				t.Fatal(err)
+			}
+			for i, values := range popped {
+				select {
+				case value := <-values:
+					if value != strconv.Itoa(2-i) {
+						t.Fatalf("expected waiter %d to pop %d, got %s", i, 2-i, value)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("waiter %d was not served", i)
+				}
+			}
+			if n, err := c.LLen("list"); err != nil || n != 0 {
+				t.Fatalf("expected the pushed values to be popped, got a length of %d %v", n, err)
+			}
+		})
+	}
+}
+
+func TestBlockingPopFailedPush(t *testing.T) {
+	var c = cache.NewBoundedMemoryCache(0, 256, cache.EvictLRU)
+	var popped = make(chan string, 1)
+	go func() {
+		var value, err = c.BLPop("list", 5*time.Second)
+		if err != nil {
+			value = []byte(err.Error())
+		}
+		popped <- string(value)
+	}()
+	// Wait for the client to block.
+	time.Sleep(20 * time.Millisecond)
+
+	// The remaining list is too large to store, so the waiter must not receive a value.
+	var large = make([]byte, 512)
+	if _, err := c.RPush("list", []byte("lost"), large); !cache.ErrItemTooLarge.Is(err) {
+		t.Fatalf("expected ErrItemTooLarge, got %v", err)
+	}
+	select {
+	case value := <-popped:
+		t.Fatalf("waiter received %q from a list which was not stored", value)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := c.RPush("list", []byte("stored")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case value := <-popped:
+		if value != "stored" {
+			t.Fatalf("expected stored, got %s", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not served")
+	}
+}
+
+func TestSet(t *testing.T) {
+	var caches = map[string]func() cache.Cache{
+		"memory":  cache.NewMemoryCache,
+		"sharded": func() cache.Cache { return cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU) },
+		"file":    func() cache.Cache { return cache.NewFileCache(t.TempDir()) },
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			var c = newCache()
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Clear()
+
+			if added, err := c.SAdd("visitors.mon", "alice", "bob", "alice"); err != nil || added != 2 {
+				t.Fatalf("expected 2 members added, got %d %v", added, err)
+			}
+			if added, err := c.SAdd("visitors.tue", "bob", "carol"); err != nil || added != 2 {
+				t.Fatalf("expected 2 members added, got %d %v", added, err)
+			}
+			if ok, err := c.SIsMember("visitors.mon", "bob"); err != nil || !ok {
+				t.Fatalf("expected bob to be a member, got %v %v", ok, err)
+			}
+			if ok, err := c.SIsMember("visitors.mon", "carol"); err != nil || ok {
+				t.Fatalf("expected carol not to be a member, got %v %v", ok, err)
+			}
+
+			var expectMembers = func(members []string, err error, expected string) {
+				t.Helper()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.Join(members, ",") != expected {
+					t.Fatalf("expected members %q, got %q", expected, strings.Join(members, ","))
+				}
+			}
+			var members, err = c.SMembers("visitors.mon")
+			expectMembers(members, err, "alice,bob")
+			members, err = c.SInter("visitors.mon", "visitors.tue")
+			expectMembers(members, err, "bob")
+			members, err = c.SUnion("visitors.mon", "visitors.tue", "missing")
+			expectMembers(members, err, "alice,bob,carol")
+			members, err = c.SInter("visitors.mon", "missing")
+			expectMembers(members, err, "")
+
+			dump, err := c.Dump()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded = newCache()
+			if err = loaded.Load(dump); err != nil {
+				t.Fatal(err)
+			}
+			members, err = loaded.SMembers("visitors.tue")
+			expectMembers(members, err, "bob,carol")
+
+			if _, _, err = c.Get("visitors.mon"); !cache.ErrWrongType.Is(err) {
+				t.Fatalf("expected ErrWrongType, got %v", err)
+			}
+
+			// Removing the last member deletes the set.
+			if removed, err := c.SRem("visitors.mon", "alice", "bob", "dave"); err != nil || removed != 2 {
+				t.Fatalf("expected 2 members removed, got %d %v", removed, err)
+			}
+			if _, has := c.Has("visitors.mon"); has {
+				t.Fatal("empty set not deleted")
+			}
+		})
+	}
+}
+
+func TestSortedSet(t *testing.T) {
+	var caches = map[string]func() cache.Cache{
+		"memory":  cache.NewMemoryCache,
+		"sharded": func() cache.Cache { return cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU) },
+		"file":    func() cache.Cache { return cache.NewFileCache(t.TempDir()) },
+	}
+
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			var c = newCache()
+			c.Run(time.Minute)
+			defer c.Close()
+			defer c.Clear()
+
+			var added, err = c.ZAdd("leaderboard",
+				cache.ScoredMember{Member: "alice", Score: 30},
+				cache.ScoredMember{Member: "bob", Score: 10},
+				cache.ScoredMember{Member: "carol", Score: 20},
+			)
+			if err != nil || added != 3 {
+				t.Fatalf("expected 3 members added, got %d %v", added, err)
+			}
+			if added, err = c.ZAdd("leaderboard", cache.ScoredMember{Member: "bob", Score: 40}, cache.ScoredMember{Member: "dave", Score: 20}); err != nil || added != 1 {
+				t.Fatalf("expected 1 member added, got %d %v", added, err)
+			}
+			score, err := c.ZIncrBy("leaderboard", "carol", 2.5)
+			if err != nil || score != 22.5 {
+				t.Fatalf("expected a score of 22.5, got %v %v", score, err)
+			}
+
+			var expectMembers = func(members []cache.ScoredMember, err error, expected string) {
+				t.Helper()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got = make([]string, len(members))
+				for i, m := range members {
+					got[i] = m.Member + "=" + strconv.FormatFloat(m.Score, 'g', -1, 64)
+				}
+				if strings.Join(got, ",") != expected {
+					t.Fatalf("expected members %q, got %q", expected, strings.Join(got, ","))
+				}
+			}
+			var members []cache.ScoredMember
+			members, err = c.ZRange("leaderboard", 0, -1)
+			expectMembers(members, err, "dave=20,carol=22.5,alice=30,bob=40")
+			members, err = c.ZRange("leaderboard", -2, -1)
+			expectMembers(members, err, "alice=30,bob=40")
+			members, err = c.ZRangeByScore("leaderboard", 20, 30)
+			expectMembers(members, err, "dave=20,carol=22.5,alice=30")
+			members, err = c.ZRangeByScore("leaderboard", math.Inf(-1), 21)
+			expectMembers(members, err, "dave=20")
+			members, err = c.ZRangeByScore("leaderboard", 50, 40)
+			expectMembers(members, err, "")
+
+			dump, err := c.Dump()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var loaded = newCache()
+			if err = loaded.Load(dump); err != nil {
+				t.Fatal(err)
+			}
+			members, err = loaded.ZRange("leaderboard", 0, -1)
+			expectMembers(members, err, "dave=20,carol=22.5,alice=30,bob=40")
+
+			if _, err = c.ZIncrBy("leaderboard", "alice", math.NaN()); !cache.ErrNotFloat.Is(err) {
+				t.Fatalf("expected ErrNotFloat, got %v", err)
+			}
+			if _, err = c.SAdd("leaderboard", "alice"); !cache.ErrWrongType.Is(err) {
+				t.Fatalf("expected ErrWrongType, got %v", err)
+			}
+
+			removed, err := c.ZRemRangeByRank("leaderboard", 0, 0)
+			if err != nil || removed != 1 {
+				t.Fatalf("expected 1 member removed, got %d %v", removed, err)
+			}
+			if removed, err = c.ZRemRangeByScore("leaderboard", 25, math.Inf(1)); err != nil || removed != 2 {
+				t.Fatalf("expected 2 members removed, got %d %v", removed, err)
+			}
+			members, err = c.ZRange("leaderboard", 0, -1)
+			expectMembers(members, err, "carol=22.5")
+
+			// Removing the last member deletes the sorted set.
+			if removed, err = c.ZRemRangeByRank("leaderboard", 0, -1); err != nil || removed != 1 {
+				t.Fatalf("expected 1 member removed, got %d %v", removed, err)
+			}
+			if _, has := c.Has("leaderboard"); has {
+				t.Fatal("empty sorted set not deleted")
+			}
+		})
+	}
+}
+
+func TestLoggedCache(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "appendonly.netcache")
+	var open = func() *cache.LoggedCache {
+		t.Helper()
+		var c, err = cache.NewLoggedCache(cache.NewMemoryCache(), path, cache.SyncAlways, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Run(time.Minute)
+		return c
+	}
+
+	var c = open()
+	for i := 0; i < 100; i++ {
+		if _, err := c.Set("overwritten", []byte(strconv.Itoa(i)), cache.NoExpiry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Set("tagged", []byte("value"), cache.NoExpiry, "group")
+	c.Set("deleted", []byte("value"), cache.NoExpiry)
+	c.Set("expiring", []byte("value"), time.Hour)
+	c.Set("expired", []byte("value"), time.Hour)
+	c.Delete("deleted")
+	c.InvalidateTag("group")
+	c.Persist("expiring")
+	c.Expire("expired", time.Now().Add(50*time.Millisecond))
+	c.Incr("counter", 2, 40, cache.NoExpiry)
+	c.HSet("hash", map[string][]byte{"field": []byte("value")})
+	c.RPush("list", []byte("a"), []byte("b"), []byte("c"))
+	c.LPop("list")
+	c.ZAdd("zset", cache.ScoredMember{Member: "alice", Score: 1})
+	c.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	var expectState = func(c cache.Cache) {
+		t.Helper()
+		if value, _, err := c.Get("overwritten"); err != nil || string(value) != "99" {
+			t.Fatalf("expected 99, got %s %v", value, err)
+		}
+		for _, key := range []string{"tagged", "deleted", "expired"} {
+			if _, has := c.Has(key); has {
+				t.Fatalf("expected %s to be gone", key)
+			}
+		}
+		if ttl, has := c.Has("expiring"); !has || ttl != cache.NoExpiry {
+			t.Fatalf("expected expiring to be persistent, got %v %v", ttl, has)
+		}
+		if value, _, err := c.Get("counter"); err != nil || string(value) != "42" {
+			t.Fatalf("expected 42, got %s %v", value, err)
+		}
+		if value, err := c.HGet("hash", "field"); err != nil || string(value) != "value" {
+			t.Fatalf("expected value, got %s %v", value, err)
+		}
+		if values, err := c.LRange("list", 0, -1); err != nil || len(values) != 2 || string(values[0]) != "b" {
+			t.Fatalf("expected [b c], got %s %v", values, err)
+		}
+		if members, err := c.ZRange("zset", 0, -1); err != nil || len(members) != 1 {
+			t.Fatalf("expected 1 member, got %v %v", members, err)
+		}
+	}
+
+	c = open()
+	expectState(c)
+
+	// Rewriting the log keeps only the current items.
+	var before, _ = os.Stat(path)
+	if err := c.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	var after, _ = os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Fatalf("expected the log to shrink, got %d >= %d", after.Size(), before.Size())
+	}
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	c.Set("after.clear", []byte("value"), cache.NoExpiry)
+	c.Close()
+
+	// A partially written record at the end of the log is cut off.
+	var f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{100, 1, 2, 3})
+	f.Close()
+
+	loaded, err := cache.NewLoggedCache(cache.NewMemoryCache(), path, cache.SyncAlways, -1)
+	if !cache.IsIntegrityError(err) {
+		t.Fatalf("expected an integrity error, got %v", err)
+	}
+	defer loaded.Close()
+	if loaded.Len() != 1 {
+		t.Fatalf("expected 1 item after the clear, got %v", loaded.Keys())
+	}
+	if _, err = loaded.Set("appended", []byte("value"), cache.NoExpiry); err != nil {
+		t.Fatal(err)
+	}
+	if reopened, err := cache.NewLoggedCache(cache.NewMemoryCache(), path, cache.SyncNever, -1); err != nil || reopened.Len() != 2 {
+		t.Fatalf("expected 2 items in the repaired log, got %v", err)
+	}
+}
+
+func TestLoggedCacheCorruptRecord(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "appendonly.netcache")
+	var c, err = cache.NewLoggedCache(cache.NewMemoryCache(), path, cache.SyncAlways, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("first", []byte("value"), cache.NoExpiry)
+	var first, _ = os.Stat(path)
+	c.Set("second", []byte("value"), cache.NoExpiry)
+	c.Set("third", []byte("value"), cache.NoExpiry)
+	c.Close()
+
+	// Flip a byte in the value of the second record.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corrupt = append([]byte(nil), data...)
+	corrupt[first.Size()+10] ^= 0xff
+	if err = os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The records after the corrupt record are not cut off.
+	if _, err = cache.NewLoggedCache(cache.NewMemoryCache(), path, cache.SyncAlways, -1); !errors.Is(err, cache.ErrCorruptValue) {
+		t.Fatalf("expected ErrCorruptValue, got %v", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, corrupt) {
+		t.Fatal("expected the log to be left as it is")
+	}
+
+	// A corrupt record at the end of the log is cut off.
+	corrupt = append([]byte(nil), data...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	if err = os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := cache.NewLoggedCache(cache.NewMemoryCache(), path, cache.SyncAlways, -1)
+	if !cache.IsIntegrityError(err) {
+		t.Fatalf("expected an integrity error, got %v", err)
+	}
+	defer loaded.Close()
+	if loaded.Len() != 2 {
+		t.Fatalf("expected 2 items, got %v", loaded.Keys())
+	}
+}
+
+func TestLoggedCacheBackgroundRewrite(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "appendonly.netcache")
+	var c, err = cache.NewLoggedCache(cache.NewShardedMemoryCache(4, 0, 0, cache.EvictLRU), path, cache.SyncNever, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Run(time.Minute)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				c.Incr("counter"+strconv.Itoa(w), 1, 0, cache.NoExpiry)
+			}
+		}(w)
+	}
+	wg.Wait()
+	c.Close()
+
+	// Changes made while the log was rewritten are kept.
+	reopened, err := cache.NewLoggedCache(cache.NewMemoryCache(), path, cache.SyncNever, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for w := 0; w < 4; w++ {
+		if value, _, err := reopened.Get("counter" + strconv.Itoa(w)); err != nil || string(value) != "500" {
+			t.Fatalf("expected 500, got %s %v", value, err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// A copy of an item stored in the cache.
+type Entry struct {
+	// The value of the item.
+	Value []byte
+	// The time at which the item expires.
+	Expires time.Time
+	// The version of the item, a new version is assigned every time the item is written.
+	Version uint64
+	// The tags of the item, used to invalidate groups of items.
+	Tags []string
+	// The type of the value of the item.
+	Type ValueType
+}
+
+// Returns the remaining TTL of the entry, or NoExpiry if it never expires.
+func (e *Entry) TTL() time.Duration {
+	return ttlUntil(e.Expires)
+}
+
+// A cache which can atomically update its items.
+//
+// The commands shared by the caches are built on top of it.
+type store interface {
+	// Atomically replace the item stored under the key with the entry returned by fn.
+	//
+	// fn receives nil if the key does not exist or has expired, it must not modify the entry's value in place.
+	// If fn returns an error, the item is left untouched and the error is returned.
+	// If fn returns a nil entry, the item is deleted.
+	//
+	// The version assigned to the stored item is set on the entry returned by fn.
+	update(key string, fn func(e *Entry) (*Entry, error)) error
+	// Get a copy of an item, returns ErrItemNotFound if the key does not exist or has expired.
+	GetEntry(key string) (*Entry, error)
+}
+
+// Returned by an update function to leave the item untouched without failing the command.
+var errSkipUpdate = errors.New("skip update")
+
+// The commands shared by the caches.
+//
+// Every cache embeds the commands, which are executed atomically by the store of the cache.
+type commands struct {
+	store store
+	// The clients blocked on popping from a list.
+	waiters *listWaiters
+}
+
+func newCommands(store store) commands {
+	return commands{
+		store:   store,
+		waiters: &listWaiters{queues: make(map[string][]*listWaiter)},
+	}
+}
+
+// Apply an update to the key, an update function returning errSkipUpdate leaves the item untouched.
+func (c commands) update(key string, fn func(e *Entry) (*Entry, error)) error {
+	var err = c.store.update(key, fn)
+	if err == errSkipUpdate {
+		return nil
+	}
+	return err
+}
+
+// Store a copy of an entry under the key, including its type, expiry and tags.
+//
+// A new version is assigned to the stored item, an entry which has already expired deletes the key.
+// Used to restore items from a log or snapshot, and to copy items between caches.
+func (c commands) SetEntry(key string, e *Entry) error {
+	return c.update(key, func(*Entry) (*Entry, error) {
+		if expiredAt(e.Expires, time.Now()) {
+			return nil, nil
+		}
+		return &Entry{
+			Value:   e.Value,
+			Expires: e.Expires,
+			Tags:    e.Tags,
+			Type:    e.Type,
+		}, nil
+	})
+}
+
+// Atomically add delta to the integer stored under the key, returning the new value.
+//
+// A negative delta decrements the integer.
+// If the key does not exist, it is created with the initial value and ttl before delta is added.
+func (c commands) Incr(key string, delta int64, initial int64, ttl time.Duration) (value int64, err error) {
+	err = c.update(key, func(e *Entry) (*Entry, error) {
+		if e == nil {
+			e = &Entry{Expires: expiresAt(ttl)}
+			value = initial
+		} else if e.Type != StringValue {
+			return nil, ErrWrongType
+		} else {
+			var err error
+			if value, err = strconv.ParseInt(string(e.Value), 10, 64); err != nil {
+				return nil, ErrNotInteger
+			}
+		}
+		if (delta > 0 && value > math.MaxInt64-delta) || (delta < 0 && value < math.MinInt64-delta) {
+			return nil, ErrIntegerOverflow
+		}
+		value += delta
+		e.Value = strconv.AppendInt(nil, value, 10)
+		return e, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// Set the value of the key, but only if the version of the stored item matches the given version.
+//
+// A version of zero only matches if the key does not exist.
+// Returns ErrVersionMismatch if the versions do not match, otherwise the version of the new item.
+func (c commands) CompareAndSwap(key string, value []byte, ttl time.Duration, version uint64) (newVersion uint64, err error) {
+	var stored = &Entry{
+		Value:   value,
+		Expires: expiresAt(ttl),
+	}
+	err = c.update(key, func(e *Entry) (*Entry, error) {
+		if (e == nil && version != 0) || (e != nil && e.Version != version) {
+			return nil, ErrVersionMismatch
+		}
+		return stored, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return stored.Version, nil
+}
+
+// Set the value of the key, but only if the key does not exist.
+//
+// Reports whether the value was set.
+func (c commands) SetNX(key string, value []byte, ttl time.Duration) (set bool, err error) {
+	err = c.update(key, func(e *Entry) (*Entry, error) {
+		if e != nil {
+			return nil, errSkipUpdate
+		}
+		set = true
+		return &Entry{Value: value, Expires: expiresAt(ttl)}, nil
+	})
+	return set && err == nil, err
+}
+
+// Set the value of the key, but only if the key already exists.
+//
+// Reports whether the value was replaced.
+func (c commands) Replace(key string, value []byte, ttl time.Duration) (replaced bool, err error) {
+	err = c.update(key, func(e *Entry) (*Entry, error) {
+		if e == nil {
+			return nil, errSkipUpdate
+		}
+		replaced = true
+		return &Entry{Value: value, Expires: expiresAt(ttl)}, nil
+	})
+	return replaced && err == nil, err
+}
+
+// Set the value of the key, returning the item it replaced.
+//
+// The returned entry is nil if the key did not exist.
+// Returns ErrWrongType if the replaced item is not a string.
+func (c commands) GetAndSet(key string, value []byte, ttl time.Duration) (old *Entry, err error) {
+	err = c.update(key, func(e *Entry) (*Entry, error) {
+		if err := checkType(e, StringValue); err != nil {
+			return nil, err
+		}
+		old = e
+		return &Entry{Value: value, Expires: expiresAt(ttl)}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// Delete the key, returning the deleted item.
+//
+// Returns ErrItemNotFound if the key does not exist, or ErrWrongType if the item is not a string.
+func (c commands) GetAndDelete(key string) (old *Entry, err error) {
+	err = c.update(key, func(e *Entry) (*Entry, error) {
+		if e == nil {
+			return nil, ErrItemNotFound
+		}
+		if e.Type != StringValue {
+			return nil, ErrWrongType
+		}
+		old = e
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// Set a new TTL for the key, relative to now.
+//
+// A TTL of NoExpiry makes the key persistent.
+// Returns ErrItemNotFound if the key does not exist.
+func (c commands) Touch(key string, ttl time.Duration) error {
+	return c.Expire(key, expiresAt(ttl))
+}
+
+// Set the time at which the key expires.
+//
+// A zero time makes the key persistent, a time in the past deletes the key.
+// Returns ErrItemNotFound if the key does not exist.
+func (c commands) Expire(key string, at time.Time) error {
+	return c.update(key, func(e *Entry) (*Entry, error) {
+		if e == nil {
+			return nil, ErrItemNotFound
+		}
+		if expiredAt(at, time.Now()) {
+			return nil, nil
+		}
+		e.Expires = at
+		return e, nil
+	})
+}
+
+// Make the key persistent, so it never expires.
+//
+// Returns ErrItemNotFound if the key does not exist.
+func (c commands) Persist(key string) error {
+	return c.Expire(key, time.Time{})
+}
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// The size in bytes above which values are compressed, if no threshold is given.
+const DefaultCompressionThreshold = 1024
+
+// Statistics of the values compressed by a cache.
+type CompressionStats struct {
+	// The amount of values which were stored compressed.
+	Values int64
+	// The size of those values before and after compression.
+	OriginalBytes   int64
+	CompressedBytes int64
+}
+
+// Returns the ratio of the original size to the compressed size of the compressed values.
+//
+// Returns 1 if no values were compressed.
+func (s CompressionStats) Ratio() float64 {
+	if s.CompressedBytes == 0 {
+		return 1
+	}
+	return float64(s.OriginalBytes) / float64(s.CompressedBytes)
+}
+
+// A cache which compresses the values of the items stored in another cache.
+//
+// Values larger than the threshold are compressed with flate, and the type of the item is marked as compressed.
+// Values which do not get smaller are stored as they are.
+// Items are decompressed when they are read, so the commands of every type work on compressed items.
+//
+// The cache it wraps stores the compressed items with the compressed flag in their type,
+// so it can only read them through a compressed cache. Dumps hold the decompressed values, they can be loaded by any cache.
+type CompressedCache struct {
+	commands
+
+	cache     Cache
+	store     store
+	threshold int
+
+	values          atomic.Int64
+	originalBytes   atomic.Int64
+	compressedBytes atomic.Int64
+}
+
+// Returns a cache which compresses values larger than the threshold before storing them in the cache.
+//
+// A threshold <= 0 uses DefaultCompressionThreshold.
+// Returns ErrNotAtomic if the cache cannot update its items atomically, like a cache wrapped by a LoggedCache.
+func NewCompressedCache(c Cache, threshold int) (*CompressedCache, error) {
+	var s, ok = c.(store)
+	if !ok {
+		return nil, ErrNotAtomic
+	}
+	if threshold <= 0 {
+		threshold = DefaultCompressionThreshold
+	}
+	var cc = &CompressedCache{
+		cache:     c,
+		store:     s,
+		threshold: threshold,
+	}
+	cc.commands = newCommands(cc)
+	return cc, nil
+}
+
+// Returns the statistics of the values compressed since the cache was created.
+func (c *CompressedCache) CompressionStats() CompressionStats {
+	return CompressionStats{
+		Values:          c.values.Load(),
+		OriginalBytes:   c.originalBytes.Load(),
+		CompressedBytes: c.compressedBytes.Load(),
+	}
+}
+
+// Returns a copy of the entry with its value compressed, if the value is larger than the threshold.
+//
+// Entries which are already compressed are returned as they are.
+func (c *CompressedCache) compress(e *Entry) (*Entry, error) {
+	if len(e.Value) <= c.threshold || e.Type&compressedFlag != 0 {
+		return e, nil
+	}
+	var buf bytes.Buffer
+	var w, err = flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(e.Value); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(e.Value) {
+		return e, nil
+	}
+	c.values.Add(1)
+	c.originalBytes.Add(int64(len(e.Value)))
+	c.compressedBytes.Add(int64(buf.Len()))
+
+	var compressed = *e
+	compressed.Value = buf.Bytes()
+	compressed.Type |= compressedFlag
+	return &compressed, nil
+}
+
+// Returns a copy of the entry with its value decompressed, if the item is marked as compressed.
+func decompress(e *Entry) (*Entry, error) {
+	if e == nil || e.Type&compressedFlag == 0 {
+		return e, nil
+	}
+	var value, err = io.ReadAll(flate.NewReader(bytes.NewReader(e.Value)))
+	if err != nil {
+		return nil, ErrCorruptValue
+	}
+	var decompressed = *e
+	decompressed.Value = value
+	decompressed.Type &^= compressedFlag
+	return &decompressed, nil
+}
+
+// Atomically update an item, the update function receives and returns decompressed entries.
+func (c *CompressedCache) update(key string, fn func(e *Entry) (*Entry, error)) error {
+	var updated, stored *Entry
+	var err = c.store.update(key, func(e *Entry) (*Entry, error) {
+		var err error
+		if e, err = decompress(e); err != nil {
+			return nil, err
+		}
+		if updated, err = fn(e); err != nil || updated == nil {
+			return nil, err
+		}
+		stored, err = c.compress(updated)
+		return stored, err
+	})
+	if err != nil {
+		return err
+	}
+	// The cache sets the version of the entry it stored, which may be a compressed copy.
+	if updated != nil && stored != nil {
+		updated.Version = stored.Version
+	}
+	return nil
+}
+
+// Set an item in the cache, the item can be invalidated by any of its tags.
+func (c *CompressedCache) Set(key string, value []byte, ttl time.Duration, tags ...string) (inserted bool, err error) {
+	var e = &Entry{
+		Value:   value,
+		Expires: expiresAt(ttl),
+		Tags:    tags,
+	}
+	err = c.update(key, func(*Entry) (*Entry, error) {
+		return e, nil
+	})
+	return err == nil, err
+}
+
+// Get an item from the cache.
+//
+// Returns ErrWrongType if the item is not a string.
+func (c *CompressedCache) Get(key string) (value []byte, ttl time.Duration, err error) {
+	var e *Entry
+	e, err = c.GetEntry(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if e.Type != StringValue {
+		countWrongType(c.cache, key)
+		return nil, 0, ErrWrongType
+	}
+	return e.Value, e.TTL(), nil
+}
+
+// Get a copy of an item from the cache, including its metadata.
+func (c *CompressedCache) GetEntry(key string) (*Entry, error) {
+	var e, err = c.store.GetEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(e)
+}
+
+// Get a copy of an item without counting the read.
+func (c *CompressedCache) peekEntry(key string) (*Entry, error) {
+	var e, err = peekEntry(c.cache, key)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(e)
+}
+
+func (c *CompressedCache) countWrongType(key string) {
+	countWrongType(c.cache, key)
+}
+
+// Returns the statistics of the cache, including the statistics of the compressed values.
+func (c *CompressedCache) Stats() Stats {
+	var stats = c.cache.Stats()
+	stats.Compression = c.CompressionStats()
+	return stats
+}
+
+func (c *CompressedCache) Run(interval time.Duration) {
+	c.cache.Run(interval)
+}
+
+func (c *CompressedCache) Delete(key string) (deleted bool, err error) {
+	return c.cache.Delete(key)
+}
+
+func (c *CompressedCache) Clear() (err error) {
+	return c.cache.Clear()
+}
+
+func (c *CompressedCache) InvalidateTag(tag string) (deleted int, err error) {
+	return c.cache.InvalidateTag(tag)
+}
+
+func (c *CompressedCache) Keys() []string {
+	return c.cache.Keys()
+}
+
+func (c *CompressedCache) Scan(cursor string, match string, count int) (keys []string, next string, err error) {
+	return c.cache.Scan(cursor, match, count)
+}
+
+func (c *CompressedCache) Close() {
+	c.cache.Close()
+}
+
+func (c *CompressedCache) Len() int {
+	return c.cache.Len()
+}
+
+func (c *CompressedCache) Has(key string) (ttl time.Duration, has bool) {
+	return c.cache.Has(key)
+}
+
+// Dump the cache to bytes, the values are decompressed so the dump can be loaded by any cache.
+func (c *CompressedCache) Dump() ([]byte, error) {
+	var data, err = c.cache.Dump()
+	if err != nil || !isSnapshot(data) {
+		return data, err
+	}
+	var w = newSnapshotWriter()
+	err = readSnapshot(data, func(key string, e *Entry) error {
+		var decompressed, err = decompress(e)
+		if err != nil {
+			return err
+		}
+		w.add(key, decompressed)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w.bytes(), nil
+}
+
+// Load the cache from bytes, the values are compressed the next time they are written.
+func (c *CompressedCache) Load(data []byte) error {
+	return c.cache.Load(data)
+}
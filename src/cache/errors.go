@@ -1,65 +1,99 @@
-package cache
-
-import (
-	"bytes"
-	"fmt"
-)
-
-type errorType int
-
-const (
-	ErrNotError errorType = iota
-	ErrItemNotFound
-	ErrCacheAlreadyRunning
-)
-
-var errMap = map[errorType]string{
-	ErrNotError:            "not a valid error",
-	ErrItemNotFound:        "item not found",
-	ErrCacheAlreadyRunning: "cache already running",
-}
-
-func (e errorType) Error() string {
-	return errMap[e]
-}
-
-func (e errorType) Is(target error) bool {
-	t, ok := target.(errorType)
-	if !ok {
-		return false
-	}
-	return t == e
-}
-
-type integrityError struct {
-	Errors []error
-}
-
-func NewIntegrityError(errs []error) error {
-	if len(errs) == 0 {
-		return nil
-	}
-	return &integrityError{
-		Errors: errs,
-	}
-}
-
-func (e *integrityError) Error() string {
-	if len(e.Errors) == 0 {
-		return ""
-	}
-	var errStrBuf bytes.Buffer
-	errStrBuf.WriteString("Integrity errors have occurred:\n")
-	for _, err := range e.Errors {
-		errStrBuf.WriteString(fmt.Sprintf("\t%s\n", err))
-	}
-	return errStrBuf.String()
-}
-
-func IsIntegrityError(err error) bool {
-	if err == nil {
-		return false
-	}
-	var _, ok = err.(*integrityError)
-	return ok
-}
+package cache
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type errorType int
+
+const (
+	ErrNotError errorType = iota
+	ErrItemNotFound
+	ErrCacheAlreadyRunning
+	ErrItemTooLarge
+	ErrNotInteger
+	ErrIntegerOverflow
+	ErrNotBytes
+	ErrVersionMismatch
+	ErrWrongType
+	ErrCorruptValue
+	ErrNotFloat
+	ErrCorruptSnapshot
+	ErrNotAtomic
+	ErrWrongKey
+)
+
+var errMap = map[errorType]string{
+	ErrNotError:            "not a valid error",
+	ErrItemNotFound:        "item not found",
+	ErrCacheAlreadyRunning: "cache already running",
+	ErrItemTooLarge:        "item too large",
+	ErrNotInteger:          "value is not an integer",
+	ErrIntegerOverflow:     "increment would overflow",
+	ErrNotBytes:            "value is not a byte slice",
+	ErrVersionMismatch:     "version mismatch",
+	ErrWrongType:           "operation against a key holding the wrong type of value",
+	ErrCorruptValue:        "value is corrupt",
+	ErrNotFloat:            "value is not a valid float",
+	ErrCorruptSnapshot:     "snapshot is corrupt",
+	ErrNotAtomic:           "cache does not support atomic updates",
+	ErrWrongKey:            "data is encrypted with an unknown key",
+}
+
+func (e errorType) Error() string {
+	return errMap[e]
+}
+
+// Look up the error with the given message.
+//
+// Used to turn error messages received from a server back into errors.
+func LookupError(message string) (error, bool) {
+	for e, msg := range errMap {
+		if e != ErrNotError && msg == message {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+func (e errorType) Is(target error) bool {
+	t, ok := target.(errorType)
+	if !ok {
+		return false
+	}
+	return t == e
+}
+
+type integrityError struct {
+	Errors []error
+}
+
+func NewIntegrityError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return &integrityError{
+		Errors: errs,
+	}
+}
+
+func (e *integrityError) Error() string {
+	if len(e.Errors) == 0 {
+		return ""
+	}
+	var errStrBuf bytes.Buffer
+	errStrBuf.WriteString("Integrity errors have occurred:\n")
+	for _, err := range e.Errors {
+		errStrBuf.WriteString(fmt.Sprintf("\t%s\n", err))
+	}
+	return errStrBuf.String()
+}
+
+func IsIntegrityError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var _, ok = err.(*integrityError)
+	return ok
+}
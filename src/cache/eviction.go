@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"strings"
+)
+
+// The policy used to decide which item to remove from a bounded cache.
+type EvictionPolicy int
+
+const (
+	// Evict the least recently used item.
+	EvictLRU EvictionPolicy = iota
+	// Evict the least frequently used item.
+	EvictLFU
+	// Evict the oldest item.
+	EvictFIFO
+)
+
+var evictionPolicyMap = map[EvictionPolicy]string{
+	EvictLRU:  "LRU",
+	EvictLFU:  "LFU",
+	EvictFIFO: "FIFO",
+}
+
+func (p EvictionPolicy) String() string {
+	return evictionPolicyMap[p]
+}
+
+// Parse an eviction policy from a string, case insensitive.
+func EvictionPolicyFromString(policy string) (EvictionPolicy, error) {
+	for p, name := range evictionPolicyMap {
+		if strings.EqualFold(name, policy) {
+			return p, nil
+		}
+	}
+	return EvictLRU, fmt.Errorf("unknown eviction policy '%s'", policy)
+}
+
+// Keeps track of the keys in a bounded cache,
+// and decides which key should be evicted next.
+type evictor interface {
+	// Called when a key is inserted or overwritten.
+	add(key string)
+	// Called when a key is read.
+	access(key string)
+	// Called when a key is removed from the cache.
+	remove(key string)
+	// Returns the next key to evict, never returning skip.
+	victim(skip string) (key string, ok bool)
+	// Forget all keys.
+	clear()
+}
+
+func newEvictor(policy EvictionPolicy) evictor {
+	switch policy {
+	case EvictLFU:
+		return newLFUEvictor()
+	case EvictFIFO:
+		return newListEvictor(false)
+	default:
+		return newListEvictor(true)
+	}
+}
+
+// A list based evictor.
+//
+// The front of the list holds the newest (or most recently used) key,
+// the back holds the next key to evict.
+type listEvictor struct {
+	list         *list.List
+	elements     map[string]*list.Element
+	moveOnAccess bool
+}
+
+func newListEvictor(moveOnAccess bool) *listEvictor {
+	return &listEvictor{
+		list:         list.New(),
+		elements:     make(map[string]*list.Element),
+		moveOnAccess: moveOnAccess,
+	}
+}
+
+func (e *listEvictor) add(key string) {
+	if elem, ok := e.elements[key]; ok {
+		if e.moveOnAccess {
+			e.list.MoveToFront(elem)
+		}
+		return
+	}
+	e.elements[key] = e.list.PushFront(key)
+}
+
+func (e *listEvictor) access(key string) {
+	if !e.moveOnAccess {
+		return
+	}
+	if elem, ok := e.elements[key]; ok {
+		e.list.MoveToFront(elem)
+	}
+}
+
+func (e *listEvictor) remove(key string) {
+	if elem, ok := e.elements[key]; ok {
+		e.list.Remove(elem)
+		delete(e.elements, key)
+	}
+}
+
+func (e *listEvictor) victim(skip string) (string, bool) {
+	for elem := e.list.Back(); elem != nil; elem = elem.Prev() {
+		if key := elem.Value.(string); key != skip {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (e *listEvictor) clear() {
+	e.list.Init()
+	e.elements = make(map[string]*list.Element)
+}
+
+type lfuEntry struct {
+	key   string
+	hits  uint64
+	seq   uint64
+	index int
+}
+
+// A min-heap of keys, ordered by their hit count.
+//
+// Ties are broken by the sequence of the last access, evicting the oldest key first.
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].hits == h[j].hits {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].hits < h[j].hits
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	var entry = x.(*lfuEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *lfuHeap) Pop() any {
+	var old = *h
+	var n = len(old)
+	var entry = old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return entry
+}
+
+type lfuEvictor struct {
+	heap    lfuHeap
+	entries map[string]*lfuEntry
+	seq     uint64
+}
+
+func newLFUEvictor() *lfuEvictor {
+	return &lfuEvictor{
+		entries: make(map[string]*lfuEntry),
+	}
+}
+
+func (e *lfuEvictor) add(key string) {
+	if _, ok := e.entries[key]; ok {
+		e.access(key)
+		return
+	}
+	e.seq++
+	var entry = &lfuEntry{key: key, hits: 1, seq: e.seq}
+	e.entries[key] = entry
+	heap.Push(&e.heap, entry)
+}
+
+func (e *lfuEvictor) access(key string) {
+	var entry, ok = e.entries[key]
+	if !ok {
+		return
+	}
+	e.seq++
+	entry.hits++
+	entry.seq = e.seq
+	heap.Fix(&e.heap, entry.index)
+}
+
+func (e *lfuEvictor) remove(key string) {
+	var entry, ok = e.entries[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&e.heap, entry.index)
+	delete(e.entries, key)
+}
+
+func (e *lfuEvictor) victim(skip string) (string, bool) {
+	if len(e.heap) == 0 {
+		return "", false
+	}
+	if e.heap[0].key != skip {
+		return e.heap[0].key, true
+	}
+	// The smallest key is the one we should skip,
+	// the next smallest is one of its children.
+	var best *lfuEntry
+	for i := 1; i <= 2 && i < len(e.heap); i++ {
+		if best == nil || e.heap.Less(i, best.index) {
+			best = e.heap[i]
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	return best.key, true
+}
+
+func (e *lfuEvictor) clear() {
+	e.heap = nil
+	e.entries = make(map[string]*lfuEntry)
+}
@@ -1,328 +1,885 @@
-package cache
-
-import (
-	"bytes"
-	"encoding/gob"
-	"fmt"
-	"os"
-	"path/filepath"
-	"sync"
-	"time"
-
-	"github.com/Nigel2392/netcache/src/cache/binarytree"
-)
-
-const DefaultCleanupInterval = 5 * time.Minute
-
-type queueItem struct {
-	item  *item
-	value []byte
-}
-
-// A cache.
-//
-// Saves items in the specified cached directory.
-//
-// Item keys are stored inside of a binary tree.
-type FileCache struct {
-	cache           binarytree.InterfacedBST[*item]
-	cleanupInterval time.Duration
-	cleanupTicker   *time.Ticker
-	closed          chan struct{}
-	dir             string
-	mu              sync.Mutex
-	queue           chan *queueItem
-	lastTick        time.Time
-}
-
-// Create a new cache.
-func NewFileCache(dir string) Cache {
-	dir, err := filepath.Abs(dir)
-	if err != nil {
-		panic(err)
-	}
-	return &FileCache{
-		cache: binarytree.InterfacedBST[*item]{},
-		dir:   dir,
-	}
-}
-
-// Dump the cache to bytes.
-func (c *FileCache) Dump() ([]byte, error) {
-	var buf bytes.Buffer
-	var enc = gob.NewEncoder(&buf)
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	err := enc.Encode(c.cache)
-	if err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
-}
-
-// Load the cache from bytes.
-func (c *FileCache) Load(data []byte) error {
-	var buf = bytes.NewBuffer(data)
-	var dec = gob.NewDecoder(buf)
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	err := dec.Decode(&c.cache)
-	if err != nil {
-		return err
-	}
-
-	// Verify the integrity of the cache.
-	//
-	// Delete any items not found in the filesystem.
-	if c.cache.Len() > 0 {
-		return c.VerifyIntegrity()
-	}
-
-	return nil
-}
-
-// Verify the integrity of the cache.
-func (c *FileCache) VerifyIntegrity() error {
-	var errs []error = make([]error, 0)
-
-	c.cache.DeleteIf(func(i *item) bool {
-		var _, itemPath = i.getpath(c.dir)
-		var _, err = os.Stat(itemPath)
-		if err != nil {
-			errs = append(errs, err)
-		}
-		return err != nil
-	})
-
-	return NewIntegrityError(errs)
-}
-
-//
-//	// Connect the cache.
-//	func (c *FileCache) Connect() error {
-//		select {
-//		case <-c.closed:
-//			if c.cleanupInterval == 0 {
-//				c.cleanupInterval = DefaultCleanupInterval
-//			}
-//			c.Run(c.cleanupInterval)
-//		default:
-//			return ErrCacheAlreadyRunning
-//		}
-//		return nil
-//	}
-
-// Run the cache.
-func (c *FileCache) Run(interval time.Duration) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.queue = make(chan *queueItem, 100)
-	c.closed = make(chan struct{})
-	c.cleanupInterval = interval
-	go c.work()
-}
-
-// Set an item in the cache.
-func (c *FileCache) Set(key string, value []byte, ttl time.Duration) (inserted bool, err error) {
-	var (
-		item *item
-	)
-	item, err = newItem(key, ttl)
-	if err != nil {
-		return false, err
-	}
-
-	c.push(item, value)
-
-	select {
-	case err = <-item.err:
-		if err != nil {
-			return false, err
-		}
-	}
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	inserted = c.cache.Insert(item)
-	return inserted, nil
-}
-
-// Get an item from the cache.
-func (c *FileCache) Get(key string) (value []byte, ttl time.Duration, err error) {
-	var itm *item
-	var liveItem *item
-	var found bool
-	itm, err = newItemKey(key)
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	liveItem, found = c.cache.Search(itm)
-	if !found {
-		return nil, 0, ErrItemNotFound
-	}
-	value, err = liveItem.read(c.dir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			c.cache.Delete(liveItem)
-			return nil, 0, ErrItemNotFound
-		}
-		return nil, 0, err
-	}
-
-	liveItem.TTL -= time.Since(c.lastTick)
-	if liveItem.TTL <= 0 {
-		c.cache.Delete(liveItem)
-		liveItem.delete(c.dir)
-		return nil, 0, ErrItemNotFound
-	}
-
-	return value, liveItem.TTL, nil
-}
-
-// Delete an item from the cache.
-func (c *FileCache) Delete(key string) (deleted bool, err error) {
-	var item *item
-	item, err = newItemKey(key)
-	if err != nil {
-		return false, err
-	}
-	err = c.delete(item)
-	if err != nil {
-		return false, err
-	}
-	deleted = c.cache.Delete(item)
-	if !deleted {
-		return false, ErrItemNotFound
-	}
-	return deleted, nil
-}
-
-// Clear the cache.
-func (c *FileCache) Clear() (err error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var errors []error = make([]error, 0)
-	c.cache.Traverse(func(i *item) {
-		err = i.delete(c.dir)
-		if err != nil {
-			errors = append(errors, err)
-		}
-	})
-
-	if len(errors) > 0 {
-		return fmt.Errorf("%d errors have occurred trying to clear the cache", len(errors))
-	}
-
-	return nil
-}
-
-// Retrieve the keys from the cache.
-func (c *FileCache) Keys() []string {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var keys []string = make([]string, c.cache.Len())
-	var i int
-	c.cache.Traverse(func(item *item) {
-		keys[i] = item.Key
-		i++
-	})
-	return keys
-}
-
-// Close the cache.
-func (c *FileCache) Close() {
-	close(c.closed)
-}
-
-// Return the number of items in the cache.
-func (c *FileCache) Len() int {
-	return c.cache.Len()
-}
-
-// Check if the cache has an item.
-func (c *FileCache) Has(key string) (ttl time.Duration, has bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var item *item = &item{Key: key}
-	item, has = c.cache.Search(item)
-	if !has {
-		return 0, false
-	}
-
-	item.TTL -= time.Since(c.lastTick)
-	if item.TTL <= 0 {
-		c.cache.Delete(item)
-		item.delete(c.dir)
-		return 0, false
-	}
-
-	return item.TTL, true
-}
-
-func (c *FileCache) delete(item *item) (err error) {
-	var locked bool = c.mu.TryLock()
-	if locked {
-		defer c.mu.Unlock()
-	}
-
-	var _, found = c.cache.Search(item)
-	if !found {
-		c.mu.Unlock()
-		return ErrItemNotFound
-	}
-
-	err = item.delete(c.dir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			c.cache.Delete(item)
-			return ErrItemNotFound
-		}
-		return err
-	}
-
-	return nil
-}
-
-func (c *FileCache) push(item *item, value []byte) {
-	var queueItem = &queueItem{
-		item:  item,
-		value: value,
-	}
-
-	c.queue <- queueItem
-}
-
-func (c *FileCache) work() {
-	c.cleanupTicker = time.NewTicker(c.cleanupInterval)
-	c.lastTick = time.Now()
-	defer c.cleanupTicker.Stop()
-	for {
-		select {
-		case <-c.closed:
-			return
-		case <-c.cleanupTicker.C:
-			c.mu.Lock()
-			c.cleanup()
-			c.lastTick = time.Now()
-			c.mu.Unlock()
-		case item := <-c.queue:
-			item.item.write(c.dir, item.value)
-		}
-	}
-}
-
-func (c *FileCache) cleanup() {
-	var err error
-	c.cache.DeleteIf(func(i *item) bool {
-		if i == nil {
-			return true
-		}
-		i.TTL -= c.cleanupInterval
-		if i.TTL <= 0 {
-			err = c.delete(i)
-			if err != nil {
-				panic(err)
-			}
-			return true
-		}
-		return false
-	})
-}
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache/binarytree"
+)
+
+const DefaultCleanupInterval = 5 * time.Minute
+
+// A cache.
+//
+// Saves items in the specified cached directory.
+//
+// Item keys are stored inside of a self-balancing binary tree.
+//
+// Values are written to a temporary file which is renamed into place.
+// Unless the sync policy is SyncNever, every temporary file is flushed to disk before it is renamed,
+// so a crash never leaves a partially written value behind.
+// The sync policy decides when the renames are flushed to disk,
+// a crash before that can lose the write and leave the previous value in place.
+// Under SyncNever a crash can leave a partially written value behind.
+type FileCache struct {
+	commands
+
+	cache           binarytree.InterfacedAVL[*item]
+	cleanupInterval time.Duration
+	cleanupTicker   *time.Ticker
+	closed          chan struct{}
+	dir             string
+	mu              sync.Mutex
+	// The last version assigned to an item.
+	version uint64
+	// The keys stored under each tag.
+	tags tagIndex
+
+	syncPolicy   SyncPolicy
+	syncInterval time.Duration
+	// The directories of the items written since the last periodic sync.
+	unsynced map[string]struct{}
+	// Encrypts the values written to disk, nil if values are stored as they are.
+	keyring *Keyring
+	// The items removed while the mutex is held, reported to the observer once it is released.
+	removed removals
+	stats   counters
+}
+
+// Create a new cache, writes are flushed to disk every DefaultSyncInterval.
+func NewFileCache(dir string) Cache {
+	return NewSyncedFileCache(dir, SyncPeriodic, DefaultSyncInterval)
+}
+
+// Create a new cache which flushes writes to disk according to the sync policy.
+//
+// The interval is only used by the SyncPeriodic policy, an interval <= 0 uses DefaultSyncInterval.
+func NewSyncedFileCache(dir string, policy SyncPolicy, interval time.Duration) Cache {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		panic(err)
+	}
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+	var c = &FileCache{
+		cache:        binarytree.InterfacedAVL[*item]{},
+		dir:          dir,
+		tags:         make(tagIndex),
+		syncPolicy:   policy,
+		syncInterval: interval,
+		unsynced:     make(map[string]struct{}),
+	}
+	c.commands = newCommands(c)
+	return c
+}
+
+// Encrypt the values of the items with the current key of the keyring.
+//
+// Values written with an old key, or before encryption was enabled, are encrypted again with the current key when they are read.
+// Values encrypted with a key which is not in the keyring fail to read with ErrWrongKey.
+func (c *FileCache) UseKeyring(k *Keyring) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keyring = k
+}
+
+// Dump the cache to bytes.
+//
+// The cache is dumped as a snapshot holding the values of the items,
+// which can be loaded by any cache.
+func (c *FileCache) Dump() ([]byte, error) {
+	var w = newSnapshotWriter()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var now = time.Now()
+	var err error
+	c.cache.Traverse(func(i *item) {
+		if err != nil || i.expired(now) {
+			return
+		}
+		var value, readErr = c.read(i)
+		if readErr != nil {
+			if !os.IsNotExist(readErr) {
+				err = readErr
+			}
+			return
+		}
+		w.add(i.Key, &Entry{
+			Value:   value,
+			Expires: i.Expires,
+			Version: i.Version,
+			Tags:    i.Tags,
+			Type:    i.Type,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w.bytes(), nil
+}
+
+// Load the cache from bytes.
+//
+// Snapshots replace the items in the cache, their values are written to the filesystem.
+// Dumps made by older versions only hold the index of the cache, the values are expected to be in the cache directory.
+func (c *FileCache) Load(data []byte) error {
+	if isSnapshot(data) {
+		return c.loadSnapshot(data)
+	}
+
+	var index gobIndex
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&index); err != nil {
+		return err
+	}
+	var items, err = index.items(time.Now())
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+	c.cache = binarytree.InterfacedAVL[*item]{}
+	c.tags = make(tagIndex)
+	for _, i := range items {
+		c.cache.Insert(i)
+		if i.Version > c.version {
+			c.version = i.Version
+		}
+		c.tags.add(i.Key, i.Tags)
+	}
+
+	// Remove any items which expired while the cache was dumped.
+	c.cleanup(time.Now())
+
+	// Verify the integrity of the cache.
+	//
+	// Delete any items not found in the filesystem,
+	// and any temporary files left behind by a crash.
+	return c.VerifyIntegrity()
+}
+
+// The index of a cache in a gob dump made by an older version.
+//
+// Gob matches fields by name, so both the binary search tree of the oldest dumps and the AVL tree decode into it.
+type gobIndex struct {
+	Root *gobNode
+}
+
+type gobNode struct {
+	Val   *gobItem
+	Left  *gobNode
+	Right *gobNode
+}
+
+// An item in a gob dump, the oldest dumps hold the remaining time to live of the item instead of its expiry deadline.
+type gobItem struct {
+	Key     string
+	Expires time.Time
+	Version uint64
+	Tags    []string
+	Type    ValueType
+	TTL     time.Duration
+}
+
+// Returns the items in the index.
+//
+// The time to live of items in the oldest dumps is turned into a deadline relative to now,
+// items which had no time to live left are skipped.
+func (idx *gobIndex) items(now time.Time) ([]*item, error) {
+	var items []*item
+	var stack = []*gobNode{idx.Root}
+	for len(stack) > 0 {
+		var n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == nil {
+			continue
+		}
+		stack = append(stack, n.Left, n.Right)
+		if n.Val == nil {
+			continue
+		}
+		var i, err = newItemKey(n.Val.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+		i.Expires = n.Val.Expires
+		i.Version = n.Val.Version
+		i.Tags = n.Val.Tags
+		i.Type = n.Val.Type
+		if n.Val.TTL != 0 && i.Expires.IsZero() {
+			if n.Val.TTL < 0 {
+				continue
+			}
+			i.Expires = now.Add(n.Val.TTL)
+		}
+		items = append(items, i)
+	}
+	return items, nil
+}
+
+func (c *FileCache) loadSnapshot(data []byte) error {
+	// Decode the whole snapshot first, so a corrupt snapshot leaves the cache untouched.
+	var entries, err = snapshotEntries(data)
+	if err != nil {
+		return err
+	}
+	for key := range entries {
+		if err = IsValidKey(key); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache.DeleteIf(func(i *item) bool {
+		i.delete(c.dir)
+		return true
+	})
+	c.tags = make(tagIndex)
+
+	var now = time.Now()
+	var maxVersion uint64
+	for key, e := range entries {
+		if expiredAt(e.Expires, now) {
+			continue
+		}
+		var item, _ = newItemKey(key)
+		item.Expires = e.Expires
+		item.Tags = e.Tags
+		item.Type = e.Type
+		// Keep the version of the item, so versions read before the dump stay valid.
+		item.Version = e.Version
+		if err = c.persist(item, e.Value); err != nil {
+			return err
+		}
+		if e.Version > maxVersion {
+			maxVersion = e.Version
+		}
+		c.insert(item)
+	}
+	if maxVersion > c.version {
+		c.version = maxVersion
+	}
+	return c.VerifyIntegrity()
+}
+
+// Verify the integrity of the cache.
+//
+// Items which are not found in the filesystem are deleted,
+// temporary files left behind by interrupted writes are removed.
+// Both are reported as integrity errors.
+func (c *FileCache) VerifyIntegrity() error {
+	var errs []error = c.removeTempFiles()
+
+	c.cache.DeleteIf(func(i *item) bool {
+		var _, itemPath = i.getpath(c.dir)
+		var info, err = os.Stat(itemPath)
+		if err == nil {
+			i.size = info.Size()
+		}
+		if err != nil {
+			errs = append(errs, err)
+			c.tags.remove(i.Key, i.Tags)
+		}
+		return err != nil
+	})
+
+	return NewIntegrityError(errs)
+}
+
+// Rebuild the index of the cache from the files in the cache directory, replacing the items in the cache.
+//
+// The metadata of every item is read from the header of its file, files of expired items are deleted.
+// Files written by older versions have no header, they are indexed as strings which never expire.
+// Temporary files, and files which are not items of the cache, are reported as integrity errors.
+func (c *FileCache) Rebuild() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error = c.removeTempFiles()
+	c.cache = binarytree.InterfacedAVL[*item]{}
+	c.tags = make(tagIndex)
+
+	var dirs, err = os.ReadDir(c.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		return NewIntegrityError(errs)
+	}
+
+	var now = time.Now()
+	var legacy []*item
+	for _, d := range dirs {
+		// Items are stored in directories named after the hash of their key.
+		var hash, err = strconv.ParseUint(d.Name(), 10, 64)
+		if err != nil || !d.IsDir() {
+			continue
+		}
+		var path = filepath.Join(c.dir, d.Name())
+		files, err := os.ReadDir(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, f := range files {
+			var filePath = filepath.Join(path, f.Name())
+			var item, err = newItemKey(f.Name())
+			if err != nil || f.IsDir() || item.Hash != hash {
+				errs = append(errs, fmt.Errorf("unexpected file %s", filePath))
+				continue
+			}
+			found, err := item.readMeta(c.dir)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", filePath, err))
+				continue
+			}
+			if item.expired(now) {
+				if err = item.delete(c.dir); err != nil {
+					errs = append(errs, err)
+				}
+				continue
+			}
+			if info, err := f.Info(); err == nil {
+				item.size = info.Size()
+			}
+			if !found {
+				legacy = append(legacy, item)
+			} else if item.Version > c.version {
+				c.version = item.Version
+			}
+			c.insert(item)
+		}
+	}
+
+	// Items without a header get a new version, their header is written with their next change.
+	for _, item := range legacy {
+		c.version++
+		item.Version = c.version
+	}
+	return NewIntegrityError(errs)
+}
+
+// Remove the temporary files left behind by interrupted writes, returning an error for every file.
+func (c *FileCache) removeTempFiles() []error {
+	var errs []error
+	var dirs, err = os.ReadDir(c.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		return errs
+	}
+	for _, d := range dirs {
+		// Items are stored in directories named after the hash of their key.
+		if _, err = strconv.ParseUint(d.Name(), 10, 64); err != nil || !d.IsDir() {
+			continue
+		}
+		var path = filepath.Join(c.dir, d.Name())
+		var files, err = os.ReadDir(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, f := range files {
+			if !isTempFile(f.Name()) {
+				continue
+			}
+			var tempPath = filepath.Join(path, f.Name())
+			errs = append(errs, fmt.Errorf("leftover temporary file %s", tempPath))
+			if err = os.Remove(tempPath); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		removeIfEmpty(path)
+	}
+	return errs
+}
+
+//
+//	// Connect the cache.
+//	func (c *FileCache) Connect() error {
+//		select {
+//		case <-c.closed:
+//			if c.cleanupInterval == 0 {
+//				c.cleanupInterval = DefaultCleanupInterval
+//			}
+//			c.Run(c.cleanupInterval)
+//		default:
+//			return ErrCacheAlreadyRunning
+//		}
+//		return nil
+//	}
+
+// Run the cache.
+func (c *FileCache) Run(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = make(chan struct{})
+	c.cleanupInterval = interval
+	go c.work()
+}
+
+// Set an item in the cache, the item can be invalidated by any of its tags.
+func (c *FileCache) Set(key string, value []byte, ttl time.Duration, tags ...string) (inserted bool, err error) {
+	var (
+		item *item
+	)
+	item, err = newItem(key, ttl)
+	if err != nil {
+		return false, err
+	}
+	item.Tags = tags
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.write(item, value)
+	if err != nil {
+		return false, err
+	}
+	return c.insert(item), nil
+}
+
+// Write the value of an item under a new version, the mutex must be held.
+func (c *FileCache) write(item *item, value []byte) error {
+	item.Version = c.version + 1
+	if err := c.persist(item, value); err != nil {
+		return err
+	}
+	c.version = item.Version
+	c.stats.sets.Add(1)
+	return nil
+}
+
+// Write the value and metadata of an item to its file, the mutex must be held.
+//
+// The value is encrypted if the cache uses a keyring, the key of the item is authenticated along with it.
+// The header of the file flags whether the value is encrypted.
+func (c *FileCache) persist(item *item, value []byte) error {
+	var err error
+	if value, err = c.keyring.Encrypt(value, []byte(item.Key)); err != nil {
+		return err
+	}
+	item.Encrypted = c.keyring != nil
+	if err = item.write(c.dir, value, c.syncPolicy); err != nil {
+		return err
+	}
+	if c.syncPolicy == SyncPeriodic {
+		var path, _ = item.getpath(c.dir)
+		c.unsynced[path] = struct{}{}
+	}
+	return nil
+}
+
+// Read and decrypt the value of an item, the mutex must be held.
+//
+// Only values flagged as encrypted by the header of their file are decrypted, a cache without a keyring fails to read them.
+// Values which are not encrypted with the current key are written again, failing to do so does not fail the read.
+func (c *FileCache) read(item *item) ([]byte, error) {
+	var data, encrypted, err = item.read(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		if c.keyring != nil {
+			c.persist(item, data)
+		}
+		return data, nil
+	}
+	if c.keyring == nil {
+		return nil, fmt.Errorf("reading '%s': %w", item.Key, ErrWrongKey)
+	}
+	if !IsEncrypted(data) {
+		return nil, fmt.Errorf("reading '%s': %w: the value is flagged as encrypted, but is not", item.Key, ErrCorruptValue)
+	}
+	value, err := c.keyring.Decrypt(data, []byte(item.Key))
+	if err != nil {
+		return nil, fmt.Errorf("reading '%s': %w", item.Key, err)
+	}
+	if c.keyring.NeedsRotation(data) {
+		c.persist(item, value)
+	}
+	return value, nil
+}
+
+// Atomically update an item in the cache.
+func (c *FileCache) update(key string, fn func(e *Entry) (*Entry, error)) error {
+	var search, err = newItemKey(key)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	var old *Entry
+	var liveItem, found = c.cache.Search(search)
+	if found && !liveItem.expired(time.Now()) {
+		var value, err = c.read(liveItem)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			old = &Entry{
+				Value:   value,
+				Expires: liveItem.Expires,
+				Version: liveItem.Version,
+				Tags:    liveItem.Tags,
+				Type:    liveItem.Type,
+			}
+		}
+	}
+
+	e, err := fn(old)
+	if err != nil {
+		return err
+	}
+
+	if e == nil {
+		if found {
+			return c.delete(liveItem, RemovedDeleted)
+		}
+		return nil
+	}
+
+	search.Expires = e.Expires
+	search.Tags = e.Tags
+	search.Type = e.Type
+	if err = c.write(search, e.Value); err != nil {
+		return err
+	}
+	c.insert(search)
+	e.Version = search.Version
+	return nil
+}
+
+// Get an item from the cache.
+//
+// Returns ErrWrongType if the item is not a string.
+func (c *FileCache) Get(key string) (value []byte, ttl time.Duration, err error) {
+	var e *Entry
+	e, err = c.GetEntry(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if e.Type != StringValue {
+		c.stats.wrongType()
+		return nil, 0, ErrWrongType
+	}
+	return e.Value, e.TTL(), nil
+}
+
+// Get a copy of an item from the cache, including its metadata.
+func (c *FileCache) GetEntry(key string) (*Entry, error) {
+	var e, err = c.peekEntry(key)
+	c.stats.readResult(err)
+	return e, err
+}
+
+func (c *FileCache) countWrongType(key string) {
+	c.stats.wrongType()
+}
+
+// Get a copy of an item without counting the read.
+func (c *FileCache) peekEntry(key string) (*Entry, error) {
+	var itm, err = newItemKey(key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	var liveItem, found = c.cache.Search(itm)
+	if !found {
+		return nil, ErrItemNotFound
+	}
+
+	if liveItem.expired(time.Now()) {
+		c.forget(liveItem)
+		liveItem.delete(c.dir)
+		c.recordRemoval(liveItem.Key, RemovedExpired)
+		return nil, ErrItemNotFound
+	}
+
+	value, err := c.read(liveItem)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.forget(liveItem)
+			return nil, ErrItemNotFound
+		}
+		return nil, err
+	}
+	return &Entry{
+		Value:   value,
+		Expires: liveItem.Expires,
+		Version: liveItem.Version,
+		Tags:    liveItem.Tags,
+		Type:    liveItem.Type,
+	}, nil
+}
+
+// Delete an item from the cache.
+func (c *FileCache) Delete(key string) (deleted bool, err error) {
+	var item *item
+	item, err = newItemKey(key)
+	if err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	var liveItem, found = c.cache.Search(item)
+	if !found {
+		return false, ErrItemNotFound
+	}
+	err = c.delete(liveItem, RemovedDeleted)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Clear the cache.
+//
+// Items which could not be removed from the filesystem are kept.
+func (c *FileCache) Clear() (err error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var errors []error = make([]error, 0)
+	c.cache.DeleteIf(func(i *item) bool {
+		err = i.delete(c.dir)
+		if err != nil {
+			errors = append(errors, err)
+			return false
+		}
+		c.tags.remove(i.Key, i.Tags)
+		c.recordRemoval(i.Key, RemovedCleared)
+		return true
+	})
+
+	if len(errors) > 0 {
+		return fmt.Errorf("%d errors have occurred trying to clear the cache", len(errors))
+	}
+
+	return nil
+}
+
+// Delete all items with the given tag, returning the amount of deleted items.
+func (c *FileCache) InvalidateTag(tag string) (deleted int, err error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var now = time.Now()
+	for _, key := range c.tags.keys(tag) {
+		var liveItem, found = c.cache.Search(&item{Key: key})
+		if !found {
+			continue
+		}
+		// Items which expired before the cleanup removed them are removed as expired, and not counted.
+		if liveItem.expired(now) {
+			if err = c.delete(liveItem, RemovedExpired); err != nil {
+				return deleted, err
+			}
+			continue
+		}
+		if err = c.delete(liveItem, RemovedDeleted); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Retrieve the keys from the cache.
+func (c *FileCache) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string = make([]string, c.cache.Len())
+	var i int
+	c.cache.Traverse(func(item *item) {
+		keys[i] = item.Key
+		i++
+	})
+	return keys
+}
+
+// Scan the keys in the cache.
+//
+// Keys are visited in order, starting at the literal prefix of the pattern.
+func (c *FileCache) Scan(cursor string, match string, count int) (keys []string, next string, err error) {
+	var pattern *scanPattern
+	if pattern, err = newScanPattern(match); err != nil {
+		return nil, "", err
+	}
+	count = scanCount(count)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var now = time.Now()
+	c.cache.AscendFrom(&item{Key: pattern.start(cursor)}, func(i *item) bool {
+		if pattern.past(i.Key) {
+			return false
+		}
+		if i.Key > cursor && pattern.match(i.Key) && !i.expired(now) {
+			keys = append(keys, i.Key)
+		}
+		return len(keys) <= count
+	})
+	keys, next = scanPage(keys, count)
+	return keys, next, nil
+}
+
+// Close the cache.
+func (c *FileCache) Close() {
+	close(c.closed)
+}
+
+// Return the number of items in the cache.
+func (c *FileCache) Len() int {
+	return c.cache.Len()
+}
+
+// Check if the cache has an item.
+func (c *FileCache) Has(key string) (ttl time.Duration, has bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	var item *item = &item{Key: key}
+	item, has = c.cache.Search(item)
+	if !has {
+		return 0, false
+	}
+
+	if item.expired(time.Now()) {
+		c.forget(item)
+		item.delete(c.dir)
+		c.recordRemoval(item.Key, RemovedExpired)
+		return 0, false
+	}
+
+	return item.ttl(), true
+}
+
+// Insert an item into the tree and the tag index, the mutex must be held.
+func (c *FileCache) insert(item *item) (inserted bool) {
+	if old, found := c.cache.Search(item); found {
+		c.tags.remove(old.Key, old.Tags)
+	}
+	c.tags.add(item.Key, item.Tags)
+	return c.cache.Insert(item)
+}
+
+// Remove an item from the tree and the tag index, the mutex must be held.
+func (c *FileCache) forget(item *item) {
+	c.cache.Delete(item)
+	c.tags.remove(item.Key, item.Tags)
+}
+
+// Delete an item from the filesystem and the tree, the mutex must be held.
+//
+// The removal is reported to the observer once the mutex is released by unlock.
+func (c *FileCache) delete(item *item, reason RemovalReason) (err error) {
+	err = item.delete(c.dir)
+	if err != nil {
+		return err
+	}
+	c.forget(item)
+	c.recordRemoval(item.Key, reason)
+	return nil
+}
+
+// Record the removal of an item for the observer and the statistics, the mutex must be held.
+func (c *FileCache) recordRemoval(key string, reason RemovalReason) {
+	c.removed.add(key, reason)
+	c.stats.removed(reason)
+}
+
+// Returns the statistics of the cache, the bytes are the size of the files of the items.
+func (c *FileCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var stats = c.stats.stats()
+	stats.Items = int64(c.cache.Len())
+	c.cache.Traverse(func(i *item) {
+		stats.Bytes += i.size
+	})
+	return stats
+}
+
+// Set the observer which is called for every item removed from the cache, nil removes the observer.
+//
+// Items which are overwritten, including by loading a dump or rebuilding the cache, are not reported.
+func (c *FileCache) OnRemove(observer RemovalObserver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed.observer = observer
+}
+
+// Release the mutex, and report the items removed while it was held to the observer.
+func (c *FileCache) unlock() {
+	var notify = c.removed.take()
+	c.mu.Unlock()
+	notify()
+}
+
+func (c *FileCache) work() {
+	c.cleanupTicker = time.NewTicker(c.cleanupInterval)
+	defer c.cleanupTicker.Stop()
+	var syncTicker <-chan time.Time
+	if c.syncPolicy == SyncPeriodic {
+		var ticker = time.NewTicker(c.syncInterval)
+		defer ticker.Stop()
+		syncTicker = ticker.C
+	}
+	for {
+		select {
+		case <-c.closed:
+			c.mu.Lock()
+			c.sync()
+			c.mu.Unlock()
+			return
+		case now := <-c.cleanupTicker.C:
+			c.mu.Lock()
+			c.cleanup(now)
+			c.unlock()
+		case <-syncTicker:
+			c.mu.Lock()
+			c.sync()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Flush the directories of the items written since the last sync to disk, the mutex must be held.
+//
+// The files of the items are flushed when they are written, flushing their directories makes the renames durable.
+// Directories which could not be flushed are kept, the next sync will try again.
+func (c *FileCache) sync() {
+	for dir := range c.unsynced {
+		if syncDir(dir) == nil {
+			delete(c.unsynced, dir)
+		}
+	}
+}
+
+// Remove all items which have expired at the given time, the mutex must be held.
+func (c *FileCache) cleanup(now time.Time) {
+	c.cache.DeleteIf(func(i *item) bool {
+		if i == nil {
+			return true
+		}
+		if !i.expired(now) {
+			return false
+		}
+		// Keep the item around if the file could not be removed,
+		// the next cleanup will try again.
+		if i.delete(c.dir) != nil {
+			return false
+		}
+		c.tags.remove(i.Key, i.Tags)
+		c.recordRemoval(i.Key, RemovedExpired)
+		return true
+	})
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The policy used to decide when written data is flushed to disk with fsync.
+//
+// A FileCache flushes the file of every value before renaming it into place, unless the policy is SyncNever,
+// the policy decides when the renames are flushed.
+type SyncPolicy int
+
+const (
+	// Flush every write before it becomes visible.
+	SyncAlways SyncPolicy = iota
+	// Flush writes in the background, a crash can lose the writes of the last interval.
+	SyncPeriodic
+	// Leave flushing to the operating system, a crash can lose or corrupt the writes which were not flushed.
+	SyncNever
+)
+
+// The interval at which writes are flushed by the SyncPeriodic policy, if no interval is given.
+const DefaultSyncInterval = time.Second
+
+var syncPolicyMap = map[SyncPolicy]string{
+	SyncAlways:   "always",
+	SyncPeriodic: "periodic",
+	SyncNever:    "never",
+}
+
+func (p SyncPolicy) String() string {
+	return syncPolicyMap[p]
+}
+
+// Parse a sync policy from a string, case insensitive.
+func SyncPolicyFromString(policy string) (SyncPolicy, error) {
+	for p, name := range syncPolicyMap {
+		if strings.EqualFold(name, policy) {
+			return p, nil
+		}
+	}
+	return SyncAlways, fmt.Errorf("unknown sync policy '%s'", policy)
+}
+
+// Flush a directory to disk, making the files renamed into it durable.
+//
+// Directories cannot be flushed on windows, where renames are made durable by the filesystem.
+func syncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	return syncFile(path)
+}
+
+// Flush a file to disk.
+//
+// Files which no longer exist are ignored, they have been deleted since they were written.
+func syncFile(path string) error {
+	var f, err = os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
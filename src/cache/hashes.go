@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Decode the fields of a hash.
+func decodeHash(e *Entry) (map[string][]byte, error) {
+	var fields = make(map[string][]byte)
+	if e == nil {
+		return fields, nil
+	}
+	var values, err = decodeValues(e.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, ErrCorruptValue
+	}
+	for i := 0; i < len(values); i += 2 {
+		fields[string(values[i])] = values[i+1]
+	}
+	return fields, nil
+}
+
+// Encode the fields of a hash into an entry, the fields are sorted so equal hashes encode equally.
+//
+// Returns nil if there are no fields left, which deletes the hash.
+func encodeHash(e *Entry, fields map[string][]byte) *Entry {
+	if len(fields) == 0 {
+		return nil
+	}
+	var names = make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var values = make([][]byte, 0, len(fields)*2)
+	for _, name := range names {
+		values = append(values, []byte(name), fields[name])
+	}
+	if e == nil {
+		e = &Entry{Type: HashValue}
+	}
+	e.Value = encodeValues(values)
+	return e
+}
+
+// Atomically update the fields of the hash stored under the key.
+//
+// The hash is created if it does not exist, and deleted when its last field is deleted.
+func (c commands) updateHash(key string, fn func(fields map[string][]byte) error) error {
+	return c.update(key, func(e *Entry) (*Entry, error) {
+		if err := checkType(e, HashValue); err != nil {
+			return nil, err
+		}
+		var fields, err = decodeHash(e)
+		if err != nil {
+			return nil, err
+		}
+		if err = fn(fields); err != nil {
+			return nil, err
+		}
+		return encodeHash(e, fields), nil
+	})
+}
+
+// Returns the fields of the hash stored under the key, a missing key is an empty hash.
+func (c commands) viewHash(key string) (map[string][]byte, error) {
+	var e, err = c.store.GetEntry(key)
+	if err != nil {
+		if ErrItemNotFound.Is(err) {
+			return decodeHash(nil)
+		}
+		return nil, err
+	}
+	if err = checkType(e, HashValue); err != nil {
+		countWrongType(c.store, key)
+		return nil, err
+	}
+	return decodeHash(e)
+}
+
+// Set fields of the hash stored under the key, returning the amount of fields which were added.
+//
+// The hash is created if the key does not exist, it never expires until a TTL is set.
+func (c commands) HSet(key string, fields map[string][]byte) (added int, err error) {
+	err = c.updateHash(key, func(hash map[string][]byte) error {
+		added = 0
+		for name, value := range fields {
+			if _, ok := hash[name]; !ok {
+				added++
+			}
+			hash[name] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// Get a field of the hash stored under the key.
+//
+// Returns ErrItemNotFound if the key or the field does not exist.
+func (c commands) HGet(key string, field string) ([]byte, error) {
+	var hash, err = c.viewHash(key)
+	if err != nil {
+		return nil, err
+	}
+	var value, ok = hash[field]
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+	return value, nil
+}
+
+// Delete fields of the hash stored under the key, returning the amount of deleted fields.
+func (c commands) HDel(key string, fields ...string) (deleted int, err error) {
+	err = c.updateHash(key, func(hash map[string][]byte) error {
+		deleted = 0
+		for _, name := range fields {
+			if _, ok := hash[name]; ok {
+				delete(hash, name)
+				deleted++
+			}
+		}
+		if deleted == 0 {
+			return errSkipUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// Get all fields of the hash stored under the key.
+func (c commands) HGetAll(key string) (map[string][]byte, error) {
+	return c.viewHash(key)
+}
+
+// Returns the amount of fields of the hash stored under the key.
+func (c commands) HLen(key string) (int, error) {
+	var hash, err = c.viewHash(key)
+	if err != nil {
+		return 0, err
+	}
+	return len(hash), nil
+}
+
+// Atomically add delta to the integer stored in a field of the hash, returning the new value.
+//
+// A missing field is created with a value of zero before delta is added.
+func (c commands) HIncrBy(key string, field string, delta int64) (value int64, err error) {
+	err = c.updateHash(key, func(hash map[string][]byte) error {
+		value = 0
+		if stored, ok := hash[field]; ok {
+			var err error
+			if value, err = strconv.ParseInt(string(stored), 10, 64); err != nil {
+				return ErrNotInteger
+			}
+		}
+		if (delta > 0 && value > math.MaxInt64-delta) || (delta < 0 && value < math.MinInt64-delta) {
+			return ErrIntegerOverflow
+		}
+		value += delta
+		hash[field] = strconv.AppendInt(nil, value, 10)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
@@ -1,31 +1,129 @@
-package cache
-
-import "time"
-
-type Cache interface {
-	// Initialize the cache with the set cleanup interval.
-	//
-	// Extra initialization can be done here.
-	Run(interval time.Duration)
-	// Set a value in the cache.
-	Set(key string, value []byte, ttl time.Duration) (inserted bool, err error)
-	// Get a value from the cache.
-	Get(key string) (value []byte, ttl time.Duration, err error)
-	// Delete a value from the cache.
-	Delete(key string) (deleted bool, err error)
-	// Clear the cache.
-	Clear() (err error)
-	// Keys returns all keys in the cache.
-	Keys() []string
-	// Close the cache.
-	Close()
-	// Len returns the number of items in the cache.
-	Len() int
-	// Has returns true if the key exists in the cache.
-	Has(key string) (ttl time.Duration, has bool)
-
-	// Dumps the cache to bytes.
-	Dump() ([]byte, error)
-	// Loads the cache from bytes.
-	Load([]byte) error
-}
+package cache
+
+import "time"
+
+type Cache interface {
+	// Initialize the cache with the set cleanup interval.
+	//
+	// Extra initialization can be done here.
+	Run(interval time.Duration)
+	// Set a value in the cache, a ttl <= 0 stores a value which never expires.
+	//
+	// The value can be invalidated by any of its tags.
+	Set(key string, value []byte, ttl time.Duration, tags ...string) (inserted bool, err error)
+	// Get a value from the cache.
+	Get(key string) (value []byte, ttl time.Duration, err error)
+	// Get a copy of an item from the cache, including its metadata.
+	//
+	// Unlike Get, items of every type are returned.
+	GetEntry(key string) (*Entry, error)
+	// Store a copy of an entry under the key, including its type, expiry and tags.
+	SetEntry(key string, e *Entry) error
+	// Delete a value from the cache.
+	Delete(key string) (deleted bool, err error)
+	// Clear the cache.
+	Clear() (err error)
+	// Atomically delete all values with the given tag, returning the amount of deleted values.
+	InvalidateTag(tag string) (deleted int, err error)
+	// Keys returns all keys in the cache.
+	Keys() []string
+	// Scan returns up to count keys after the cursor which match the glob pattern, in order.
+	//
+	// The returned cursor is passed to the next call to continue the scan,
+	// an empty cursor starts the scan and is returned when the scan is complete.
+	Scan(cursor string, match string, count int) (keys []string, next string, err error)
+	// Close the cache.
+	Close()
+	// Len returns the number of items in the cache.
+	Len() int
+	// Has returns true if the key exists in the cache, and the remaining TTL of the key.
+	//
+	// The TTL of keys which never expire is NoExpiry.
+	Has(key string) (ttl time.Duration, has bool)
+	// Stats returns the statistics of the cache, counted since the cache was created.
+	Stats() Stats
+
+	// Atomically add delta to the integer stored under the key, returning the new value.
+	//
+	// If the key does not exist, it is created with the initial value and ttl before delta is added.
+	Incr(key string, delta int64, initial int64, ttl time.Duration) (value int64, err error)
+	// Set the value of the key, but only if the version of the stored item matches the given version.
+	//
+	// A version of zero only matches if the key does not exist.
+	CompareAndSwap(key string, value []byte, ttl time.Duration, version uint64) (newVersion uint64, err error)
+	// Set the value of the key, but only if the key does not exist.
+	SetNX(key string, value []byte, ttl time.Duration) (set bool, err error)
+	// Set the value of the key, but only if the key already exists.
+	Replace(key string, value []byte, ttl time.Duration) (replaced bool, err error)
+	// Set the value of the key, returning the item it replaced, or nil if the key did not exist.
+	GetAndSet(key string, value []byte, ttl time.Duration) (old *Entry, err error)
+	// Delete the key, returning the deleted item.
+	GetAndDelete(key string) (old *Entry, err error)
+	// Set a new TTL for the key relative to now, NoExpiry makes the key persistent.
+	Touch(key string, ttl time.Duration) error
+	// Set the time at which the key expires, a zero time makes the key persistent.
+	Expire(key string, at time.Time) error
+	// Make the key persistent, so it never expires.
+	Persist(key string) error
+
+	// Set fields of the hash stored under the key, returning the amount of added fields.
+	HSet(key string, fields map[string][]byte) (added int, err error)
+	// Get a field of the hash stored under the key.
+	HGet(key string, field string) ([]byte, error)
+	// Delete fields of the hash stored under the key, returning the amount of deleted fields.
+	HDel(key string, fields ...string) (deleted int, err error)
+	// Get all fields of the hash stored under the key.
+	HGetAll(key string) (map[string][]byte, error)
+	// Returns the amount of fields of the hash stored under the key.
+	HLen(key string) (int, error)
+	// Atomically add delta to the integer stored in a field of the hash, returning the new value.
+	HIncrBy(key string, field string, delta int64) (int64, error)
+
+	// Push values to the head of the list stored under the key, returning the length of the list.
+	LPush(key string, values ...[]byte) (length int, err error)
+	// Push values to the tail of the list stored under the key, returning the length of the list.
+	RPush(key string, values ...[]byte) (length int, err error)
+	// Pop the value at the head of the list stored under the key.
+	LPop(key string) ([]byte, error)
+	// Pop the value at the tail of the list stored under the key.
+	RPop(key string) ([]byte, error)
+	// Pop the value at the head of the list stored under the key, waiting up to the timeout for a value.
+	BLPop(key string, timeout time.Duration) ([]byte, error)
+	// Pop the value at the tail of the list stored under the key, waiting up to the timeout for a value.
+	BRPop(key string, timeout time.Duration) ([]byte, error)
+	// Returns the values of the list stored under the key from start to stop, inclusive.
+	LRange(key string, start int, stop int) ([][]byte, error)
+	// Returns the length of the list stored under the key.
+	LLen(key string) (int, error)
+
+	// Add members to the set stored under the key, returning the amount of members which were added.
+	SAdd(key string, members ...string) (added int, err error)
+	// Remove members from the set stored under the key, returning the amount of removed members.
+	SRem(key string, members ...string) (removed int, err error)
+	// Reports whether the member is in the set stored under the key.
+	SIsMember(key string, member string) (bool, error)
+	// Returns the members of the set stored under the key, in sorted order.
+	SMembers(key string) ([]string, error)
+	// Returns the members which are in all of the sets stored under the keys.
+	SInter(keys ...string) ([]string, error)
+	// Returns the members which are in any of the sets stored under the keys.
+	SUnion(keys ...string) ([]string, error)
+
+	// Add members to the sorted set stored under the key, returning the amount of members which were added.
+	ZAdd(key string, members ...ScoredMember) (added int, err error)
+	// Atomically add delta to the score of a member of the sorted set, returning the new score.
+	ZIncrBy(key string, member string, delta float64) (float64, error)
+	// Returns the members of the sorted set stored under the key from rank start to stop, inclusive.
+	ZRange(key string, start int, stop int) ([]ScoredMember, error)
+	// Returns the members of the sorted set stored under the key with a score between min and max, inclusive.
+	ZRangeByScore(key string, min float64, max float64) ([]ScoredMember, error)
+	// Remove the members of the sorted set from rank start to stop, inclusive.
+	ZRemRangeByRank(key string, start int, stop int) (removed int, err error)
+	// Remove the members of the sorted set with a score between min and max, inclusive.
+	ZRemRangeByScore(key string, min float64, max float64) (removed int, err error)
+
+	// Dumps the cache to bytes.
+	Dump() ([]byte, error)
+	// Loads the cache from bytes.
+	Load([]byte) error
+}
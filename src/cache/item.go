@@ -1,193 +1,415 @@
-package cache
-
-import (
-	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
-	"regexp"
-	"strconv"
-	"time"
-)
-
-//	var allowedChars = map[rune]bool{
-//		'.': true,
-//		'-': true,
-//		'_': true,
-//	}
-//	for _, char := range key {
-//		if !allowedChars[char] && !('a' <= char && char <= 'z') && !('A' <= char && char <= 'Z') && !('0' <= char && char <= '9') {
-//			return fmt.Errorf("key '%s' contains invalid characters", key)
-//		}
-//	}
-
-var keyRegexFunc = regexp.MustCompile(`^[a-zA-Z0-9\._\-]+$`).MatchString
-
-type memitem[T any] struct {
-	Key   string
-	Value T
-	TTL   time.Duration
-}
-
-type item struct {
-	Key      string        // the key the filename of the cached item, this cannot contain any special characters
-	Hash     uint64        // the hash is the directory the key is stored in
-	TTL      time.Duration // the time to live of the cached item
-	Filepath string        // the filepath of the cached item
-	err      chan error
-}
-
-func (c *item) Close() error {
-	close(c.err)
-	return nil
-}
-
-func newItem(key string, ttl time.Duration) (*item, error) {
-	if ttl <= time.Second {
-		return nil, fmt.Errorf("ttl '%s' is too short", ttl)
-	}
-
-	if err := IsValidKey(key); err != nil {
-		return nil, err
-	}
-
-	var item = &item{
-		Key:  key,
-		Hash: strHash(key),
-		TTL:  ttl,
-		err:  make(chan error, 1),
-	}
-
-	return item, nil
-}
-
-func newItemKey(key string) (*item, error) {
-	if err := IsValidKey(key); err != nil {
-		return nil, err
-	}
-
-	var item = &item{
-		Key:  key,
-		Hash: strHash(key),
-	}
-	return item, nil
-}
-
-func IsValidKey(key string) error {
-	if len(key) <= 1 {
-		return fmt.Errorf("key '%s' is too short", key)
-	}
-
-	if !keyRegexFunc(key) {
-		return fmt.Errorf("key '%s' contains invalid characters", key)
-	}
-
-	if len(key) > 64 {
-		return fmt.Errorf("key '%s' is too long", key)
-	}
-	return nil
-}
-
-func (c *item) write(dir string, value []byte) {
-	var (
-		err      error
-		path     string
-		itemPath string
-		file     *os.File
-	)
-	if c.TTL <= time.Second {
-		c.err <- fmt.Errorf("ttl '%s' is too short", c.TTL)
-	}
-
-	path, itemPath = c.getpath(dir)
-	if err = os.MkdirAll(path, 0755); err != nil {
-		c.err <- err
-		return
-	}
-
-	file, err = os.Create(itemPath)
-	if err != nil {
-		c.err <- err
-		return
-	}
-	defer file.Close()
-
-	_, err = file.Write(value)
-	if err != nil {
-		c.err <- err
-		return
-	}
-
-	c.err <- nil
-}
-
-func (c *item) read(dir string) (value []byte, err error) {
-	if c.TTL <= 0 {
-		c.delete(dir)
-		return nil, fmt.Errorf("item has expired: %d", c.TTL)
-	}
-
-	var _, itemPath = c.getpath(dir)
-
-	var file *os.File
-	file, err = os.Open(itemPath)
-	if err != nil {
-		return
-	}
-	defer file.Close()
-
-	var stat os.FileInfo
-	stat, err = file.Stat()
-	if err != nil {
-		return
-	}
-
-	value = make([]byte, stat.Size())
-	_, err = file.Read(value)
-	return
-}
-
-func (c *item) delete(dir string) (err error) {
-	var path, itemPath = c.getpath(dir)
-	err = os.Remove(itemPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return
-	}
-
-	return removeIfEmpty(path)
-}
-
-func removeIfEmpty(path string) (err error) {
-	var files []fs.DirEntry
-	files, err = os.ReadDir(path)
-	if err != nil {
-		return
-	}
-
-	if len(files) == 0 {
-		err = os.Remove(path)
-	}
-
-	return
-}
-
-func (c *item) getpath(dir string) (path, itemPath string) {
-	path = filepath.Join(dir, strconv.FormatUint(c.Hash, 10))
-	itemPath = filepath.Join(path, c.Key)
-	return path, itemPath
-}
-
-func (c *item) Equals(other *item) bool {
-	return c.Key == other.Key
-}
-
-func (c *item) Gt(other *item) bool {
-	return c.Key > other.Key
-}
-
-func (c *item) Lt(other *item) bool {
-	return c.Key < other.Key
-}
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+//	var allowedChars = map[rune]bool{
+//		'.': true,
+//		'-': true,
+//		'_': true,
+//	}
+//	for _, char := range key {
+//		if !allowedChars[char] && !('a' <= char && char <= 'z') && !('A' <= char && char <= 'Z') && !('0' <= char && char <= '9') {
+//			return fmt.Errorf("key '%s' contains invalid characters", key)
+//		}
+//	}
+
+var keyRegexFunc = regexp.MustCompile(`^[a-zA-Z0-9\._\-]+$`).MatchString
+
+// The TTL of items which never expire.
+//
+// Items stored with a TTL of NoExpiry, or any other TTL <= 0, are kept until they are deleted.
+// NoExpiry is reported as the TTL of such items.
+const NoExpiry time.Duration = -1
+
+// Returns the expiry deadline of an item stored with the given TTL.
+//
+// Items which never expire have a zero deadline.
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// Returns the remaining TTL of an item with the given expiry deadline.
+func ttlUntil(expires time.Time) time.Duration {
+	if expires.IsZero() {
+		return NoExpiry
+	}
+	return time.Until(expires)
+}
+
+// Reports whether an item with the given expiry deadline has expired at the given time.
+func expiredAt(expires time.Time, now time.Time) bool {
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+type memitem[T any] struct {
+	Key     string
+	Value   T
+	Expires time.Time
+	Version uint64
+	Tags    []string
+	Type    ValueType
+}
+
+// Returns a copy of the item as an entry.
+//
+// Only supported if the value of the item is a byte slice.
+func (i *memitem[T]) entry() (*Entry, error) {
+	var value, ok = any(i.Value).([]byte)
+	if !ok {
+		return nil, ErrNotBytes
+	}
+	return &Entry{
+		Value:   value,
+		Expires: i.Expires,
+		Version: i.Version,
+		Tags:    i.Tags,
+		Type:    i.Type,
+	}, nil
+}
+
+// Returns the remaining time to live of the item.
+func (i *memitem[T]) ttl() time.Duration {
+	return ttlUntil(i.Expires)
+}
+
+// Reports whether the item has expired at the given time.
+func (i *memitem[T]) expired(now time.Time) bool {
+	return expiredAt(i.Expires, now)
+}
+
+// Returns the approximate amount of memory used by the item.
+func (i *memitem[T]) size() int64 {
+	var size = int64(len(i.Key))
+	switch v := any(i.Value).(type) {
+	case []byte:
+		size += int64(len(v))
+	case string:
+		size += int64(len(v))
+	default:
+		size += int64(unsafe.Sizeof(i.Value))
+	}
+	return size
+}
+
+type item struct {
+	Key       string    // the key the filename of the cached item, this cannot contain any special characters
+	Hash      uint64    // the hash is the directory the key is stored in
+	Expires   time.Time // the time at which the cached item expires
+	Version   uint64    // the version of the cached item, incremented on every write
+	Tags      []string  // the tags the cached item can be invalidated by
+	Type      ValueType // the type of the value of the cached item
+	Encrypted bool      // whether the value in the file of the cached item is encrypted
+	Filepath  string    // the filepath of the cached item
+	size      int64     // the size of the file of the cached item, including its header
+}
+
+// Returns the remaining time to live of the item.
+func (c *item) ttl() time.Duration {
+	return ttlUntil(c.Expires)
+}
+
+// Reports whether the item has expired at the given time.
+func (c *item) expired(now time.Time) bool {
+	return expiredAt(c.Expires, now)
+}
+
+// Returns a new item expiring after the ttl, any ttl is allowed like in the other caches.
+func newItem(key string, ttl time.Duration) (*item, error) {
+	if err := IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var item = &item{
+		Key:     key,
+		Hash:    strHash(key),
+		Expires: expiresAt(ttl),
+	}
+
+	return item, nil
+}
+
+func newItemKey(key string) (*item, error) {
+	if err := IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var item = &item{
+		Key:  key,
+		Hash: strHash(key),
+	}
+	return item, nil
+}
+
+func IsValidKey(key string) error {
+	if len(key) <= 1 {
+		return fmt.Errorf("key '%s' is too short", key)
+	}
+
+	if !keyRegexFunc(key) {
+		return fmt.Errorf("key '%s' contains invalid characters", key)
+	}
+
+	if len(key) > 64 {
+		return fmt.Errorf("key '%s' is too long", key)
+	}
+	return nil
+}
+
+// The marker in the names of temporary files, keys cannot contain it.
+const tempFileMarker = "~"
+
+// Reports whether the file name is the name of a temporary file.
+func isTempFile(name string) bool {
+	return strings.Contains(name, tempFileMarker)
+}
+
+// The start of the header of a value file.
+var itemHeaderMagic = []byte("NCITEM\x00")
+
+// The maximum size of the fields of a header, larger headers are corrupt.
+const maxItemHeaderSize = 1 << 20
+
+// The flags of a value file, stored in its header.
+const (
+	// The value is encrypted by the keyring of the cache.
+	itemEncrypted byte = 1 << iota
+)
+
+// Returns the header written in front of the value of the item.
+//
+// The header holds the metadata of the item, so the index of the cache can be rebuilt from the files.
+//
+// Header: Magic | Length (uvarint) | Fields (encodeValues) | CRC32 (uint32)
+//
+// Fields: Expiry | Version (uvarint) | Type | Tags | Flags
+//
+// Headers written before the flags were added have no flags field.
+func (c *item) header() []byte {
+	var tags []byte
+	if len(c.Tags) > 0 {
+		tags = encodeValues(stringsToValues(c.Tags))
+	}
+	var flags byte
+	if c.Encrypted {
+		flags |= itemEncrypted
+	}
+	var fields = encodeValues([][]byte{
+		encodeExpiry(c.Expires),
+		binary.AppendUvarint(nil, c.Version),
+		{byte(c.Type)},
+		tags,
+		{flags},
+	})
+	var b = append([]byte(nil), itemHeaderMagic...)
+	b = binary.AppendUvarint(b, uint64(len(fields)))
+	b = append(b, fields...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(fields))
+}
+
+// Read the header of a value file into the item.
+//
+// Files written by older versions have no header, found is false and nothing is read from them.
+func (c *item) readHeader(r *bufio.Reader) (found bool, err error) {
+	var magic, _ = r.Peek(len(itemHeaderMagic))
+	if !bytes.Equal(magic, itemHeaderMagic) {
+		return false, nil
+	}
+	r.Discard(len(itemHeaderMagic))
+	var length uint64
+	if length, err = binary.ReadUvarint(r); err != nil || length > maxItemHeaderSize {
+		return true, ErrCorruptValue
+	}
+	var b = make([]byte, length+4)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return true, ErrCorruptValue
+	}
+	var fields = b[:length]
+	if crc32.ChecksumIEEE(fields) != binary.BigEndian.Uint32(b[length:]) {
+		return true, ErrCorruptValue
+	}
+	values, err := decodeValues(fields)
+	if err != nil || len(values) < 4 || len(values) > 5 || len(values[2]) != 1 {
+		return true, ErrCorruptValue
+	}
+	c.Encrypted = false
+	if len(values) == 5 {
+		if len(values[4]) != 1 {
+			return true, ErrCorruptValue
+		}
+		c.Encrypted = values[4][0]&itemEncrypted != 0
+	}
+	if c.Expires, err = decodeExpiry(values[0]); err != nil {
+		return true, err
+	}
+	var n int
+	if c.Version, n = binary.Uvarint(values[1]); n <= 0 {
+		return true, ErrCorruptValue
+	}
+	c.Type = ValueType(values[2][0])
+	c.Tags = nil
+	if len(values[3]) > 0 {
+		var tags, err = decodeValues(values[3])
+		if err != nil {
+			return true, ErrCorruptValue
+		}
+		c.Tags = valuesToStrings(tags)
+	}
+	return true, nil
+}
+
+// Write the value of the item to a temporary file, and rename it into place.
+//
+// The value is preceded by the header of the item.
+// Unless the policy is SyncNever, the temporary file is flushed to disk before it is renamed,
+// so a crash leaves either the previous value or the new value in place, and maybe a temporary file behind.
+// If the policy is SyncAlways, the directory is flushed to disk before returning, which makes the rename itself durable.
+func (c *item) write(dir string, value []byte, policy SyncPolicy) (err error) {
+	var (
+		path     string
+		itemPath string
+		file     *os.File
+	)
+	path, itemPath = c.getpath(dir)
+	if err = os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	file, err = os.CreateTemp(path, c.Key+tempFileMarker+"*")
+	if err != nil {
+		return err
+	}
+	var tempPath = file.Name()
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(tempPath)
+		}
+	}()
+
+	if err = file.Chmod(0644); err != nil {
+		return err
+	}
+	var data = append(c.header(), value...)
+	if _, err = file.Write(data); err != nil {
+		return err
+	}
+	if policy != SyncNever {
+		if err = file.Sync(); err != nil {
+			return err
+		}
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tempPath, itemPath); err != nil {
+		return err
+	}
+	c.size = int64(len(data))
+	if policy == SyncAlways {
+		return syncDir(path)
+	}
+	return nil
+}
+
+// Read the value of the item, skipping the header of the file.
+//
+// Reports whether the header of the file flags the value as encrypted.
+func (c *item) read(dir string) (value []byte, encrypted bool, err error) {
+	if c.expired(time.Now()) {
+		c.delete(dir)
+		return nil, false, fmt.Errorf("item has expired at %s", c.Expires)
+	}
+
+	var _, itemPath = c.getpath(dir)
+
+	var file *os.File
+	file, err = os.Open(itemPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var r = bufio.NewReader(file)
+	var header item
+	if _, err = header.readHeader(r); err != nil {
+		return nil, false, err
+	}
+	value, err = io.ReadAll(r)
+	return value, header.Encrypted, err
+}
+
+// Read the metadata of the item from the header of its file.
+//
+// Reports whether the file has a header, files written by older versions do not.
+func (c *item) readMeta(dir string) (found bool, err error) {
+	var _, itemPath = c.getpath(dir)
+	var file *os.File
+	if file, err = os.Open(itemPath); err != nil {
+		return false, err
+	}
+	defer file.Close()
+	return c.readHeader(bufio.NewReader(file))
+}
+
+func (c *item) delete(dir string) (err error) {
+	var path, itemPath = c.getpath(dir)
+	err = os.Remove(itemPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return
+	}
+
+	return removeIfEmpty(path)
+}
+
+func removeIfEmpty(path string) (err error) {
+	var files []fs.DirEntry
+	files, err = os.ReadDir(path)
+	if err != nil {
+		return
+	}
+
+	if len(files) == 0 {
+		err = os.Remove(path)
+	}
+
+	return
+}
+
+func (c *item) getpath(dir string) (path, itemPath string) {
+	path = filepath.Join(dir, strconv.FormatUint(c.Hash, 10))
+	itemPath = filepath.Join(path, c.Key)
+	return path, itemPath
+}
+
+func (c *item) Equals(other *item) bool {
+	return c.Key == other.Key
+}
+
+func (c *item) Gt(other *item) bool {
+	return c.Key > other.Key
+}
+
+func (c *item) Lt(other *item) bool {
+	return c.Key < other.Key
+}
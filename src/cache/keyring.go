@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The start of data encrypted by a keyring.
+var encryptedMagic = []byte("NCENC\x00")
+
+// The size of the ID of a key.
+const keyIDSize = 4
+
+type keyringKey struct {
+	// The first bytes of the SHA-256 hash of the key, stored with the data it encrypted.
+	id   [keyIDSize]byte
+	aead cipher.AEAD
+}
+
+// A set of AES keys used to encrypt data at rest with AES-GCM.
+//
+// The first key is the current key, data is always encrypted with it.
+// The other keys are old keys, which are only used to decrypt data encrypted before a key rotation.
+//
+// Encrypted: Magic | Key ID | Nonce | Ciphertext
+//
+// A nil keyring does not encrypt data, and fails to decrypt any data which is encrypted.
+type Keyring struct {
+	keys []keyringKey
+}
+
+// Returns a keyring holding the given keys, the first key is the current key.
+//
+// Keys must be 16, 24 or 32 bytes long, selecting AES-128, AES-192 or AES-256.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("keyring needs at least one key")
+	}
+	var k = &Keyring{keys: make([]keyringKey, 0, len(keys))}
+	for i, key := range keys {
+		var block, err = aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		var sum = sha256.Sum256(key)
+		var kk = keyringKey{aead: aead}
+		copy(kk.id[:], sum[:])
+		k.keys = append(k.keys, kk)
+	}
+	return k, nil
+}
+
+// Parse a keyring from a string holding hex or base64 encoded keys, separated by newlines or commas.
+//
+// The first key is the current key, empty lines and lines starting with '#' are ignored.
+func KeyringFromString(s string) (*Keyring, error) {
+	var keys [][]byte
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var key, err = hex.DecodeString(line)
+		if err != nil {
+			key, err = base64.StdEncoding.DecodeString(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d is not hex or base64 encoded", len(keys)+1)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeyring(keys...)
+}
+
+// Read a keyring from a key file, holding one hex or base64 encoded key per line.
+//
+// The key on the first line is the current key, the keys below it are old keys.
+func ReadKeyFile(path string) (*Keyring, error) {
+	var data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return KeyringFromString(string(data))
+}
+
+// Reports whether the data was encrypted by a keyring.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+// Returns the key which encrypted the data, or nil if the keyring does not hold it.
+func (k *Keyring) key(data []byte) *keyringKey {
+	if k == nil || len(data) < len(encryptedMagic)+keyIDSize {
+		return nil
+	}
+	var id = data[len(encryptedMagic) : len(encryptedMagic)+keyIDSize]
+	for i := range k.keys {
+		if bytes.Equal(k.keys[i].id[:], id) {
+			return &k.keys[i]
+		}
+	}
+	return nil
+}
+
+// Encrypt the data with the current key.
+//
+// The additional data is authenticated but not stored, the same additional data must be passed to Decrypt.
+// A nil keyring returns the data as it is.
+func (k *Keyring) Encrypt(data, additional []byte) ([]byte, error) {
+	if k == nil {
+		return data, nil
+	}
+	var key = &k.keys[0]
+	var size = len(encryptedMagic) + keyIDSize + key.aead.NonceSize()
+	var b = make([]byte, size, size+len(data)+key.aead.Overhead())
+	copy(b, encryptedMagic)
+	copy(b[len(encryptedMagic):], key.id[:])
+	var nonce = b[len(encryptedMagic)+keyIDSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return key.aead.Seal(b, nonce, data, additional), nil
+}
+
+// Decrypt data encrypted by Encrypt with any of the keys, data which is not encrypted is returned as it is.
+//
+// Data which is not encrypted is recognized by its start, so values which may start like encrypted data
+// should be stored along with whether they are encrypted, like the FileCache does.
+//
+// Returns ErrWrongKey if the data was encrypted with a key which is not in the keyring,
+// and ErrCorruptValue if the data fails to authenticate.
+func (k *Keyring) Decrypt(data, additional []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	var key = k.key(data)
+	if key == nil {
+		return nil, ErrWrongKey
+	}
+	var offset = len(encryptedMagic) + keyIDSize
+	if len(data) < offset+key.aead.NonceSize()+key.aead.Overhead() {
+		return nil, fmt.Errorf("%w: encrypted data is truncated", ErrCorruptValue)
+	}
+	var nonce = data[offset : offset+key.aead.NonceSize()]
+	var plaintext, err = key.aead.Open(nil, nonce, data[offset+len(nonce):], additional)
+	if err != nil {
+		return nil, fmt.Errorf("%w: encrypted data failed to authenticate", ErrCorruptValue)
+	}
+	return plaintext, nil
+}
+
+// Reports whether the data should be encrypted again with the current key.
+//
+// Data which is not encrypted, or was encrypted with an old key, needs to be rotated.
+func (k *Keyring) NeedsRotation(data []byte) bool {
+	if k == nil {
+		return false
+	}
+	return !IsEncrypted(data) || k.key(data) != &k.keys[0]
+}
@@ -0,0 +1,330 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// The clients blocked on popping from the lists of a cache.
+//
+// Every list has its own queue, so waiting clients are served in the order they started waiting.
+type listWaiters struct {
+	mu     sync.Mutex
+	queues map[string][]*listWaiter
+}
+
+// A client blocked on popping from a list.
+type listWaiter struct {
+	// Pop from the left end of the list, instead of the right end.
+	left bool
+	// Receives the popped value, buffered so serving the waiter never blocks.
+	//
+	// Closed if the waiter stopped waiting while a value was reserved for it, and the value was not stored.
+	value chan []byte
+	// The waiter stopped waiting, it is not put back in the queue.
+	abandoned bool
+}
+
+// A value reserved for a waiter, handed over once the list it was popped from has been stored.
+type listDelivery struct {
+	waiter *listWaiter
+	value  []byte
+}
+
+// Add a waiter to the end of the queue of the list.
+func (w *listWaiters) add(key string, left bool) *listWaiter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var waiter = &listWaiter{
+		left:  left,
+		value: make(chan []byte, 1),
+	}
+	w.queues[key] = append(w.queues[key], waiter)
+	return waiter
+}
+
+// Remove a waiter from the queue of the list, reports whether it was still waiting.
+//
+// A waiter which is no longer waiting has a value reserved for it,
+// it receives the value, or its channel is closed if the value was not stored.
+func (w *listWaiters) remove(key string, waiter *listWaiter) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var queue = w.queues[key]
+	for i, queued := range queue {
+		if queued == waiter {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			if len(queue) == 0 {
+				delete(w.queues, key)
+			} else {
+				w.queues[key] = queue
+			}
+			return true
+		}
+	}
+	waiter.abandoned = true
+	return false
+}
+
+// Reserve values of the list for the waiters of the list, in the order they started waiting.
+//
+// Returns the remaining values of the list, and the values reserved for the waiters.
+// The values must be delivered once the list has been stored, or cancelled if it could not be stored.
+func (w *listWaiters) serve(key string, list [][]byte) ([][]byte, []listDelivery) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var queue = w.queues[key]
+	var deliveries []listDelivery
+	for len(queue) > 0 && len(list) > 0 {
+		var waiter = queue[0]
+		queue = queue[1:]
+		if waiter.left {
+			deliveries = append(deliveries, listDelivery{waiter: waiter, value: list[0]})
+			list = list[1:]
+		} else {
+			deliveries = append(deliveries, listDelivery{waiter: waiter, value: list[len(list)-1]})
+			list = list[:len(list)-1]
+		}
+	}
+	if len(queue) == 0 {
+		delete(w.queues, key)
+	} else {
+		w.queues[key] = queue
+	}
+	return list, deliveries
+}
+
+// Hand the reserved values over to their waiters.
+func (w *listWaiters) deliver(deliveries []listDelivery) {
+	for _, d := range deliveries {
+		d.waiter.value <- d.value
+	}
+}
+
+// Put the waiters of values which could not be stored back at the front of the queue of the list, in order.
+//
+// Waiters which stopped waiting in the meantime are woken up without a value.
+func (w *listWaiters) cancel(key string, deliveries []listDelivery) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var waiting = make([]*listWaiter, 0, len(deliveries)+len(w.queues[key]))
+	for _, d := range deliveries {
+		if d.waiter.abandoned {
+			close(d.waiter.value)
+			continue
+		}
+		waiting = append(waiting, d.waiter)
+	}
+	if len(waiting) > 0 {
+		w.queues[key] = append(waiting, w.queues[key]...)
+	}
+}
+
+// Decode the values of a list.
+func decodeList(e *Entry) ([][]byte, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return decodeValues(e.Value)
+}
+
+// Atomically update the values of the list stored under the key.
+//
+// The list is created if it does not exist, and deleted when its last value is removed.
+// A list is stored as a single value, so every update decodes and encodes the whole list,
+// and disk backends write the whole list again. Pushing and popping takes time proportional to the length of the list,
+// lists are meant for short queues.
+func (c commands) updateList(key string, fn func(list [][]byte) ([][]byte, error)) error {
+	return c.update(key, func(e *Entry) (*Entry, error) {
+		if err := checkType(e, ListValue); err != nil {
+			return nil, err
+		}
+		var list, err = decodeList(e)
+		if err != nil {
+			return nil, err
+		}
+		if list, err = fn(list); err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, nil
+		}
+		if e == nil {
+			e = &Entry{Type: ListValue}
+		}
+		e.Value = encodeValues(list)
+		return e, nil
+	})
+}
+
+// Returns the values of the list stored under the key, a missing key is an empty list.
+func (c commands) viewList(key string) ([][]byte, error) {
+	var e, err = c.store.GetEntry(key)
+	if err != nil {
+		if ErrItemNotFound.Is(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err = checkType(e, ListValue); err != nil {
+		countWrongType(c.store, key)
+		return nil, err
+	}
+	return decodeList(e)
+}
+
+// Push values to the list, returning the length of the list after the push.
+//
+// Pushed values are popped for blocked clients before they are stored,
+// the clients receive them once the rest of the list has been stored.
+func (c commands) push(key string, left bool, values [][]byte) (length int, err error) {
+	var deliveries []listDelivery
+	err = c.updateList(key, func(list [][]byte) ([][]byte, error) {
+		if left {
+			var pushed = make([][]byte, 0, len(values)+len(list))
+			for i := len(values) - 1; i >= 0; i-- {
+				pushed = append(pushed, values[i])
+			}
+			list = append(pushed, list...)
+		} else {
+			list = append(list, values...)
+		}
+		length = len(list)
+		list, deliveries = c.waiters.serve(key, list)
+		return list, nil
+	})
+	if err != nil {
+		c.waiters.cancel(key, deliveries)
+		return 0, err
+	}
+	c.waiters.deliver(deliveries)
+	return length, nil
+}
+
+// Pop a value from the list.
+//
+// If the list is empty and timeout is positive, the client waits up to the timeout for a value to be pushed.
+func (c commands) pop(key string, left bool, timeout time.Duration) (value []byte, err error) {
+	var waiter *listWaiter
+	err = c.updateList(key, func(list [][]byte) ([][]byte, error) {
+		if len(list) == 0 {
+			if timeout <= 0 {
+				return nil, ErrItemNotFound
+			}
+			// Registered while the list is locked, so no push can be missed.
+			waiter = c.waiters.add(key, left)
+			return nil, errSkipUpdate
+		}
+		if left {
+			value = list[0]
+			return list[1:], nil
+		}
+		value = list[len(list)-1]
+		return list[:len(list)-1], nil
+	})
+	if err != nil || waiter == nil {
+		return value, err
+	}
+
+	var timer = time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case value = <-waiter.value:
+		return value, nil
+	case <-timer.C:
+		if c.waiters.remove(key, waiter) {
+			return nil, ErrItemNotFound
+		}
+		// A value was reserved for the waiter right before the timeout.
+		if value, ok := <-waiter.value; ok {
+			return value, nil
+		}
+		return nil, ErrItemNotFound
+	}
+}
+
+// Push values to the head of the list stored under the key, returning the length of the list.
+//
+// The values are pushed one after the other, so the last value ends up at the head of the list.
+func (c commands) LPush(key string, values ...[]byte) (length int, err error) {
+	return c.push(key, true, values)
+}
+
+// Push values to the tail of the list stored under the key, returning the length of the list.
+func (c commands) RPush(key string, values ...[]byte) (length int, err error) {
+	return c.push(key, false, values)
+}
+
+// Pop the value at the head of the list stored under the key.
+//
+// Returns ErrItemNotFound if the list is empty.
+func (c commands) LPop(key string) ([]byte, error) {
+	return c.pop(key, true, 0)
+}
+
+// Pop the value at the tail of the list stored under the key.
+//
+// Returns ErrItemNotFound if the list is empty.
+func (c commands) RPop(key string) ([]byte, error) {
+	return c.pop(key, false, 0)
+}
+
+// Pop the value at the head of the list stored under the key, waiting up to the timeout for a value.
+//
+// Clients waiting on the same list are served in the order they started waiting.
+// Returns ErrItemNotFound if no value was pushed before the timeout.
+func (c commands) BLPop(key string, timeout time.Duration) ([]byte, error) {
+	return c.pop(key, true, timeout)
+}
+
+// Pop the value at the tail of the list stored under the key, waiting up to the timeout for a value.
+//
+// Clients waiting on the same list are served in the order they started waiting.
+// Returns ErrItemNotFound if no value was pushed before the timeout.
+func (c commands) BRPop(key string, timeout time.Duration) ([]byte, error) {
+	return c.pop(key, false, timeout)
+}
+
+// Returns the values of the list stored under the key from start to stop, inclusive.
+//
+// Negative indices count from the end of the list, -1 is the last value.
+func (c commands) LRange(key string, start int, stop int) ([][]byte, error) {
+	var list, err = c.viewList(key)
+	if err != nil {
+		return nil, err
+	}
+	var from, to = rankRange(len(list), start, stop)
+	return list[from:to:to], nil
+}
+
+// Turn an inclusive range of indices into a slice range of a sequence of the given length.
+//
+// Negative indices count from the end of the sequence, -1 is the last index.
+// The indices are clamped to the sequence, an empty range is returned as from == to.
+func rankRange(length int, start int, stop int) (from int, to int) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop {
+		return 0, 0
+	}
+	return start, stop + 1
+}
+
+// Returns the length of the list stored under the key.
+func (c commands) LLen(key string) (int, error) {
+	var list, err = c.viewList(key)
+	if err != nil {
+		return 0, err
+	}
+	return len(list), nil
+}
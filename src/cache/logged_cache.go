@@ -0,0 +1,374 @@
+package cache
+
+import "time"
+
+// The size at which an append-only log is rewritten, if no size is given.
+const DefaultRewriteSize int64 = 64 << 20
+
+// A cache which records every change in an append-only log.
+//
+// The log is replayed into the cache when it is opened, so the contents of the cache survive a restart.
+// Changes are recorded as the resulting item, so a record can be applied more than once.
+// When the log has doubled in size since it was last rewritten, and is larger than the rewrite size,
+// it is rewritten from the contents of the cache in the background.
+type LoggedCache struct {
+	Cache
+
+	log          *appendLog
+	syncInterval time.Duration
+	closed       chan struct{}
+}
+
+// Open the append-only log at the path, and replay it into the cache.
+//
+// A rewrite size of zero uses DefaultRewriteSize, a negative rewrite size never rewrites the log.
+// If the end of the log was partially written it is cut off, and an integrity error is returned with the cache.
+// If a record in the middle of the log is corrupt, an error matching ErrCorruptValue is returned without a cache.
+func NewLoggedCache(c Cache, path string, policy SyncPolicy, rewriteSize int64) (*LoggedCache, error) {
+	if rewriteSize == 0 {
+		rewriteSize = DefaultRewriteSize
+	}
+	var log, err = openLog(path, c, policy, rewriteSize)
+	if log == nil {
+		return nil, err
+	}
+	return &LoggedCache{
+		Cache:        c,
+		log:          log,
+		syncInterval: DefaultSyncInterval,
+		closed:       make(chan struct{}),
+	}, err
+}
+
+// Run the cache, and flush the log periodically if the sync policy is SyncPeriodic.
+func (c *LoggedCache) Run(interval time.Duration) {
+	c.Cache.Run(interval)
+	if c.log.syncPolicy == SyncPeriodic {
+		go c.work()
+	}
+}
+
+func (c *LoggedCache) work() {
+	var ticker = time.NewTicker(c.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			c.log.sync()
+		}
+	}
+}
+
+// Close the log and the cache.
+func (c *LoggedCache) Close() {
+	close(c.closed)
+	c.log.close()
+	c.Cache.Close()
+}
+
+// Apply a change to the cache and append the record built by record to the log.
+//
+// Both happen while holding the mutex of the log, so the records are in the order of the changes.
+// No record is appended if the change fails.
+func (c *LoggedCache) change(apply func() error, record func() (*logRecord, error)) error {
+	c.log.mu.Lock()
+	var err = apply()
+	var rewrite bool
+	if err == nil {
+		var r *logRecord
+		if r, err = record(); err == nil && r != nil {
+			rewrite, err = c.log.append(r)
+		}
+	}
+	c.log.mu.Unlock()
+	if rewrite {
+		c.log.rewrites.Add(1)
+		go func() {
+			defer c.log.rewrites.Done()
+			c.log.rewrite(c.Cache)
+		}()
+	}
+	return err
+}
+
+// Returns a function which records the current item stored under the key, or its deletion.
+func (c *LoggedCache) stored(key string) func() (*logRecord, error) {
+	return func() (*logRecord, error) {
+		var e, err = peekEntry(c.Cache, key)
+		if err != nil {
+			if ErrItemNotFound.Is(err) {
+				return &logRecord{op: logDelete, key: key}, nil
+			}
+			return nil, err
+		}
+		return &logRecord{op: logSet, key: key, e: e}, nil
+	}
+}
+
+// Returns a function which builds a fixed record.
+func recorded(r *logRecord) func() (*logRecord, error) {
+	return func() (*logRecord, error) {
+		return r, nil
+	}
+}
+
+// Record the current item stored under the key, after it was changed without holding the mutex of the log.
+//
+// Used by commands which block, and cannot hold the mutex while they wait.
+func (c *LoggedCache) recordStored(key string) error {
+	return c.change(func() error { return nil }, c.stored(key))
+}
+
+func (c *LoggedCache) peekEntry(key string) (*Entry, error) {
+	return peekEntry(c.Cache, key)
+}
+
+func (c *LoggedCache) countWrongType(key string) {
+	countWrongType(c.Cache, key)
+}
+
+func (c *LoggedCache) Set(key string, value []byte, ttl time.Duration, tags ...string) (inserted bool, err error) {
+	err = c.change(func() (err error) {
+		inserted, err = c.Cache.Set(key, value, ttl, tags...)
+		return err
+	}, c.stored(key))
+	return inserted, err
+}
+
+func (c *LoggedCache) SetEntry(key string, e *Entry) error {
+	return c.change(func() error {
+		return c.Cache.SetEntry(key, e)
+	}, c.stored(key))
+}
+
+func (c *LoggedCache) Delete(key string) (deleted bool, err error) {
+	err = c.change(func() (err error) {
+		deleted, err = c.Cache.Delete(key)
+		return err
+	}, recorded(&logRecord{op: logDelete, key: key}))
+	return deleted, err
+}
+
+func (c *LoggedCache) Clear() error {
+	return c.change(c.Cache.Clear, recorded(&logRecord{op: logClear}))
+}
+
+func (c *LoggedCache) InvalidateTag(tag string) (deleted int, err error) {
+	err = c.change(func() (err error) {
+		deleted, err = c.Cache.InvalidateTag(tag)
+		return err
+	}, recorded(&logRecord{op: logInvalidate, key: tag}))
+	return deleted, err
+}
+
+func (c *LoggedCache) Incr(key string, delta int64, initial int64, ttl time.Duration) (value int64, err error) {
+	err = c.change(func() (err error) {
+		value, err = c.Cache.Incr(key, delta, initial, ttl)
+		return err
+	}, c.stored(key))
+	return value, err
+}
+
+func (c *LoggedCache) CompareAndSwap(key string, value []byte, ttl time.Duration, version uint64) (newVersion uint64, err error) {
+	err = c.change(func() (err error) {
+		newVersion, err = c.Cache.CompareAndSwap(key, value, ttl, version)
+		return err
+	}, c.stored(key))
+	return newVersion, err
+}
+
+func (c *LoggedCache) SetNX(key string, value []byte, ttl time.Duration) (set bool, err error) {
+	err = c.change(func() (err error) {
+		set, err = c.Cache.SetNX(key, value, ttl)
+		return err
+	}, c.stored(key))
+	return set, err
+}
+
+func (c *LoggedCache) Replace(key string, value []byte, ttl time.Duration) (replaced bool, err error) {
+	err = c.change(func() (err error) {
+		replaced, err = c.Cache.Replace(key, value, ttl)
+		return err
+	}, c.stored(key))
+	return replaced, err
+}
+
+func (c *LoggedCache) GetAndSet(key string, value []byte, ttl time.Duration) (old *Entry, err error) {
+	err = c.change(func() (err error) {
+		old, err = c.Cache.GetAndSet(key, value, ttl)
+		return err
+	}, c.stored(key))
+	return old, err
+}
+
+func (c *LoggedCache) GetAndDelete(key string) (old *Entry, err error) {
+	err = c.change(func() (err error) {
+		old, err = c.Cache.GetAndDelete(key)
+		return err
+	}, recorded(&logRecord{op: logDelete, key: key}))
+	return old, err
+}
+
+func (c *LoggedCache) Touch(key string, ttl time.Duration) error {
+	return c.Expire(key, expiresAt(ttl))
+}
+
+func (c *LoggedCache) Expire(key string, at time.Time) error {
+	return c.change(func() error {
+		return c.Cache.Expire(key, at)
+	}, recorded(&logRecord{op: logExpire, key: key, e: &Entry{Expires: at}}))
+}
+
+func (c *LoggedCache) Persist(key string) error {
+	return c.Expire(key, time.Time{})
+}
+
+func (c *LoggedCache) HSet(key string, fields map[string][]byte) (added int, err error) {
+	err = c.change(func() (err error) {
+		added, err = c.Cache.HSet(key, fields)
+		return err
+	}, c.stored(key))
+	return added, err
+}
+
+func (c *LoggedCache) HDel(key string, fields ...string) (deleted int, err error) {
+	err = c.change(func() (err error) {
+		deleted, err = c.Cache.HDel(key, fields...)
+		return err
+	}, c.stored(key))
+	return deleted, err
+}
+
+func (c *LoggedCache) HIncrBy(key string, field string, delta int64) (value int64, err error) {
+	err = c.change(func() (err error) {
+		value, err = c.Cache.HIncrBy(key, field, delta)
+		return err
+	}, c.stored(key))
+	return value, err
+}
+
+func (c *LoggedCache) LPush(key string, values ...[]byte) (length int, err error) {
+	err = c.change(func() (err error) {
+		length, err = c.Cache.LPush(key, values...)
+		return err
+	}, c.stored(key))
+	return length, err
+}
+
+func (c *LoggedCache) RPush(key string, values ...[]byte) (length int, err error) {
+	err = c.change(func() (err error) {
+		length, err = c.Cache.RPush(key, values...)
+		return err
+	}, c.stored(key))
+	return length, err
+}
+
+func (c *LoggedCache) LPop(key string) (value []byte, err error) {
+	err = c.change(func() (err error) {
+		value, err = c.Cache.LPop(key)
+		return err
+	}, c.stored(key))
+	return value, err
+}
+
+func (c *LoggedCache) RPop(key string) (value []byte, err error) {
+	err = c.change(func() (err error) {
+		value, err = c.Cache.RPop(key)
+		return err
+	}, c.stored(key))
+	return value, err
+}
+
+func (c *LoggedCache) BLPop(key string, timeout time.Duration) ([]byte, error) {
+	var value, err = c.Cache.BLPop(key, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return value, c.recordStored(key)
+}
+
+func (c *LoggedCache) BRPop(key string, timeout time.Duration) ([]byte, error) {
+	var value, err = c.Cache.BRPop(key, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return value, c.recordStored(key)
+}
+
+func (c *LoggedCache) SAdd(key string, members ...string) (added int, err error) {
+	err = c.change(func() (err error) {
+		added, err = c.Cache.SAdd(key, members...)
+		return err
+	}, c.stored(key))
+	return added, err
+}
+
+func (c *LoggedCache) SRem(key string, members ...string) (removed int, err error) {
+	err = c.change(func() (err error) {
+		removed, err = c.Cache.SRem(key, members...)
+		return err
+	}, c.stored(key))
+	return removed, err
+}
+
+func (c *LoggedCache) ZAdd(key string, members ...ScoredMember) (added int, err error) {
+	err = c.change(func() (err error) {
+		added, err = c.Cache.ZAdd(key, members...)
+		return err
+	}, c.stored(key))
+	return added, err
+}
+
+func (c *LoggedCache) ZIncrBy(key string, member string, delta float64) (score float64, err error) {
+	err = c.change(func() (err error) {
+		score, err = c.Cache.ZIncrBy(key, member, delta)
+		return err
+	}, c.stored(key))
+	return score, err
+}
+
+func (c *LoggedCache) ZRemRangeByRank(key string, start int, stop int) (removed int, err error) {
+	err = c.change(func() (err error) {
+		removed, err = c.Cache.ZRemRangeByRank(key, start, stop)
+		return err
+	}, c.stored(key))
+	return removed, err
+}
+
+func (c *LoggedCache) ZRemRangeByScore(key string, min float64, max float64) (removed int, err error) {
+	err = c.change(func() (err error) {
+		removed, err = c.Cache.ZRemRangeByScore(key, min, max)
+		return err
+	}, c.stored(key))
+	return removed, err
+}
+
+// Load the cache from bytes, the loaded items replace the contents of the log.
+func (c *LoggedCache) Load(data []byte) error {
+	c.log.mu.Lock()
+	defer c.log.mu.Unlock()
+	var err = c.Cache.Load(data)
+	if err != nil && !IsIntegrityError(err) {
+		return err
+	}
+	if _, appendErr := c.log.append(&logRecord{op: logClear}); appendErr != nil {
+		return appendErr
+	}
+	for _, key := range c.Cache.Keys() {
+		var r, recordErr = c.stored(key)()
+		if recordErr != nil {
+			return recordErr
+		}
+		if _, appendErr := c.log.append(r); appendErr != nil {
+			return appendErr
+		}
+	}
+	return err
+}
+
+// Rewrite the log from the contents of the cache.
+func (c *LoggedCache) Rewrite() error {
+	return c.log.rewrite(c.Cache)
+}
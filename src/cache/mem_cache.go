@@ -1,159 +1,600 @@
-package cache
-
-import (
-	"bytes"
-	"encoding/json"
-	"sync"
-	"time"
-)
-
-// A simple in-memory cache implementation based on a map of string[TYPE].
-type MemoryCache[T any] struct {
-	cache           map[string]*memitem[T]
-	cleanupInterval time.Duration
-	cleanupTicker   *time.Ticker
-	closed          chan struct{}
-	mu              sync.Mutex
-	lastTick        time.Time
-}
-
-// Returns a new in-memory cache.
-func NewMemoryCache() Cache {
-	return NewGenericMemoryCache[[]byte]()
-}
-
-// Dump the cache to bytes.
-func (c *MemoryCache[T]) Dump() ([]byte, error) {
-	var buf bytes.Buffer
-	var enc = json.NewEncoder(&buf)
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	err := enc.Encode(c.cache)
-	if err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
-}
-
-// Load the cache from bytes.
-func (c *MemoryCache[T]) Load(data []byte) error {
-	var buf = bytes.NewBuffer(data)
-	var dec = json.NewDecoder(buf)
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	err := dec.Decode(&c.cache)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// Might as well make it generic, right?
-func NewGenericMemoryCache[T any]() *MemoryCache[T] {
-	return &MemoryCache[T]{
-		cache:  make(map[string]*memitem[T]),
-		closed: make(chan struct{}),
-	}
-}
-
-func (c *MemoryCache[T]) Run(interval time.Duration) {
-	c.closed = make(chan struct{})
-	c.cleanupInterval = interval
-	go c.work()
-}
-
-func (c *MemoryCache[T]) Set(key string, value T, ttl time.Duration) (inserted bool, err error) {
-	var item *memitem[T]
-	item = &memitem[T]{
-		Key:   key,
-		Value: value,
-		TTL:   ttl,
-	}
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.cache[key] = item
-	return true, nil
-}
-
-func (c *MemoryCache[T]) Get(key string) (value T, ttl time.Duration, err error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var item, ok = c.cache[key]
-	if !ok {
-		return value, 0, ErrItemNotFound
-	}
-	item.TTL -= time.Since(c.lastTick)
-	return item.Value, item.TTL, nil
-}
-
-func (c *MemoryCache[T]) Delete(key string) (deleted bool, err error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var _, ok = c.cache[key]
-	if !ok {
-		return false, ErrItemNotFound
-	}
-	delete(c.cache, key)
-	return true, nil
-}
-
-func (c *MemoryCache[T]) Clear() (err error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.cache = make(map[string]*memitem[T])
-	return nil
-}
-
-func (c *MemoryCache[T]) Keys() []string {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var keys = make([]string, 0, len(c.cache))
-	for key := range c.cache {
-		keys = append(keys, key)
-	}
-	return keys
-}
-
-func (c *MemoryCache[T]) Close() {
-	close(c.closed)
-}
-
-func (c *MemoryCache[T]) Len() int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return len(c.cache)
-}
-
-func (c *MemoryCache[T]) Has(key string) (ttl time.Duration, has bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	var item, ok = c.cache[key]
-	if !ok {
-		return 0, false
-	}
-	item.TTL -= time.Since(c.lastTick)
-	return item.TTL, true
-}
-
-func (c *MemoryCache[T]) work() {
-	c.cleanupTicker = time.NewTicker(c.cleanupInterval)
-	c.lastTick = time.Now()
-	for {
-		select {
-		case <-c.cleanupTicker.C:
-			c.mu.Lock()
-			for key, item := range c.cache {
-				item.TTL -= time.Since(c.lastTick)
-				if item.TTL <= 0 {
-					delete(c.cache, key)
-				}
-			}
-			c.lastTick = time.Now()
-			c.mu.Unlock()
-		case <-c.closed:
-			c.cleanupTicker.Stop()
-			return
-		}
-	}
-}
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// A simple in-memory cache implementation based on a map of string[TYPE].
+//
+// Reads only take a read lock, so they can run in parallel.
+//
+// The cache can optionally be bounded by a maximum amount of items and/or bytes,
+// items are evicted by the configured eviction policy when the limits are exceeded.
+type MemoryCache[T any] struct {
+	commands
+
+	cache           map[string]*memitem[T]
+	cleanupInterval time.Duration
+	cleanupTicker   *time.Ticker
+	closed          chan struct{}
+	mu              sync.RWMutex
+
+	// The last version assigned to an item.
+	version uint64
+	// The keys stored under each tag.
+	tags tagIndex
+
+	maxItems int
+	maxBytes int64
+	bytes    int64
+	evictor  evictor
+	// Guards the evictor while reads hold the read lock.
+	evictorMu sync.Mutex
+
+	// The items removed while the mutex is held, reported to the observer once it is released.
+	removed removals
+	stats   counters
+}
+
+// Returns a new in-memory cache.
+func NewMemoryCache() Cache {
+	return NewGenericMemoryCache[[]byte]()
+}
+
+// Returns a new in-memory cache, bounded by the maximum amount of items and bytes.
+//
+// A limit of zero or less means the cache is not bounded by that limit.
+func NewBoundedMemoryCache(maxItems int, maxBytes int64, policy EvictionPolicy) Cache {
+	return NewGenericBoundedMemoryCache[[]byte](maxItems, maxBytes, policy)
+}
+
+// Dump the cache to bytes.
+//
+// Caches storing byte slices are dumped as a snapshot, which can be loaded by any cache.
+// Other caches are dumped as JSON.
+func (c *MemoryCache[T]) Dump() ([]byte, error) {
+	if !storesBytes[T]() {
+		var buf bytes.Buffer
+		var enc = json.NewEncoder(&buf)
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		err := enc.Encode(c.cache)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var w = newSnapshotWriter()
+	if err := c.snapshot(w); err != nil {
+		return nil, err
+	}
+	return w.bytes(), nil
+}
+
+// Add the unexpired items in the cache to a snapshot.
+func (c *MemoryCache[T]) snapshot(w *snapshotWriter) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var now = time.Now()
+	for key, item := range c.cache {
+		if item.expired(now) {
+			continue
+		}
+		var e, err = item.entry()
+		if err != nil {
+			return err
+		}
+		w.add(key, e)
+	}
+	return nil
+}
+
+// Load the cache from bytes.
+//
+// Both snapshots and JSON dumps made by older versions are loaded.
+func (c *MemoryCache[T]) Load(data []byte) error {
+	var items map[string]*memitem[T]
+	var err error
+	if isSnapshot(data) {
+		items, err = snapshotItems[T](data)
+	} else {
+		items, err = decodeJSONItems[T](data)
+	}
+	if err != nil {
+		return err
+	}
+	c.load(items)
+	return nil
+}
+
+// An item in a JSON dump.
+//
+// The oldest dumps hold the remaining time to live of the item instead of its expiry deadline.
+type jsonItem[T any] struct {
+	memitem[T]
+	TTL *time.Duration
+}
+
+// Decode the items in a JSON dump.
+//
+// The time to live of items in the oldest dumps is turned into a deadline relative to now,
+// items which had no time to live left are skipped.
+func decodeJSONItems[T any](data []byte) (map[string]*memitem[T], error) {
+	var dumped map[string]*jsonItem[T]
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&dumped); err != nil {
+		return nil, err
+	}
+	var now = time.Now()
+	var items = make(map[string]*memitem[T], len(dumped))
+	for key, item := range dumped {
+		if item == nil {
+			continue
+		}
+		if item.TTL != nil && item.Expires.IsZero() {
+			if *item.TTL <= 0 {
+				continue
+			}
+			item.Expires = now.Add(*item.TTL)
+		}
+		items[key] = &item.memitem
+	}
+	return items, nil
+}
+
+// Reports whether the values of a cache are byte slices.
+func storesBytes[T any]() bool {
+	var _, ok = any(*new(T)).([]byte)
+	return ok
+}
+
+// Decode the items in a snapshot, only supported if the values of the cache are byte slices.
+func snapshotItems[T any](data []byte) (map[string]*memitem[T], error) {
+	if !storesBytes[T]() {
+		return nil, ErrNotBytes
+	}
+	var items = make(map[string]*memitem[T])
+	var err = readSnapshot(data, func(key string, e *Entry) error {
+		items[key] = &memitem[T]{
+			Key:     key,
+			Value:   any(e.Value).(T),
+			Expires: e.Expires,
+			Version: e.Version,
+			Tags:    e.Tags,
+			Type:    e.Type,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Replace the items in the cache.
+//
+// Rebuilds the bookkeeping of the bounded cache,
+// dropping any items which expired while the cache was dumped.
+func (c *MemoryCache[T]) load(items map[string]*memitem[T]) {
+	c.mu.Lock()
+	defer c.unlock()
+	if items == nil {
+		items = make(map[string]*memitem[T])
+	}
+	c.cache = items
+
+	var now = time.Now()
+	c.bytes = 0
+	c.tags = make(tagIndex)
+	if c.evictor != nil {
+		c.evictor.clear()
+	}
+	for key, item := range c.cache {
+		if item.expired(now) {
+			delete(c.cache, key)
+			continue
+		}
+		if item.Version > c.version {
+			c.version = item.Version
+		}
+		c.bytes += item.size()
+		c.tags.add(key, item.Tags)
+		if c.evictor != nil {
+			c.evictor.add(key)
+		}
+	}
+	c.evict("")
+}
+
+// Might as well make it generic, right?
+func NewGenericMemoryCache[T any]() *MemoryCache[T] {
+	var c = &MemoryCache[T]{
+		cache:  make(map[string]*memitem[T]),
+		closed: make(chan struct{}),
+		tags:   make(tagIndex),
+	}
+	c.commands = newCommands(c)
+	return c
+}
+
+// Returns a new generic in-memory cache, bounded by the maximum amount of items and bytes.
+func NewGenericBoundedMemoryCache[T any](maxItems int, maxBytes int64, policy EvictionPolicy) *MemoryCache[T] {
+	var c = NewGenericMemoryCache[T]()
+	c.maxItems = maxItems
+	c.maxBytes = maxBytes
+	if maxItems > 0 || maxBytes > 0 {
+		c.evictor = newEvictor(policy)
+	}
+	return c
+}
+
+func (c *MemoryCache[T]) Run(interval time.Duration) {
+	c.closed = make(chan struct{})
+	c.cleanupInterval = interval
+	go c.work()
+}
+
+// Set an item in the cache, the item can be invalidated by any of its tags.
+func (c *MemoryCache[T]) Set(key string, value T, ttl time.Duration, tags ...string) (inserted bool, err error) {
+	var item *memitem[T]
+	item = &memitem[T]{
+		Key:     key,
+		Value:   value,
+		Expires: expiresAt(ttl),
+		Tags:    tags,
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+	if err = c.set(key, item); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Atomically update an item in the cache.
+//
+// Only supported if the values of the cache are byte slices.
+func (c *MemoryCache[T]) update(key string, fn func(e *Entry) (*Entry, error)) error {
+	c.mu.Lock()
+	defer c.unlock()
+
+	var old *Entry
+	var err error
+	if item, ok := c.cache[key]; ok && !item.expired(time.Now()) {
+		if old, err = item.entry(); err != nil {
+			return err
+		}
+	}
+
+	e, err := fn(old)
+	if err != nil {
+		return err
+	}
+
+	if e == nil {
+		c.remove(key, RemovedDeleted)
+		return nil
+	}
+
+	var value, ok = any(e.Value).(T)
+	if !ok {
+		return ErrNotBytes
+	}
+	var item = &memitem[T]{
+		Key:     key,
+		Value:   value,
+		Expires: e.Expires,
+		Tags:    e.Tags,
+		Type:    e.Type,
+	}
+	if err = c.set(key, item); err != nil {
+		return err
+	}
+	e.Version = item.Version
+	return nil
+}
+
+// Store a copy of an entry under the key, keeping its version.
+//
+// Used by caches built on top of the in-memory cache, which assign the versions of their items.
+func (c *MemoryCache[T]) restore(key string, e *Entry) error {
+	var value, ok = any(e.Value).(T)
+	if !ok {
+		return ErrNotBytes
+	}
+	var item = &memitem[T]{
+		Key:     key,
+		Value:   value,
+		Expires: e.Expires,
+		Tags:    e.Tags,
+		Type:    e.Type,
+	}
+	c.mu.Lock()
+	defer c.unlock()
+	if err := c.set(key, item); err != nil {
+		return err
+	}
+	item.Version = e.Version
+	return nil
+}
+
+// Store an item in the cache under a new version, evicting other items if needed.
+//
+// The mutex must be held.
+func (c *MemoryCache[T]) set(key string, item *memitem[T]) error {
+	var size = item.size()
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return ErrItemTooLarge
+	}
+
+	c.version++
+	item.Version = c.version
+	c.stats.sets.Add(1)
+
+	if old, ok := c.cache[key]; ok {
+		c.bytes -= old.size()
+		c.tags.remove(key, old.Tags)
+	}
+	c.cache[key] = item
+	c.bytes += size
+	c.tags.add(key, item.Tags)
+	if c.evictor != nil {
+		c.evictor.add(key)
+	}
+	c.evict(key)
+	return nil
+}
+
+// Get an item from the cache.
+//
+// Expired items are left for the cleanup to remove.
+// Returns ErrWrongType if the item is not a string.
+func (c *MemoryCache[T]) Get(key string) (value T, ttl time.Duration, err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var item, ok = c.cache[key]
+	if !ok || item.expired(time.Now()) {
+		c.stats.read(false)
+		return value, 0, ErrItemNotFound
+	}
+	if item.Type != StringValue {
+		c.stats.read(false)
+		return value, 0, ErrWrongType
+	}
+	c.stats.read(true)
+	if c.evictor != nil {
+		c.evictorMu.Lock()
+		c.evictor.access(key)
+		c.evictorMu.Unlock()
+	}
+	return item.Value, item.ttl(), nil
+}
+
+// Get a copy of an item from the cache, including its metadata.
+//
+// Only supported if the values of the cache are byte slices.
+func (c *MemoryCache[T]) GetEntry(key string) (*Entry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var item, ok = c.cache[key]
+	if !ok || item.expired(time.Now()) {
+		c.stats.read(false)
+		return nil, ErrItemNotFound
+	}
+	c.stats.read(true)
+	if c.evictor != nil {
+		c.evictorMu.Lock()
+		c.evictor.access(key)
+		c.evictorMu.Unlock()
+	}
+	return item.entry()
+}
+
+// Get a copy of an item without counting the read, or the access to the item.
+func (c *MemoryCache[T]) peekEntry(key string) (*Entry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var item, ok = c.cache[key]
+	if !ok || item.expired(time.Now()) {
+		return nil, ErrItemNotFound
+	}
+	return item.entry()
+}
+
+func (c *MemoryCache[T]) countWrongType(key string) {
+	c.stats.wrongType()
+}
+
+func (c *MemoryCache[T]) Delete(key string) (deleted bool, err error) {
+	c.mu.Lock()
+	defer c.unlock()
+	var _, ok = c.cache[key]
+	if !ok {
+		return false, ErrItemNotFound
+	}
+	c.remove(key, RemovedDeleted)
+	return true, nil
+}
+
+func (c *MemoryCache[T]) Clear() (err error) {
+	c.mu.Lock()
+	defer c.unlock()
+	for key := range c.cache {
+		c.removed.add(key, RemovedCleared)
+		c.stats.removed(RemovedCleared)
+	}
+	c.cache = make(map[string]*memitem[T])
+	c.bytes = 0
+	c.tags = make(tagIndex)
+	if c.evictor != nil {
+		c.evictor.clear()
+	}
+	return nil
+}
+
+// Delete all items with the given tag, returning the amount of deleted items.
+func (c *MemoryCache[T]) InvalidateTag(tag string) (deleted int, err error) {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.invalidateTag(tag), nil
+}
+
+// Delete all items with the given tag, the mutex must be held.
+func (c *MemoryCache[T]) invalidateTag(tag string) (deleted int) {
+	var now = time.Now()
+	for _, key := range c.tags.keys(tag) {
+		// Items which expired before the cleanup removed them are removed as expired, and not counted.
+		if item, ok := c.cache[key]; ok && item.expired(now) {
+			c.remove(key, RemovedExpired)
+			continue
+		}
+		c.remove(key, RemovedDeleted)
+		deleted++
+	}
+	return deleted
+}
+
+func (c *MemoryCache[T]) Keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var now = time.Now()
+	var keys = make([]string, 0, len(c.cache))
+	for key, item := range c.cache {
+		if !item.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (c *MemoryCache[T]) Scan(cursor string, match string, count int) (keys []string, next string, err error) {
+	var pattern *scanPattern
+	if pattern, err = newScanPattern(match); err != nil {
+		return nil, "", err
+	}
+	count = scanCount(count)
+	keys, next = scanPage(c.scan(cursor, pattern, count+1), count)
+	return keys, next, nil
+}
+
+// Returns up to limit of the smallest matching keys after the cursor.
+func (c *MemoryCache[T]) scan(cursor string, pattern *scanPattern, limit int) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var now = time.Now()
+	var keys = make([]string, 0)
+	for key, item := range c.cache {
+		if key > cursor && pattern.match(key) && !item.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return smallestKeys(keys, limit)
+}
+
+func (c *MemoryCache[T]) Close() {
+	close(c.closed)
+}
+
+func (c *MemoryCache[T]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.cache)
+}
+
+func (c *MemoryCache[T]) Has(key string) (ttl time.Duration, has bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var item, ok = c.cache[key]
+	if !ok || item.expired(time.Now()) {
+		return 0, false
+	}
+	return item.ttl(), true
+}
+
+// Set the observer which is called for every item removed from the cache, nil removes the observer.
+//
+// Items which are overwritten, including by loading a dump, are not reported.
+func (c *MemoryCache[T]) OnRemove(observer RemovalObserver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed.observer = observer
+}
+
+// Release the mutex, and report the items removed while it was held to the observer.
+func (c *MemoryCache[T]) unlock() {
+	var notify = c.removed.take()
+	c.mu.Unlock()
+	notify()
+}
+
+// Returns the statistics of the cache, the bytes are the approximate memory used by the items.
+func (c *MemoryCache[T]) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var stats = c.stats.stats()
+	stats.Items = int64(len(c.cache))
+	stats.Bytes = c.bytes
+	return stats
+}
+
+func (c *MemoryCache[T]) work() {
+	c.cleanupTicker = time.NewTicker(c.cleanupInterval)
+	for {
+		select {
+		case now := <-c.cleanupTicker.C:
+			c.cleanup(now)
+		case <-c.closed:
+			c.cleanupTicker.Stop()
+			return
+		}
+	}
+}
+
+// Remove all items which have expired at the given time.
+func (c *MemoryCache[T]) cleanup(now time.Time) {
+	c.mu.Lock()
+	defer c.unlock()
+	for key, item := range c.cache {
+		if item.expired(now) {
+			c.remove(key, RemovedExpired)
+		}
+	}
+}
+
+// Remove an item from the cache, the mutex must be held.
+//
+// The removal is reported to the observer once the mutex is released by unlock.
+func (c *MemoryCache[T]) remove(key string, reason RemovalReason) {
+	var item, ok = c.cache[key]
+	if !ok {
+		return
+	}
+	delete(c.cache, key)
+	c.removed.add(key, reason)
+	c.stats.removed(reason)
+	c.bytes -= item.size()
+	c.tags.remove(key, item.Tags)
+	if c.evictor != nil {
+		c.evictor.remove(key)
+	}
+}
+
+// Evict items until the cache is within its limits, the mutex must be held.
+//
+// The item stored under the key keep is never evicted.
+func (c *MemoryCache[T]) evict(keep string) {
+	if c.evictor == nil {
+		return
+	}
+	for (c.maxItems > 0 && len(c.cache) > c.maxItems) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		var key, ok = c.evictor.victim(keep)
+		if !ok {
+			return
+		}
+		c.remove(key, RemovedEvicted)
+	}
+}
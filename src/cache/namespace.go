@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// The namespace used when no namespace has been selected.
+const DefaultNamespace = "default"
+
+// Check if a namespace name is valid.
+//
+// Namespaces may be numbered or named, they follow the same rules as keys but may be a single character.
+func IsValidNamespace(namespace string) error {
+	if namespace == "" {
+		return fmt.Errorf("namespace is empty")
+	}
+	if len(namespace) > 64 {
+		return fmt.Errorf("namespace '%s' is too long", namespace)
+	}
+	if !keyRegexFunc(namespace) || strings.Trim(namespace, ".") == "" {
+		return fmt.Errorf("namespace '%s' contains invalid characters", namespace)
+	}
+	return nil
+}
+
+// Returns the directory a file cache stores a namespace in.
+//
+// The default namespace is stored in dir itself, other namespaces are stored in dir/namespaces/<namespace>.
+func NamespaceDir(dir string, namespace string) string {
+	if namespace == DefaultNamespace {
+		return dir
+	}
+	return filepath.Join(dir, "namespaces", namespace)
+}
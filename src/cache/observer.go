@@ -0,0 +1,66 @@
+package cache
+
+// The reason an item was removed from a cache.
+type RemovalReason int
+
+const (
+	// The item expired, and was removed by the cleanup or when it was accessed.
+	RemovedExpired RemovalReason = iota + 1
+	// The item was evicted to keep a bounded cache within its limits.
+	RemovedEvicted
+	// The item was deleted, by its key or by one of its tags.
+	RemovedDeleted
+	// The cache was cleared.
+	RemovedCleared
+)
+
+var removalReasonMap = map[RemovalReason]string{
+	RemovedExpired: "expired",
+	RemovedEvicted: "evicted",
+	RemovedDeleted: "deleted",
+	RemovedCleared: "cleared",
+}
+
+func (r RemovalReason) String() string {
+	return removalReasonMap[r]
+}
+
+// Called with the key of every item removed from a cache, and the reason it was removed.
+//
+// The observer is called after the cache has released its mutex, so it may use the cache.
+// It can be called from multiple goroutines at once.
+type RemovalObserver func(key string, reason RemovalReason)
+
+type removal struct {
+	key    string
+	reason RemovalReason
+}
+
+// Collects the items removed while the mutex of a cache is held,
+// so they can be reported to the observer once the mutex is released.
+type removals struct {
+	observer RemovalObserver
+	pending  []removal
+}
+
+// Record the removal of an item, the mutex of the cache must be held.
+//
+// Nothing is recorded if the cache has no observer.
+func (r *removals) add(key string, reason RemovalReason) {
+	if r.observer != nil {
+		r.pending = append(r.pending, removal{key: key, reason: reason})
+	}
+}
+
+// Take the recorded removals, the mutex of the cache must be held.
+//
+// The returned function reports them to the observer, it must be called after the mutex is released.
+func (r *removals) take() (notify func()) {
+	var observer, pending = r.observer, r.pending
+	r.pending = nil
+	return func() {
+		for _, p := range pending {
+			observer(p.key, p.reason)
+		}
+	}
+}
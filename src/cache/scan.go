@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// The amount of keys returned by a scan if no count is given.
+const DefaultScanCount = 10
+
+// A pattern to match keys against during a scan.
+//
+// Patterns use the glob syntax of path.Match, an empty pattern matches all keys.
+type scanPattern struct {
+	pattern string
+	// The literal prefix of the pattern, every matching key starts with it.
+	prefix string
+}
+
+func newScanPattern(pattern string) (*scanPattern, error) {
+	if pattern == "" {
+		return &scanPattern{}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var prefix = pattern
+	if i := strings.IndexAny(pattern, "*?[\\"); i >= 0 {
+		prefix = pattern[:i]
+	}
+	return &scanPattern{
+		pattern: pattern,
+		prefix:  prefix,
+	}, nil
+}
+
+func (p *scanPattern) match(key string) bool {
+	if !strings.HasPrefix(key, p.prefix) {
+		return false
+	}
+	if p.pattern == "" || p.pattern == p.prefix+"*" {
+		return true
+	}
+	var ok, _ = path.Match(p.pattern, key)
+	return ok
+}
+
+// Reports whether no key after the given key can match the pattern.
+//
+// Only valid while visiting keys in order.
+func (p *scanPattern) past(key string) bool {
+	return key > p.prefix && !strings.HasPrefix(key, p.prefix)
+}
+
+// Returns the key to start scanning from, keys equal to the cursor are skipped.
+func (p *scanPattern) start(cursor string) string {
+	if p.prefix > cursor {
+		return p.prefix
+	}
+	return cursor
+}
+
+func scanCount(count int) int {
+	if count <= 0 {
+		return DefaultScanCount
+	}
+	return count
+}
+
+// Turn the matching keys into a page of at most count keys.
+//
+// The keys must contain up to count+1 keys to know if there are more keys to scan.
+func scanPage(keys []string, count int) (page []string, next string) {
+	sort.Strings(keys)
+	if len(keys) > count {
+		keys = keys[:count]
+		return keys, keys[count-1]
+	}
+	return keys, ""
+}
+
+// Select the smallest keys in a set of unordered keys.
+func smallestKeys(keys []string, limit int) []string {
+	if len(keys) <= limit {
+		return keys
+	}
+	sort.Strings(keys)
+	return keys[:limit]
+}
@@ -0,0 +1,315 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The file extensions of segments and their hint files.
+const (
+	segmentExt = ".seg"
+	hintExt    = ".hint"
+)
+
+// The operations recorded in a segment.
+type segmentOp byte
+
+const (
+	// Store an entry, the record holds the key, value, expiry, type, tags and version.
+	segmentSet segmentOp = iota + 1
+	// Delete a key, the record holds the key and the version of the deletion.
+	segmentDelete
+	// Clear the cache, the record holds the version of the clear.
+	segmentClear
+)
+
+// A record in a segment, or in the hint file of a segment.
+//
+// Every record holds a version, the record with the highest version of a key wins.
+// Segments can therefore be read in any order, and a record can be read more than once.
+type segmentRecord struct {
+	op  segmentOp
+	key string
+	e   *Entry
+	// The location of the record of a set, read from a segment or its hint file.
+	segment uint64
+	offset  int64
+	size    int64
+}
+
+// Returns the fields of the record, the fields of a hint leave out the value and hold the location of the record.
+//
+// Set: Key | Value | Expiry | Type | Tags | Version [| Offset | Size]
+//
+// Delete: Key | Version
+//
+// Clear: Version
+func (r *segmentRecord) fields(hint bool) [][]byte {
+	var version = binary.AppendUvarint(nil, r.e.Version)
+	switch r.op {
+	case segmentSet:
+		if !hint {
+			return append(entryFields(r.key, r.e), version)
+		}
+		var e = *r.e
+		e.Value = nil
+		return append(entryFields(r.key, &e), version,
+			binary.AppendUvarint(nil, uint64(r.offset)),
+			binary.AppendUvarint(nil, uint64(r.size)),
+		)
+	case segmentDelete:
+		return [][]byte{[]byte(r.key), version}
+	}
+	return [][]byte{version}
+}
+
+// Encode a record, framed by frameRecord.
+//
+// Body: Op (byte) | Fields (encodeValues)
+func (r *segmentRecord) encode(hint bool) []byte {
+	return frameRecord(append([]byte{byte(r.op)}, encodeValues(r.fields(hint))...))
+}
+
+// Decode the body of a record.
+func decodeSegmentRecord(body []byte, hint bool) (*segmentRecord, error) {
+	if len(body) == 0 {
+		return nil, ErrCorruptValue
+	}
+	var fields, err = decodeValues(body[1:])
+	if err != nil {
+		return nil, err
+	}
+	var r = &segmentRecord{op: segmentOp(body[0]), e: &Entry{}}
+	var count = 1
+	switch r.op {
+	case segmentSet:
+		count = entryFieldCount + 1
+		if hint {
+			count += 2
+		}
+	case segmentDelete:
+		count = 2
+	case segmentClear:
+	default:
+		return nil, ErrCorruptValue
+	}
+	if len(fields) != count {
+		return nil, ErrCorruptValue
+	}
+
+	var values = make([]uint64, 0, 3)
+	switch r.op {
+	case segmentSet:
+		if r.key, r.e, err = parseEntryFields(fields); err != nil {
+			return nil, err
+		}
+		fields = fields[entryFieldCount:]
+	case segmentDelete:
+		r.key = string(fields[0])
+		fields = fields[1:]
+	}
+	for _, field := range fields {
+		var value, n = binary.Uvarint(field)
+		if n <= 0 {
+			return nil, ErrCorruptValue
+		}
+		values = append(values, value)
+	}
+	r.e.Version = values[0]
+	if len(values) == 3 {
+		r.offset, r.size = int64(values[1]), int64(values[2])
+	}
+	return r, nil
+}
+
+// Read the records in a segment, calling fn for every record.
+//
+// Returns the size of the valid part of the segment, reading stops at the first partially written record.
+func readSegment(r io.Reader, id uint64, fn func(r *segmentRecord)) (size int64) {
+	var br = bufio.NewReader(r)
+	for {
+		// Reading stops at the end of the segment, or at the first partially written record.
+		var body, n, err = readFrame(br)
+		if err != nil {
+			return size
+		}
+		record, err := decodeSegmentRecord(body, false)
+		if err != nil {
+			return size
+		}
+		record.segment, record.offset, record.size = id, size, n
+		fn(record)
+		size += n
+	}
+}
+
+// Read the hint file of a segment, calling fn for every record.
+//
+// Unlike a segment, the hint file must be valid as a whole.
+func readHints(path string, id uint64, fn func(r *segmentRecord)) error {
+	var file, err = os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var br = bufio.NewReader(file)
+	for {
+		var body, _, err = readFrame(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		record, err := decodeSegmentRecord(body, true)
+		if err != nil {
+			return err
+		}
+		record.segment = id
+		fn(record)
+	}
+}
+
+// A segment file, only the active segment is written to.
+type segment struct {
+	id   uint64
+	file *os.File
+	// The size of the segment, and the size of the records of the items which are still live.
+	size int64
+	live int64
+}
+
+// Returns the name of the segment, or of its hint file.
+func segmentName(id uint64, ext string) string {
+	return fmt.Sprintf("%010d%s", id, ext)
+}
+
+// Parse the id from the name of a segment.
+func parseSegmentName(name string) (id uint64, ok bool) {
+	if !strings.HasSuffix(name, segmentExt) {
+		return 0, false
+	}
+	var err error
+	id, err = strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+	return id, err == nil
+}
+
+// Write the records to a temporary file, and rename it into place once it has been flushed to disk.
+func writeRecords(path string, records [][]byte) (err error) {
+	var file *os.File
+	file, err = os.CreateTemp(filepath.Dir(path), filepath.Base(path)+tempFileMarker+"*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+	var w = bufio.NewWriter(file)
+	for _, record := range records {
+		if _, err = w.Write(record); err != nil {
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// The items in a set of segments, built by applying their records.
+type segmentState struct {
+	items map[string]*segmentItem
+	// The versions of the deletions of keys, and of the last clear.
+	deleted map[string]uint64
+	cleared uint64
+	// The highest version of any record.
+	version uint64
+}
+
+func newSegmentState() *segmentState {
+	return &segmentState{
+		items:   make(map[string]*segmentItem),
+		deleted: make(map[string]uint64),
+	}
+}
+
+// Apply a record, unless a record with a higher version has already been applied to its key.
+func (s *segmentState) apply(r *segmentRecord) {
+	var version = r.e.Version
+	if version > s.version {
+		s.version = version
+	}
+	switch r.op {
+	case segmentSet:
+		if version <= s.deleted[r.key] {
+			return
+		}
+		if item, ok := s.items[r.key]; ok && item.Version >= version {
+			return
+		}
+		delete(s.deleted, r.key)
+		s.items[r.key] = &segmentItem{
+			segment: r.segment,
+			offset:  r.offset,
+			size:    r.size,
+			Expires: r.e.Expires,
+			Version: version,
+			Tags:    r.e.Tags,
+			Type:    r.e.Type,
+		}
+	case segmentDelete:
+		if item, ok := s.items[r.key]; ok && item.Version > version {
+			return
+		}
+		delete(s.items, r.key)
+		if version > s.deleted[r.key] {
+			s.deleted[r.key] = version
+		}
+	case segmentClear:
+		if version > s.cleared {
+			s.cleared = version
+		}
+	}
+}
+
+// Returns the live items, dropping the items which were cleared or have expired.
+func (s *segmentState) live(now time.Time) map[string]*segmentItem {
+	for key, item := range s.items {
+		if item.Version < s.cleared || item.expired(now) {
+			delete(s.items, key)
+		}
+	}
+	return s.items
+}
+
+// The location and metadata of the record of an item.
+type segmentItem struct {
+	segment uint64
+	offset  int64
+	size    int64
+	Expires time.Time
+	Version uint64
+	Tags    []string
+	Type    ValueType
+}
+
+// Reports whether the item has expired at the given time.
+func (i *segmentItem) expired(now time.Time) bool {
+	return expiredAt(i.Expires, now)
+}
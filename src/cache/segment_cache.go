@@ -0,0 +1,833 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The size at which the active segment is closed and a new segment is started, if no size is given.
+const DefaultSegmentSize int64 = 64 << 20
+
+// A log-structured cache, in the style of bitcask.
+//
+// Items are appended to the active segment file, and an index in memory holds the location of every item.
+// When the active segment is full it is closed, and a new active segment is started.
+// Segments which are no longer written to are merged in the background once half of their records are no longer live,
+// a merged segment gets a hint file holding its index so the cache can be opened without reading the whole segment.
+//
+// Unlike the FileCache, the amount of files does not grow with the amount of items.
+type SegmentCache struct {
+	commands
+
+	dir            string
+	mu             sync.RWMutex
+	index          map[string]*segmentItem
+	segments       map[uint64]*segment
+	active         *segment
+	nextID         uint64
+	maxSegmentSize int64
+	// The last version assigned to an item.
+	version uint64
+	// The keys stored under each tag.
+	tags tagIndex
+	// Held while merging, so segments are not removed or closed during a merge.
+	mergeMu sync.Mutex
+	// Signals the worker that a segment has been closed, and the segments might need to be merged.
+	rolled chan struct{}
+
+	cleanupInterval time.Duration
+	closed          chan struct{}
+	syncPolicy      SyncPolicy
+	syncInterval    time.Duration
+	unsynced        bool
+
+	stats counters
+}
+
+// Open a log-structured cache in the directory, reading the index from its segments.
+//
+// A segment size <= 0 uses DefaultSegmentSize.
+// If a segment ends with a partially written record it is cut off, and an integrity error is returned with the cache.
+func NewSegmentCache(dir string, policy SyncPolicy, segmentSize int64) (*SegmentCache, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	var c = &SegmentCache{
+		dir:            dir,
+		index:          make(map[string]*segmentItem),
+		segments:       make(map[uint64]*segment),
+		maxSegmentSize: segmentSize,
+		tags:           make(tagIndex),
+		rolled:         make(chan struct{}, 1),
+		closed:         make(chan struct{}),
+		syncPolicy:     policy,
+		syncInterval:   DefaultSyncInterval,
+	}
+	c.commands = newCommands(c)
+	var integrityErr error
+	if integrityErr, err = c.open(); err != nil {
+		c.closeFiles()
+		return nil, err
+	}
+	return c, integrityErr
+}
+
+// Read the index from the segments in the directory, and start a new active segment.
+func (c *SegmentCache) open() (integrityErr error, err error) {
+	var files []os.DirEntry
+	if files, err = os.ReadDir(c.dir); err != nil {
+		return nil, err
+	}
+	var errs []error
+	var ids []uint64
+	var hints = make(map[uint64]bool)
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		var name = f.Name()
+		if isTempFile(name) {
+			// Temporary files are left behind by interrupted merges.
+			errs = append(errs, fmt.Errorf("leftover temporary file %s", name))
+			if err = os.Remove(filepath.Join(c.dir, name)); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if id, ok := parseSegmentName(name); ok {
+			ids = append(ids, id)
+		} else if filepath.Ext(name) == hintExt {
+			if id, ok := parseSegmentName(name[:len(name)-len(hintExt)] + segmentExt); ok {
+				hints[id] = true
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var state = newSegmentState()
+	for _, id := range ids {
+		var path = c.segmentPath(id, segmentExt)
+		var file *os.File
+		if file, err = os.OpenFile(path, os.O_RDWR, 0644); err != nil {
+			return nil, err
+		}
+		var seg = &segment{id: id, file: file}
+		c.segments[id] = seg
+		var info os.FileInfo
+		if info, err = file.Stat(); err != nil {
+			return nil, err
+		}
+		seg.size = info.Size()
+		// Every time the cache is opened a new segment is started, empty segments are removed.
+		if seg.size == 0 {
+			file.Close()
+			os.Remove(path)
+			delete(c.segments, id)
+			continue
+		}
+
+		if hints[id] {
+			if err = readHints(c.segmentPath(id, hintExt), id, state.apply); err == nil {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("hint file of segment %s is corrupt, the segment was read instead", filepath.Base(path)))
+		}
+		var size = readSegment(file, id, state.apply)
+		if size < seg.size {
+			if err = file.Truncate(size); err != nil {
+				return nil, err
+			}
+			errs = append(errs, fmt.Errorf("cut off %d bytes of a partially written record at the end of %s", seg.size-size, path))
+			seg.size = size
+		}
+	}
+
+	c.version = state.version
+	for key, item := range state.live(time.Now()) {
+		c.index[key] = item
+		c.tags.add(key, item.Tags)
+		c.segments[item.segment].live += item.size
+	}
+	if len(ids) > 0 {
+		c.nextID = ids[len(ids)-1] + 1
+	}
+	if err = c.roll(); err != nil {
+		return nil, err
+	}
+	return NewIntegrityError(errs), nil
+}
+
+// Returns the path of a segment, or of its hint file.
+func (c *SegmentCache) segmentPath(id uint64, ext string) string {
+	return filepath.Join(c.dir, segmentName(id, ext))
+}
+
+// Close the active segment and start a new one, the mutex must be held.
+func (c *SegmentCache) roll() error {
+	var id = c.nextID
+	var file, err = os.OpenFile(c.segmentPath(id, segmentExt), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if c.active != nil && c.syncPolicy != SyncNever {
+		c.active.file.Sync()
+		c.unsynced = false
+	}
+	c.nextID++
+	c.active = &segment{id: id, file: file}
+	c.segments[id] = c.active
+	if c.syncPolicy == SyncAlways {
+		syncDir(c.dir)
+	}
+	select {
+	case c.rolled <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Append a record to the active segment, returning its location.
+//
+// The active segment is rolled over once it is full, the mutex must be held.
+func (c *SegmentCache) append(r *segmentRecord) (id uint64, offset int64, size int64, err error) {
+	var b = r.encode(false)
+	var seg = c.active
+	if _, err = seg.file.Write(b); err != nil {
+		return 0, 0, 0, err
+	}
+	id, offset, size = seg.id, seg.size, int64(len(b))
+	seg.size += size
+	switch c.syncPolicy {
+	case SyncAlways:
+		if err = seg.file.Sync(); err != nil {
+			return 0, 0, 0, err
+		}
+	case SyncPeriodic:
+		c.unsynced = true
+	}
+	// If the next segment cannot be created, the active segment keeps growing until the next append tries again.
+	if seg.size >= c.maxSegmentSize {
+		c.roll()
+	}
+	return id, offset, size, nil
+}
+
+// Returns the next version, the mutex must be held.
+func (c *SegmentCache) nextVersion() uint64 {
+	c.version++
+	return c.version
+}
+
+// Append an item to the active segment under the version of the entry, and index it.
+//
+// The mutex must be held.
+func (c *SegmentCache) put(key string, e *Entry) error {
+	var id, offset, size, err = c.append(&segmentRecord{op: segmentSet, key: key, e: e})
+	if err != nil {
+		return err
+	}
+	c.forget(key)
+	c.index[key] = &segmentItem{
+		segment: id,
+		offset:  offset,
+		size:    size,
+		Expires: e.Expires,
+		Version: e.Version,
+		Tags:    e.Tags,
+		Type:    e.Type,
+	}
+	c.segments[id].live += size
+	c.tags.add(key, e.Tags)
+	return nil
+}
+
+// Delete an item, appending a record so the deletion survives a restart.
+//
+// The mutex must be held.
+func (c *SegmentCache) remove(key string) error {
+	var _, _, _, err = c.append(&segmentRecord{op: segmentDelete, key: key, e: &Entry{Version: c.nextVersion()}})
+	if err != nil {
+		return err
+	}
+	c.forget(key)
+	c.stats.removed(RemovedDeleted)
+	return nil
+}
+
+// Remove an item from the index, the mutex must be held.
+func (c *SegmentCache) forget(key string) {
+	var item, ok = c.index[key]
+	if !ok {
+		return
+	}
+	if seg, ok := c.segments[item.segment]; ok {
+		seg.live -= item.size
+	}
+	c.tags.remove(key, item.Tags)
+	delete(c.index, key)
+}
+
+// Read an item from its segment, the read lock must be held.
+func (c *SegmentCache) read(key string, item *segmentItem) (*Entry, error) {
+	var seg, ok = c.segments[item.segment]
+	if !ok {
+		return nil, ErrItemNotFound
+	}
+	var b = make([]byte, item.size)
+	if _, err := seg.file.ReadAt(b, item.offset); err != nil {
+		return nil, err
+	}
+	var body, _, err = readFrame(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		return nil, err
+	}
+	r, err := decodeSegmentRecord(body, false)
+	if err != nil {
+		return nil, err
+	}
+	if r.op != segmentSet || r.key != key {
+		return nil, ErrCorruptValue
+	}
+	return &Entry{
+		Value:   r.e.Value,
+		Expires: item.Expires,
+		Version: item.Version,
+		Tags:    item.Tags,
+		Type:    item.Type,
+	}, nil
+}
+
+// Run the cache.
+func (c *SegmentCache) Run(interval time.Duration) {
+	c.cleanupInterval = interval
+	go c.work()
+}
+
+func (c *SegmentCache) work() {
+	var cleanupTicker = time.NewTicker(c.cleanupInterval)
+	defer cleanupTicker.Stop()
+	var syncTicker <-chan time.Time
+	if c.syncPolicy == SyncPeriodic {
+		var ticker = time.NewTicker(c.syncInterval)
+		defer ticker.Stop()
+		syncTicker = ticker.C
+	}
+	for {
+		select {
+		case <-c.closed:
+			return
+		case now := <-cleanupTicker.C:
+			c.mu.Lock()
+			c.cleanup(now)
+			c.mu.Unlock()
+			c.mergeIfNeeded()
+		case <-c.rolled:
+			c.mergeIfNeeded()
+		case <-syncTicker:
+			c.mu.Lock()
+			c.sync()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Flush the active segment to disk if records were appended since the last sync, the mutex must be held.
+func (c *SegmentCache) sync() {
+	if !c.unsynced {
+		return
+	}
+	if c.active.file.Sync() == nil {
+		c.unsynced = false
+	}
+}
+
+// Remove all items which have expired at the given time from the index, the mutex must be held.
+//
+// No records are appended, the expiry of an item is part of its record.
+func (c *SegmentCache) cleanup(now time.Time) {
+	for key, item := range c.index {
+		if item.expired(now) {
+			c.forget(key)
+			c.stats.removed(RemovedExpired)
+		}
+	}
+}
+
+// Merge the segments if at least half of the size of the segments which are no longer written to is not live.
+func (c *SegmentCache) mergeIfNeeded() {
+	c.mu.RLock()
+	var size, live int64
+	for _, seg := range c.segments {
+		if seg != c.active {
+			size += seg.size
+			live += seg.live
+		}
+	}
+	c.mu.RUnlock()
+	if size > 0 && live*2 <= size {
+		c.Merge()
+	}
+}
+
+// Merge the segments which are no longer written to into a single segment, with a hint file.
+//
+// Only the records of live items are kept, and the deletions which still hide older records in the merged segments.
+// The segments are read without holding the mutex, so the cache can be used during the merge.
+func (c *SegmentCache) Merge() error {
+	c.mergeMu.Lock()
+	defer c.mergeMu.Unlock()
+	select {
+	case <-c.closed:
+		return nil
+	default:
+	}
+
+	c.mu.Lock()
+	var inputs = make(map[uint64]*segment)
+	for id, seg := range c.segments {
+		if seg != c.active {
+			inputs[id] = seg
+		}
+	}
+	if len(inputs) == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	var id = c.nextID
+	c.nextID++
+	c.mu.Unlock()
+
+	// Find the record with the highest version of every key in the merged segments.
+	var latest = make(map[string]*segmentRecord)
+	var sets = make(map[string]int)
+	var cleared, oldest uint64
+	for _, seg := range inputs {
+		readSegment(io.NewSectionReader(seg.file, 0, seg.size), seg.id, func(r *segmentRecord) {
+			switch r.op {
+			case segmentClear:
+				if r.e.Version > cleared {
+					cleared = r.e.Version
+				}
+				return
+			case segmentSet:
+				sets[r.key]++
+				if oldest == 0 || r.e.Version < oldest {
+					oldest = r.e.Version
+				}
+				// The value is read again when the record is copied.
+				r.e.Value = nil
+			}
+			if old, ok := latest[r.key]; !ok || r.e.Version > old.e.Version || (r.e.Version == old.e.Version && r.op == segmentDelete) {
+				latest[r.key] = r
+			}
+		})
+	}
+
+	var now = time.Now()
+	var records, hints [][]byte
+	var offset int64
+	var copied = make(map[string]*segmentRecord)
+	var write = func(r *segmentRecord, b []byte) {
+		if r.op == segmentSet {
+			copied[r.key] = &segmentRecord{segment: r.segment, offset: r.offset}
+			r.segment, r.offset = id, offset
+		}
+		records = append(records, b)
+		hints = append(hints, r.encode(true))
+		offset += int64(len(b))
+	}
+	for key, r := range latest {
+		if r.e.Version < cleared {
+			continue
+		}
+		if r.op == segmentSet && !expiredAt(r.e.Expires, now) {
+			// Records are copied as they are.
+			var b = make([]byte, r.size)
+			if _, err := inputs[r.segment].file.ReadAt(b, r.offset); err != nil {
+				return err
+			}
+			write(r, b)
+			continue
+		}
+		// A deletion is only kept while the merged segments hold older records of the key,
+		// so the key is not restored if the cache is opened before all of them are removed.
+		var older = sets[key]
+		if r.op == segmentSet {
+			older--
+		}
+		if older > 0 {
+			var deletion = &segmentRecord{op: segmentDelete, key: key, e: &Entry{Version: r.e.Version}}
+			write(deletion, deletion.encode(false))
+		}
+	}
+	// Like a deletion, the clear is only kept while the merged segments hold records it hides.
+	if cleared > 0 && oldest < cleared {
+		var clear = &segmentRecord{op: segmentClear, e: &Entry{Version: cleared}}
+		write(clear, clear.encode(false))
+	}
+
+	var merged *segment
+	if len(records) > 0 {
+		// The hint file is written first, a segment is never renamed into place without its hints.
+		if err := writeRecords(c.segmentPath(id, hintExt), hints); err != nil {
+			return err
+		}
+		if err := writeRecords(c.segmentPath(id, segmentExt), records); err != nil {
+			os.Remove(c.segmentPath(id, hintExt))
+			return err
+		}
+		var file, err = os.Open(c.segmentPath(id, segmentExt))
+		if err != nil {
+			return err
+		}
+		merged = &segment{id: id, file: file, size: offset}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if merged != nil {
+		c.segments[id] = merged
+	}
+	for key, item := range c.index {
+		if _, ok := inputs[item.segment]; !ok {
+			continue
+		}
+		var from, ok = copied[key]
+		if !ok || from.segment != item.segment || from.offset != item.offset {
+			// Only items which have expired are not copied.
+			c.forget(key)
+			continue
+		}
+		var r = latest[key]
+		item.segment, item.offset = id, r.offset
+		merged.live += item.size
+	}
+	syncDir(c.dir)
+	for inputID, seg := range inputs {
+		seg.file.Close()
+		os.Remove(c.segmentPath(inputID, segmentExt))
+		os.Remove(c.segmentPath(inputID, hintExt))
+		delete(c.segments, inputID)
+	}
+	return nil
+}
+
+// Set an item in the cache, the item can be invalidated by any of its tags.
+func (c *SegmentCache) Set(key string, value []byte, ttl time.Duration, tags ...string) (inserted bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = c.put(key, &Entry{
+		Value:   value,
+		Expires: expiresAt(ttl),
+		Version: c.nextVersion(),
+		Tags:    tags,
+	})
+	if err != nil {
+		return false, err
+	}
+	c.stats.sets.Add(1)
+	return true, nil
+}
+
+// Atomically update an item in the cache.
+func (c *SegmentCache) update(key string, fn func(e *Entry) (*Entry, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var old *Entry
+	var err error
+	if item, ok := c.index[key]; ok && !item.expired(time.Now()) {
+		if old, err = c.read(key, item); err != nil {
+			return err
+		}
+	}
+
+	e, err := fn(old)
+	if err != nil {
+		return err
+	}
+
+	if e == nil {
+		if _, ok := c.index[key]; ok {
+			return c.remove(key)
+		}
+		return nil
+	}
+	e.Version = c.nextVersion()
+	if err = c.put(key, e); err != nil {
+		return err
+	}
+	c.stats.sets.Add(1)
+	return nil
+}
+
+// Get an item from the cache.
+//
+// Returns ErrWrongType if the item is not a string.
+func (c *SegmentCache) Get(key string) (value []byte, ttl time.Duration, err error) {
+	var e *Entry
+	e, err = c.GetEntry(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if e.Type != StringValue {
+		c.stats.wrongType()
+		return nil, 0, ErrWrongType
+	}
+	return e.Value, e.TTL(), nil
+}
+
+// Get a copy of an item from the cache, including its metadata.
+func (c *SegmentCache) GetEntry(key string) (*Entry, error) {
+	var e, err = c.peekEntry(key)
+	c.stats.readResult(err)
+	return e, err
+}
+
+// Get a copy of an item without counting the read.
+func (c *SegmentCache) peekEntry(key string) (*Entry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var item, ok = c.index[key]
+	if !ok || item.expired(time.Now()) {
+		return nil, ErrItemNotFound
+	}
+	return c.read(key, item)
+}
+
+func (c *SegmentCache) countWrongType(key string) {
+	c.stats.wrongType()
+}
+
+func (c *SegmentCache) Delete(key string) (deleted bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.index[key]; !ok {
+		return false, ErrItemNotFound
+	}
+	if err = c.remove(key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Clear the cache.
+//
+// A clear record is appended to the active segment, after which all other segments are removed.
+func (c *SegmentCache) Clear() (err error) {
+	c.mergeMu.Lock()
+	defer c.mergeMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var cleared = len(c.index)
+	if err = c.clear(); err != nil {
+		return err
+	}
+	c.stats.cleared.Add(int64(cleared))
+	return nil
+}
+
+// Clear the cache, both the mutex and the merge mutex must be held.
+func (c *SegmentCache) clear() error {
+	var _, _, _, err = c.append(&segmentRecord{op: segmentClear, e: &Entry{Version: c.nextVersion()}})
+	if err != nil {
+		return err
+	}
+	if c.syncPolicy != SyncAlways {
+		// The segments are removed right away, the clear record must be on disk first.
+		if err = c.active.file.Sync(); err != nil {
+			return err
+		}
+	}
+	for id, seg := range c.segments {
+		if seg == c.active {
+			continue
+		}
+		seg.file.Close()
+		os.Remove(c.segmentPath(id, segmentExt))
+		os.Remove(c.segmentPath(id, hintExt))
+		delete(c.segments, id)
+	}
+	c.index = make(map[string]*segmentItem)
+	c.tags = make(tagIndex)
+	c.active.live = 0
+	return nil
+}
+
+// Delete all items with the given tag, returning the amount of deleted items.
+func (c *SegmentCache) InvalidateTag(tag string) (deleted int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var now = time.Now()
+	for _, key := range c.tags.keys(tag) {
+		// Items which expired before the cleanup removed them are forgotten as expired, and not counted.
+		if item, ok := c.index[key]; ok && item.expired(now) {
+			c.forget(key)
+			c.stats.removed(RemovedExpired)
+			continue
+		}
+		if err = c.remove(key); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (c *SegmentCache) Keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var now = time.Now()
+	var keys = make([]string, 0, len(c.index))
+	for key, item := range c.index {
+		if !item.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (c *SegmentCache) Scan(cursor string, match string, count int) (keys []string, next string, err error) {
+	var pattern *scanPattern
+	if pattern, err = newScanPattern(match); err != nil {
+		return nil, "", err
+	}
+	count = scanCount(count)
+	c.mu.RLock()
+	var now = time.Now()
+	var matches = make([]string, 0)
+	for key, item := range c.index {
+		if key > cursor && pattern.match(key) && !item.expired(now) {
+			matches = append(matches, key)
+		}
+	}
+	c.mu.RUnlock()
+	keys, next = scanPage(smallestKeys(matches, count+1), count)
+	return keys, next, nil
+}
+
+// Close the cache, flushing the active segment to disk unless the sync policy is SyncNever.
+func (c *SegmentCache) Close() {
+	close(c.closed)
+	c.mergeMu.Lock()
+	defer c.mergeMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.syncPolicy != SyncNever {
+		c.active.file.Sync()
+	}
+	c.closeFiles()
+}
+
+// Close the files of all segments.
+func (c *SegmentCache) closeFiles() {
+	for _, seg := range c.segments {
+		seg.file.Close()
+	}
+}
+
+func (c *SegmentCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.index)
+}
+
+// Returns the statistics of the cache, the bytes are the size of the records of the live items.
+func (c *SegmentCache) Stats() Stats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var stats = c.stats.stats()
+	stats.Items = int64(len(c.index))
+	for _, item := range c.index {
+		stats.Bytes += item.size
+	}
+	return stats
+}
+
+func (c *SegmentCache) Has(key string) (ttl time.Duration, has bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var item, ok = c.index[key]
+	if !ok || item.expired(time.Now()) {
+		return 0, false
+	}
+	return ttlUntil(item.Expires), true
+}
+
+// Dump the cache to bytes.
+//
+// The cache is dumped as a snapshot, which can be loaded by any cache.
+func (c *SegmentCache) Dump() ([]byte, error) {
+	var w = newSnapshotWriter()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var now = time.Now()
+	for key, item := range c.index {
+		if item.expired(now) {
+			continue
+		}
+		var e, err = c.read(key, item)
+		if err != nil {
+			return nil, err
+		}
+		w.add(key, e)
+	}
+	return w.bytes(), nil
+}
+
+// Load the cache from bytes, replacing the items in the cache.
+//
+// The loaded items get new versions.
+// Both snapshots and JSON dumps of the in-memory cache made by older versions are loaded.
+func (c *SegmentCache) Load(data []byte) error {
+	var entries map[string]*Entry
+	var err error
+	if isSnapshot(data) {
+		entries, err = snapshotEntries(data)
+	} else {
+		var items map[string]*memitem[[]byte]
+		if items, err = decodeJSONItems[[]byte](data); err == nil {
+			entries = make(map[string]*Entry, len(items))
+			for key, item := range items {
+				entries[key], _ = item.entry()
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mergeMu.Lock()
+	defer c.mergeMu.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.clear(); err != nil {
+		return err
+	}
+	var now = time.Now()
+	for key, e := range entries {
+		if expiredAt(e.Expires, now) {
+			continue
+		}
+		// The items get new versions, records with a version lower than the clear are dropped when the cache is opened.
+		e.Version = c.nextVersion()
+		if err = c.put(key, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package cache
+
+import "sort"
+
+// Decode the members of a set.
+func decodeSet(e *Entry) (map[string]struct{}, error) {
+	var members = make(map[string]struct{})
+	if e == nil {
+		return members, nil
+	}
+	var values, err = decodeValues(e.Value)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		members[string(value)] = struct{}{}
+	}
+	return members, nil
+}
+
+// Encode the members of a set into an entry, the members are sorted so equal sets encode equally.
+//
+// Returns nil if there are no members left, which deletes the set.
+func encodeSet(e *Entry, members map[string]struct{}) *Entry {
+	if len(members) == 0 {
+		return nil
+	}
+	var values = make([][]byte, 0, len(members))
+	for _, member := range sortedMembers(members) {
+		values = append(values, []byte(member))
+	}
+	if e == nil {
+		e = &Entry{Type: SetValue}
+	}
+	e.Value = encodeValues(values)
+	return e
+}
+
+func sortedMembers(members map[string]struct{}) []string {
+	var sorted = make([]string, 0, len(members))
+	for member := range members {
+		sorted = append(sorted, member)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Atomically update the members of the set stored under the key.
+//
+// The set is created if it does not exist, and deleted when its last member is removed.
+func (c commands) updateSet(key string, fn func(members map[string]struct{}) error) error {
+	return c.update(key, func(e *Entry) (*Entry, error) {
+		if err := checkType(e, SetValue); err != nil {
+			return nil, err
+		}
+		var members, err = decodeSet(e)
+		if err != nil {
+			return nil, err
+		}
+		if err = fn(members); err != nil {
+			return nil, err
+		}
+		return encodeSet(e, members), nil
+	})
+}
+
+// Returns the members of the set stored under the key, a missing key is an empty set.
+func (c commands) viewSet(key string) (map[string]struct{}, error) {
+	var e, err = c.store.GetEntry(key)
+	if err != nil {
+		if ErrItemNotFound.Is(err) {
+			return decodeSet(nil)
+		}
+		return nil, err
+	}
+	if err = checkType(e, SetValue); err != nil {
+		countWrongType(c.store, key)
+		return nil, err
+	}
+	return decodeSet(e)
+}
+
+// Add members to the set stored under the key, returning the amount of members which were added.
+//
+// The set is created if the key does not exist, it never expires until a TTL is set.
+func (c commands) SAdd(key string, members ...string) (added int, err error) {
+	err = c.updateSet(key, func(set map[string]struct{}) error {
+		added = 0
+		for _, member := range members {
+			if _, ok := set[member]; !ok {
+				set[member] = struct{}{}
+				added++
+			}
+		}
+		if added == 0 {
+			return errSkipUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// Remove members from the set stored under the key, returning the amount of removed members.
+func (c commands) SRem(key string, members ...string) (removed int, err error) {
+	err = c.updateSet(key, func(set map[string]struct{}) error {
+		removed = 0
+		for _, member := range members {
+			if _, ok := set[member]; ok {
+				delete(set, member)
+				removed++
+			}
+		}
+		if removed == 0 {
+			return errSkipUpdate
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// Reports whether the member is in the set stored under the key.
+func (c commands) SIsMember(key string, member string) (bool, error) {
+	var set, err = c.viewSet(key)
+	if err != nil {
+		return false, err
+	}
+	var _, ok = set[member]
+	return ok, nil
+}
+
+// Returns the members of the set stored under the key, in sorted order.
+func (c commands) SMembers(key string) ([]string, error) {
+	var set, err = c.viewSet(key)
+	if err != nil {
+		return nil, err
+	}
+	return sortedMembers(set), nil
+}
+
+// Returns the members which are in all of the sets stored under the keys, in sorted order.
+//
+// Every set is read on its own, the sets are not read atomically.
+func (c commands) SInter(keys ...string) ([]string, error) {
+	var inter map[string]struct{}
+	for i, key := range keys {
+		var set, err = c.viewSet(key)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			inter = set
+			continue
+		}
+		for member := range inter {
+			if _, ok := set[member]; !ok {
+				delete(inter, member)
+			}
+		}
+	}
+	return sortedMembers(inter), nil
+}
+
+// Returns the members which are in any of the sets stored under the keys, in sorted order.
+//
+// Every set is read on its own, the sets are not read atomically.
+func (c commands) SUnion(keys ...string) ([]string, error) {
+	var union = make(map[string]struct{})
+	for _, key := range keys {
+		var set, err = c.viewSet(key)
+		if err != nil {
+			return nil, err
+		}
+		for member := range set {
+			union[member] = struct{}{}
+		}
+	}
+	return sortedMembers(union), nil
+}
@@ -0,0 +1,232 @@
+package cache
+
+import "time"
+
+// The default amount of shards used by the sharded in-memory cache.
+const DefaultShards = 16
+
+// An in-memory cache which spreads its keys over multiple shards.
+//
+// Every shard is a MemoryCache with its own lock, the shard of a key
+// is picked by the hash of the key.
+//
+// Limits are divided evenly over the shards.
+type ShardedMemoryCache struct {
+	commands
+
+	shards          []*MemoryCache[[]byte]
+	cleanupInterval time.Duration
+	cleanupTicker   *time.Ticker
+	closed          chan struct{}
+}
+
+// Returns a new sharded in-memory cache.
+//
+// A limit of zero or less means the cache is not bounded by that limit.
+func NewShardedMemoryCache(shards int, maxItems int, maxBytes int64, policy EvictionPolicy) Cache {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+
+	var c = &ShardedMemoryCache{
+		shards: make([]*MemoryCache[[]byte], shards),
+		closed: make(chan struct{}),
+	}
+
+	var shardItems, shardBytes = divideLimit(int64(maxItems), shards), divideLimit(maxBytes, shards)
+	for i := range c.shards {
+		c.shards[i] = NewGenericBoundedMemoryCache[[]byte](int(shardItems), shardBytes, policy)
+	}
+	c.commands = newCommands(c)
+	return c
+}
+
+// Divide a limit over the shards, rounding up so the limit is never zero.
+func divideLimit(limit int64, shards int) int64 {
+	if limit <= 0 {
+		return 0
+	}
+	return (limit + int64(shards) - 1) / int64(shards)
+}
+
+func (c *ShardedMemoryCache) shard(key string) *MemoryCache[[]byte] {
+	return c.shards[strHash(key)%uint64(len(c.shards))]
+}
+
+// Run the cache.
+//
+// A single worker cleans up the shards one by one,
+// so only one shard is locked at a time.
+func (c *ShardedMemoryCache) Run(interval time.Duration) {
+	c.closed = make(chan struct{})
+	c.cleanupInterval = interval
+	go c.work()
+}
+
+// Set the observer which is called for every item removed from any of the shards.
+func (c *ShardedMemoryCache) OnRemove(observer RemovalObserver) {
+	for _, shard := range c.shards {
+		shard.OnRemove(observer)
+	}
+}
+
+// Returns the statistics of all shards combined.
+func (c *ShardedMemoryCache) Stats() Stats {
+	var stats Stats
+	for _, shard := range c.shards {
+		stats.add(shard.Stats())
+	}
+	return stats
+}
+
+func (c *ShardedMemoryCache) Set(key string, value []byte, ttl time.Duration, tags ...string) (inserted bool, err error) {
+	return c.shard(key).Set(key, value, ttl, tags...)
+}
+
+func (c *ShardedMemoryCache) Get(key string) (value []byte, ttl time.Duration, err error) {
+	return c.shard(key).Get(key)
+}
+
+func (c *ShardedMemoryCache) GetEntry(key string) (*Entry, error) {
+	return c.shard(key).GetEntry(key)
+}
+
+func (c *ShardedMemoryCache) peekEntry(key string) (*Entry, error) {
+	return c.shard(key).peekEntry(key)
+}
+
+func (c *ShardedMemoryCache) countWrongType(key string) {
+	c.shard(key).countWrongType(key)
+}
+
+func (c *ShardedMemoryCache) update(key string, fn func(e *Entry) (*Entry, error)) error {
+	return c.shard(key).update(key, fn)
+}
+
+func (c *ShardedMemoryCache) Delete(key string) (deleted bool, err error) {
+	return c.shard(key).Delete(key)
+}
+
+func (c *ShardedMemoryCache) Has(key string) (ttl time.Duration, has bool) {
+	return c.shard(key).Has(key)
+}
+
+func (c *ShardedMemoryCache) Clear() (err error) {
+	for _, shard := range c.shards {
+		if err = shard.Clear(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete all items with the given tag, returning the amount of deleted items.
+//
+// All shards are locked while the items are deleted, so the invalidation is atomic.
+func (c *ShardedMemoryCache) InvalidateTag(tag string) (deleted int, err error) {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+	}
+	for _, shard := range c.shards {
+		deleted += shard.invalidateTag(tag)
+	}
+	// The removals are reported once every shard is unlocked.
+	var notify = make([]func(), len(c.shards))
+	for i, shard := range c.shards {
+		notify[i] = shard.removed.take()
+		shard.mu.Unlock()
+	}
+	for _, fn := range notify {
+		fn()
+	}
+	return deleted, nil
+}
+
+func (c *ShardedMemoryCache) Keys() []string {
+	var keys = make([]string, 0, c.Len())
+	for _, shard := range c.shards {
+		keys = append(keys, shard.Keys()...)
+	}
+	return keys
+}
+
+func (c *ShardedMemoryCache) Scan(cursor string, match string, count int) (keys []string, next string, err error) {
+	var pattern *scanPattern
+	if pattern, err = newScanPattern(match); err != nil {
+		return nil, "", err
+	}
+	count = scanCount(count)
+	for _, shard := range c.shards {
+		keys = append(keys, shard.scan(cursor, pattern, count+1)...)
+	}
+	keys, next = scanPage(keys, count)
+	return keys, next, nil
+}
+
+func (c *ShardedMemoryCache) Len() int {
+	var n int
+	for _, shard := range c.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+func (c *ShardedMemoryCache) Close() {
+	close(c.closed)
+}
+
+// Dump the cache to bytes.
+//
+// The cache is dumped as a snapshot, which can be loaded by any cache.
+func (c *ShardedMemoryCache) Dump() ([]byte, error) {
+	var w = newSnapshotWriter()
+	for _, shard := range c.shards {
+		if err := shard.snapshot(w); err != nil {
+			return nil, err
+		}
+	}
+	return w.bytes(), nil
+}
+
+// Load the cache from bytes.
+//
+// Both snapshots and JSON dumps made by older versions are loaded.
+func (c *ShardedMemoryCache) Load(data []byte) error {
+	var items map[string]*memitem[[]byte]
+	var err error
+	if isSnapshot(data) {
+		items, err = snapshotItems[[]byte](data)
+	} else {
+		items, err = decodeJSONItems[[]byte](data)
+	}
+	if err != nil {
+		return err
+	}
+
+	var shardItems = make([]map[string]*memitem[[]byte], len(c.shards))
+	for i := range shardItems {
+		shardItems[i] = make(map[string]*memitem[[]byte])
+	}
+	for key, item := range items {
+		shardItems[strHash(key)%uint64(len(c.shards))][key] = item
+	}
+	for i, shard := range c.shards {
+		shard.load(shardItems[i])
+	}
+	return nil
+}
+
+func (c *ShardedMemoryCache) work() {
+	c.cleanupTicker = time.NewTicker(c.cleanupInterval)
+	defer c.cleanupTicker.Stop()
+	for {
+		select {
+		case now := <-c.cleanupTicker.C:
+			for _, shard := range c.shards {
+				shard.cleanup(now)
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// The header every snapshot starts with.
+var snapshotMagic = []byte("NETCACHE-SNAPSHOT\n")
+
+// The version of the snapshot format written by Dump.
+//
+// Snapshots of older versions can still be loaded, newer versions are rejected.
+const snapshotVersion uint16 = 1
+
+// The amount of fields of an encoded entry.
+const entryFieldCount = 5
+
+// Encode an expiry deadline, items which never expire have an empty deadline.
+func encodeExpiry(expires time.Time) []byte {
+	if expires.IsZero() {
+		return nil
+	}
+	return binary.BigEndian.AppendUint64(nil, uint64(expires.UnixNano()))
+}
+
+func decodeExpiry(b []byte) (time.Time, error) {
+	if len(b) == 0 {
+		return time.Time{}, nil
+	}
+	if len(b) != 8 {
+		return time.Time{}, ErrCorruptValue
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b))), nil
+}
+
+func stringsToValues(strs []string) [][]byte {
+	var values = make([][]byte, len(strs))
+	for i, s := range strs {
+		values[i] = []byte(s)
+	}
+	return values
+}
+
+func valuesToStrings(values [][]byte) []string {
+	var strs = make([]string, len(values))
+	for i, v := range values {
+		strs[i] = string(v)
+	}
+	return strs
+}
+
+// Returns the fields of an entry, shared by the records of snapshots and append-only logs.
+//
+// Fields: Key | Value | Expiry | Type | Tags
+func entryFields(key string, e *Entry) [][]byte {
+	var tags []byte
+	if len(e.Tags) > 0 {
+		tags = encodeValues(stringsToValues(e.Tags))
+	}
+	return [][]byte{[]byte(key), e.Value, encodeExpiry(e.Expires), {byte(e.Type)}, tags}
+}
+
+// Parse the fields returned by entryFields.
+func parseEntryFields(fields [][]byte) (key string, e *Entry, err error) {
+	if len(fields) < entryFieldCount || len(fields[3]) != 1 {
+		return "", nil, ErrCorruptValue
+	}
+	e = &Entry{
+		Value: fields[1],
+		Type:  ValueType(fields[3][0]),
+	}
+	if e.Expires, err = decodeExpiry(fields[2]); err != nil {
+		return "", nil, err
+	}
+	if len(fields[4]) > 0 {
+		var tags, err = decodeValues(fields[4])
+		if err != nil {
+			return "", nil, err
+		}
+		e.Tags = valuesToStrings(tags)
+	}
+	return string(fields[0]), e, nil
+}
+
+// Writes the items of a cache into a snapshot.
+//
+// Snapshot: Magic | Format Version (uint16) | Records | CRC32 (uint32)
+//
+// Record: Length (uvarint) | Fields (encodeValues), the fields of the entry followed by its version.
+//
+// The checksum covers everything before it.
+type snapshotWriter struct {
+	buf bytes.Buffer
+}
+
+func newSnapshotWriter() *snapshotWriter {
+	var w = &snapshotWriter{}
+	w.buf.Write(snapshotMagic)
+	binary.Write(&w.buf, binary.BigEndian, snapshotVersion)
+	return w
+}
+
+// Add an item to the snapshot.
+func (w *snapshotWriter) add(key string, e *Entry) {
+	var fields = append(entryFields(key, e), binary.AppendUvarint(nil, e.Version))
+	var body = encodeValues(fields)
+	w.buf.Write(binary.AppendUvarint(nil, uint64(len(body))))
+	w.buf.Write(body)
+}
+
+// Returns the snapshot, the writer must not be used afterwards.
+func (w *snapshotWriter) bytes() []byte {
+	binary.Write(&w.buf, binary.BigEndian, crc32.ChecksumIEEE(w.buf.Bytes()))
+	return w.buf.Bytes()
+}
+
+// Reports whether the data is a snapshot, and not a dump of an older format.
+func isSnapshot(data []byte) bool {
+	return bytes.HasPrefix(data, snapshotMagic)
+}
+
+// Decode a snapshot, calling fn for every item in it.
+//
+// The checksum is verified before any item is decoded,
+// so a corrupt snapshot is rejected with ErrCorruptSnapshot before fn is called.
+func readSnapshot(data []byte, fn func(key string, e *Entry) error) error {
+	if !isSnapshot(data) {
+		return fmt.Errorf("%w: missing snapshot header", ErrCorruptSnapshot)
+	}
+	var headerSize = len(snapshotMagic) + 2
+	if len(data) < headerSize+4 {
+		return fmt.Errorf("%w: snapshot is truncated", ErrCorruptSnapshot)
+	}
+	var body, trailer = data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(trailer) {
+		return fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+	var version = binary.BigEndian.Uint16(body[len(snapshotMagic):])
+	if version == 0 || version > snapshotVersion {
+		return fmt.Errorf("%w: unsupported format version %d", ErrCorruptSnapshot, version)
+	}
+
+	var records = body[headerSize:]
+	for len(records) > 0 {
+		var size, n = binary.Uvarint(records)
+		if n <= 0 || size > uint64(len(records)-n) {
+			return fmt.Errorf("%w: invalid record length", ErrCorruptSnapshot)
+		}
+		var fields, err = decodeValues(records[n : n+int(size)])
+		records = records[n+int(size):]
+		if err != nil || len(fields) != entryFieldCount+1 {
+			return fmt.Errorf("%w: invalid record", ErrCorruptSnapshot)
+		}
+		key, e, err := parseEntryFields(fields)
+		if err != nil {
+			return fmt.Errorf("%w: invalid record", ErrCorruptSnapshot)
+		}
+		var k int
+		if e.Version, k = binary.Uvarint(fields[entryFieldCount]); k <= 0 {
+			return fmt.Errorf("%w: invalid record version", ErrCorruptSnapshot)
+		}
+		if err = fn(key, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode the items in a snapshot.
+func snapshotEntries(data []byte) (map[string]*Entry, error) {
+	var entries = make(map[string]*Entry)
+	var err = readSnapshot(data, func(key string, e *Entry) error {
+		entries[key] = e
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
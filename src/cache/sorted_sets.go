@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// A member of a sorted set and its score.
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// The members of a sorted set, ordered by score and then by member.
+type sortedSet []ScoredMember
+
+// Decode the members of a sorted set.
+func decodeSortedSet(e *Entry) (sortedSet, error) {
+	if e == nil {
+		return sortedSet{}, nil
+	}
+	var values, err = decodeValues(e.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, ErrCorruptValue
+	}
+	var set = make(sortedSet, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		var score, err = strconv.ParseFloat(string(values[i+1]), 64)
+		if err != nil {
+			return nil, ErrCorruptValue
+		}
+		set = append(set, ScoredMember{Member: string(values[i]), Score: score})
+	}
+	return set, nil
+}
+
+// Encode the members of a sorted set into an entry.
+//
+// Returns nil if there are no members left, which deletes the sorted set.
+func encodeSortedSet(e *Entry, set sortedSet) *Entry {
+	if len(set) == 0 {
+		return nil
+	}
+	var values = make([][]byte, 0, len(set)*2)
+	for _, m := range set {
+		values = append(values, []byte(m.Member), strconv.AppendFloat(nil, m.Score, 'g', -1, 64))
+	}
+	if e == nil {
+		e = &Entry{Type: SortedSetValue}
+	}
+	e.Value = encodeValues(values)
+	return e
+}
+
+func (s sortedSet) less(a, b ScoredMember) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.Member < b.Member
+}
+
+// Returns the index of the member, or -1 if it is not in the set.
+func (s sortedSet) index(member string) int {
+	for i, m := range s {
+		if m.Member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+// Set the score of a member, keeping the set ordered.
+//
+// Reports whether the member was added.
+func (s *sortedSet) set(member string, score float64) (added bool) {
+	var set = *s
+	if i := set.index(member); i >= 0 {
+		set = append(set[:i], set[i+1:]...)
+	} else {
+		added = true
+	}
+	var m = ScoredMember{Member: member, Score: score}
+	var i = sort.Search(len(set), func(i int) bool { return !set.less(set[i], m) })
+	set = append(set, ScoredMember{})
+	copy(set[i+1:], set[i:])
+	set[i] = m
+	*s = set
+	return added
+}
+
+// Returns the slice range of the members with a score between min and max, inclusive.
+func (s sortedSet) scoreRange(min float64, max float64) (from int, to int) {
+	from = sort.Search(len(s), func(i int) bool { return s[i].Score >= min })
+	to = sort.Search(len(s), func(i int) bool { return s[i].Score > max })
+	if to < from {
+		return 0, 0
+	}
+	return from, to
+}
+
+func validScore(score float64) error {
+	if math.IsNaN(score) {
+		return ErrNotFloat
+	}
+	return nil
+}
+
+// Atomically update the members of the sorted set stored under the key.
+//
+// The sorted set is created if it does not exist, and deleted when its last member is removed.
+func (c commands) updateSortedSet(key string, fn func(set sortedSet) (sortedSet, error)) error {
+	return c.update(key, func(e *Entry) (*Entry, error) {
+		if err := checkType(e, SortedSetValue); err != nil {
+			return nil, err
+		}
+		var set, err = decodeSortedSet(e)
+		if err != nil {
+			return nil, err
+		}
+		if set, err = fn(set); err != nil {
+			return nil, err
+		}
+		return encodeSortedSet(e, set), nil
+	})
+}
+
+// Returns the members of the sorted set stored under the key, a missing key is an empty sorted set.
+func (c commands) viewSortedSet(key string) (sortedSet, error) {
+	var e, err = c.store.GetEntry(key)
+	if err != nil {
+		if ErrItemNotFound.Is(err) {
+			return decodeSortedSet(nil)
+		}
+		return nil, err
+	}
+	if err = checkType(e, SortedSetValue); err != nil {
+		countWrongType(c.store, key)
+		return nil, err
+	}
+	return decodeSortedSet(e)
+}
+
+// Add members to the sorted set stored under the key, returning the amount of members which were added.
+//
+// The score of members which are already in the sorted set is updated.
+// The sorted set is created if the key does not exist, it never expires until a TTL is set.
+func (c commands) ZAdd(key string, members ...ScoredMember) (added int, err error) {
+	for _, m := range members {
+		if err = validScore(m.Score); err != nil {
+			return 0, err
+		}
+	}
+	err = c.updateSortedSet(key, func(set sortedSet) (sortedSet, error) {
+		added = 0
+		for _, m := range members {
+			if set.set(m.Member, m.Score) {
+				added++
+			}
+		}
+		return set, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// Atomically add delta to the score of a member of the sorted set, returning the new score.
+//
+// A missing member is added with a score of zero before delta is added.
+func (c commands) ZIncrBy(key string, member string, delta float64) (score float64, err error) {
+	err = c.updateSortedSet(key, func(set sortedSet) (sortedSet, error) {
+		score = 0
+		if i := set.index(member); i >= 0 {
+			score = set[i].Score
+		}
+		score += delta
+		if err := validScore(score); err != nil {
+			return nil, err
+		}
+		set.set(member, score)
+		return set, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+// Returns the members of the sorted set stored under the key from rank start to stop, inclusive.
+//
+// Members are ranked by ascending score, negative ranks count from the end, -1 is the highest score.
+func (c commands) ZRange(key string, start int, stop int) ([]ScoredMember, error) {
+	var set, err = c.viewSortedSet(key)
+	if err != nil {
+		return nil, err
+	}
+	var from, to = rankRange(len(set), start, stop)
+	return set[from:to:to], nil
+}
+
+// Returns the members of the sorted set stored under the key with a score between min and max, inclusive.
+//
+// Use math.Inf for an unbounded range.
+func (c commands) ZRangeByScore(key string, min float64, max float64) ([]ScoredMember, error) {
+	var set, err = c.viewSortedSet(key)
+	if err != nil {
+		return nil, err
+	}
+	var from, to = set.scoreRange(min, max)
+	return set[from:to:to], nil
+}
+
+// Remove the members of the sorted set from rank start to stop, inclusive, returning the amount of removed members.
+func (c commands) ZRemRangeByRank(key string, start int, stop int) (removed int, err error) {
+	err = c.updateSortedSet(key, func(set sortedSet) (sortedSet, error) {
+		var from, to = rankRange(len(set), start, stop)
+		if removed = to - from; removed == 0 {
+			return nil, errSkipUpdate
+		}
+		return append(set[:from:from], set[to:]...), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// Remove the members of the sorted set with a score between min and max, inclusive, returning the amount of removed members.
+func (c commands) ZRemRangeByScore(key string, min float64, max float64) (removed int, err error) {
+	err = c.updateSortedSet(key, func(set sortedSet) (sortedSet, error) {
+		var from, to = set.scoreRange(min, max)
+		if removed = to - from; removed == 0 {
+			return nil, errSkipUpdate
+		}
+		return append(set[:from:from], set[to:]...), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
@@ -0,0 +1,129 @@
+package cache
+
+import "sync/atomic"
+
+// Statistics of a cache, the counters start at zero when the cache is created.
+type Stats struct {
+	// Reads of items which were found, and of items which were not or had another type than the one read.
+	Hits   int64
+	Misses int64
+	// Writes of items, and items deleted by their key or by one of their tags.
+	Sets    int64
+	Deletes int64
+	// Items removed because they expired, and items evicted to keep a bounded cache within its limits.
+	Expirations int64
+	Evictions   int64
+	// Items removed by clearing the cache.
+	Cleared int64
+	// The amount of items in the cache, and the approximate amount of bytes they use.
+	Items int64
+	Bytes int64
+	// The values compressed by a CompressedCache.
+	Compression CompressionStats
+}
+
+// Add the statistics of another cache, used by caches made up of other caches.
+func (s *Stats) add(other Stats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	s.Sets += other.Sets
+	s.Deletes += other.Deletes
+	s.Expirations += other.Expirations
+	s.Evictions += other.Evictions
+	s.Cleared += other.Cleared
+	s.Items += other.Items
+	s.Bytes += other.Bytes
+	s.Compression.Values += other.Compression.Values
+	s.Compression.OriginalBytes += other.Compression.OriginalBytes
+	s.Compression.CompressedBytes += other.Compression.CompressedBytes
+}
+
+// The counters of a cache, safe to update while only a read lock is held.
+type counters struct {
+	hits        atomic.Int64
+	misses      atomic.Int64
+	sets        atomic.Int64
+	deletes     atomic.Int64
+	expirations atomic.Int64
+	evictions   atomic.Int64
+	cleared     atomic.Int64
+}
+
+// Count a read of an item, which was found or not.
+func (c *counters) read(found bool) {
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// Count a read of an item which returned the error, reads which failed for another reason than a missing item are not counted.
+func (c *counters) readResult(err error) {
+	if err == nil || ErrItemNotFound.Is(err) {
+		c.read(err == nil)
+	}
+}
+
+// Count a read which found an item of another type than the one read as a miss, instead of the hit counted when it was found.
+func (c *counters) wrongType() {
+	c.hits.Add(-1)
+	c.misses.Add(1)
+}
+
+// Count the removal of an item.
+func (c *counters) removed(reason RemovalReason) {
+	switch reason {
+	case RemovedDeleted:
+		c.deletes.Add(1)
+	case RemovedExpired:
+		c.expirations.Add(1)
+	case RemovedEvicted:
+		c.evictions.Add(1)
+	case RemovedCleared:
+		c.cleared.Add(1)
+	}
+}
+
+// Returns the counted statistics, the amount of items and bytes are left to the cache.
+func (c *counters) stats() Stats {
+	return Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Sets:        c.sets.Load(),
+		Deletes:     c.deletes.Load(),
+		Expirations: c.expirations.Load(),
+		Evictions:   c.evictions.Load(),
+		Cleared:     c.cleared.Load(),
+	}
+}
+
+// Implemented by the caches which count their reads.
+type readCounter interface {
+	// Get a copy of an item without counting the read.
+	peekEntry(key string) (*Entry, error)
+	// Count a read of the item under the key as a miss, the item had another type than the one read.
+	countWrongType(key string)
+}
+
+// Get a copy of an item without counting the read, used for the reads made by the caches themselves.
+func peekEntry(c Cache, key string) (*Entry, error) {
+	if rc, ok := c.(readCounter); ok {
+		return rc.peekEntry(key)
+	}
+	return c.GetEntry(key)
+}
+
+// Count a read of an item of another type than the one read as a miss, c is a Cache or a store.
+func countWrongType(c any, key string) {
+	if rc, ok := c.(readCounter); ok {
+		rc.countWrongType(key)
+	}
+}
+
+// Count a read through GetEntry as a miss, for callers which found an item of another type than the one they read.
+//
+// GetEntry returns items of every type, so it counts every item it finds as a hit.
+func CountWrongType(c Cache, key string) {
+	countWrongType(c, key)
+}
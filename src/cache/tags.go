@@ -0,0 +1,51 @@
+package cache
+
+import "fmt"
+
+// An index of the keys stored under each tag.
+//
+// A cache keeps the index in sync with its items while holding its mutex.
+type tagIndex map[string]map[string]struct{}
+
+// Index the key under each of its tags.
+func (t tagIndex) add(key string, tags []string) {
+	for _, tag := range tags {
+		var keys, ok = t[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// Remove the key from the index of each of its tags.
+func (t tagIndex) remove(key string, tags []string) {
+	for _, tag := range tags {
+		var keys, ok = t[tag]
+		if !ok {
+			continue
+		}
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(t, tag)
+		}
+	}
+}
+
+// Returns the keys stored under the tag.
+func (t tagIndex) keys(tag string) []string {
+	var keys = make([]string, 0, len(t[tag]))
+	for key := range t[tag] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Check if a tag is valid, tags follow the same rules as keys.
+func IsValidTag(tag string) error {
+	if err := IsValidKey(tag); err != nil {
+		return fmt.Errorf("invalid tag: %w", err)
+	}
+	return nil
+}
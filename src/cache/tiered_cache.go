@@ -0,0 +1,402 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The mode used by a tiered cache to write items to its second tier.
+type WriteMode int
+
+const (
+	// Write items to both tiers before a write returns.
+	WriteThrough WriteMode = iota
+	// Write items to memory, and flush them to the second tier in the background.
+	//
+	// A crash loses the writes which were not flushed yet.
+	WriteBack
+)
+
+var writeModeMap = map[WriteMode]string{
+	WriteThrough: "through",
+	WriteBack:    "back",
+}
+
+func (m WriteMode) String() string {
+	return writeModeMap[m]
+}
+
+// Parse a write mode from a string, case insensitive.
+func WriteModeFromString(mode string) (WriteMode, error) {
+	for m, name := range writeModeMap {
+		if strings.EqualFold(name, mode) {
+			return m, nil
+		}
+	}
+	return WriteThrough, fmt.Errorf("unknown write mode '%s'", mode)
+}
+
+// A cache which keeps the hot items of a second tier in a bounded in-memory cache.
+//
+// Items read from the second tier are promoted to memory, both tiers keep the same expiry for an item.
+// The second tier holds every item, except for the writes which a write-back cache has not flushed yet.
+//
+// The versions of the items are assigned by the tiered cache.
+// An item promoted from the second tier gets a new version,
+// so a compare and swap against the version it had before it was evicted from memory fails.
+// Items too large for memory keep their version until they are written again.
+type TieredCache struct {
+	commands
+
+	l1   *MemoryCache[[]byte]
+	l2   Cache
+	mode WriteMode
+	// Serializes the changes to both tiers, and the promotion of items.
+	mu sync.Mutex
+	// The last version assigned to an item.
+	version uint64
+	// The writes of a write-back cache which have not been flushed, a nil entry is a pending delete.
+	dirty map[string]*Entry
+	// The versions of the items which are too large for memory, and only kept by the second tier.
+	versions map[string]uint64
+
+	flushInterval time.Duration
+	closed        chan struct{}
+
+	stats counters
+}
+
+// Returns a new tiered cache, keeping the hot items of the second tier in the in-memory cache.
+//
+// The in-memory cache should be bounded, items too large for it are only stored in the second tier.
+func NewTieredCache(l1 *MemoryCache[[]byte], l2 Cache, mode WriteMode) *TieredCache {
+	var c = &TieredCache{
+		l1:            l1,
+		l2:            l2,
+		mode:          mode,
+		dirty:         make(map[string]*Entry),
+		versions:      make(map[string]uint64),
+		flushInterval: DefaultSyncInterval,
+		closed:        make(chan struct{}),
+	}
+	c.commands = newCommands(c)
+	return c
+}
+
+// Run both tiers, and flush the writes to the second tier periodically if the write mode is WriteBack.
+func (c *TieredCache) Run(interval time.Duration) {
+	c.l1.Run(interval)
+	c.l2.Run(interval)
+	if c.mode == WriteBack {
+		go c.work()
+	}
+}
+
+func (c *TieredCache) work() {
+	var ticker = time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			c.flush()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Close both tiers, flushing the pending writes first.
+func (c *TieredCache) Close() {
+	close(c.closed)
+	c.mu.Lock()
+	c.flush()
+	c.mu.Unlock()
+	c.l1.Close()
+	c.l2.Close()
+}
+
+// Flush the pending writes to the second tier, the mutex must be held.
+//
+// Writes which could not be flushed are kept, the next flush will try again.
+func (c *TieredCache) flush() error {
+	var errs []error
+	for key, e := range c.dirty {
+		var err error
+		if e == nil {
+			_, err = c.l2.Delete(key)
+			if ErrItemNotFound.Is(err) {
+				err = nil
+			}
+		} else {
+			err = c.l2.SetEntry(key, e)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(c.dirty, key)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d errors have occurred trying to flush the cache: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// Returns the next version, the mutex must be held.
+func (c *TieredCache) nextVersion() uint64 {
+	c.version++
+	return c.version
+}
+
+// Store a copy of an item in memory, the mutex must be held.
+//
+// Items which are too large for memory are only kept by the second tier, their version is kept by the tiered cache.
+func (c *TieredCache) promote(key string, e *Entry) error {
+	var err = c.l1.restore(key, e)
+	if err == ErrItemTooLarge {
+		c.l1.Delete(key)
+		c.versions[key] = e.Version
+		return nil
+	}
+	delete(c.versions, key)
+	return err
+}
+
+// Returns the current item stored under the key from the first tier which holds it, the mutex must be held.
+//
+// Items found in the second tier are promoted to memory.
+func (c *TieredCache) entry(key string) (*Entry, error) {
+	if e, err := c.l1.GetEntry(key); err == nil {
+		return e, nil
+	}
+	if e, ok := c.dirty[key]; ok {
+		if e == nil || expiredAt(e.Expires, time.Now()) {
+			return nil, ErrItemNotFound
+		}
+		return e, c.promote(key, e)
+	}
+	var e, err = c.l2.GetEntry(key)
+	if err != nil {
+		delete(c.versions, key)
+		return nil, err
+	}
+	if version, ok := c.versions[key]; ok {
+		e.Version = version
+	} else {
+		e.Version = c.nextVersion()
+	}
+	return e, c.promote(key, e)
+}
+
+// Atomically update an item in both tiers.
+func (c *TieredCache) update(key string, fn func(e *Entry) (*Entry, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var old, err = c.entry(key)
+	if err != nil && !ErrItemNotFound.Is(err) {
+		return err
+	}
+
+	e, err := fn(old)
+	if err != nil {
+		return err
+	}
+
+	if e == nil {
+		if old != nil {
+			return c.remove(key)
+		}
+		return nil
+	}
+
+	e.Version = c.nextVersion()
+	c.stats.sets.Add(1)
+	var stored = *e
+	switch c.mode {
+	case WriteThrough:
+		// The second tier is written first, so a failed write leaves memory untouched.
+		if err = c.l2.SetEntry(key, &stored); err != nil {
+			return err
+		}
+	case WriteBack:
+		c.dirty[key] = &stored
+	}
+	return c.promote(key, &stored)
+}
+
+// Delete an item from both tiers, the mutex must be held.
+func (c *TieredCache) remove(key string) error {
+	switch c.mode {
+	case WriteThrough:
+		if _, err := c.l2.Delete(key); err != nil && !ErrItemNotFound.Is(err) {
+			return err
+		}
+	case WriteBack:
+		c.dirty[key] = nil
+	}
+	c.l1.Delete(key)
+	delete(c.versions, key)
+	return nil
+}
+
+// Set an item in the cache, the item can be invalidated by any of its tags.
+func (c *TieredCache) Set(key string, value []byte, ttl time.Duration, tags ...string) (inserted bool, err error) {
+	var e = &Entry{
+		Value:   value,
+		Expires: expiresAt(ttl),
+		Tags:    tags,
+	}
+	err = c.update(key, func(*Entry) (*Entry, error) {
+		return e, nil
+	})
+	return err == nil, err
+}
+
+// Get an item from the cache.
+//
+// Returns ErrWrongType if the item is not a string.
+func (c *TieredCache) Get(key string) (value []byte, ttl time.Duration, err error) {
+	var e *Entry
+	e, err = c.GetEntry(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if e.Type != StringValue {
+		c.stats.wrongType()
+		return nil, 0, ErrWrongType
+	}
+	return e.Value, e.TTL(), nil
+}
+
+// Get a copy of an item from the cache, including its metadata.
+//
+// Items in memory are returned without taking the mutex, other items are promoted to memory.
+func (c *TieredCache) GetEntry(key string) (*Entry, error) {
+	var e, err = c.peekEntry(key)
+	c.stats.readResult(err)
+	return e, err
+}
+
+// Get a copy of an item without counting the read.
+func (c *TieredCache) peekEntry(key string) (*Entry, error) {
+	if e, err := c.l1.GetEntry(key); err == nil {
+		return e, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entry(key)
+}
+
+func (c *TieredCache) countWrongType(key string) {
+	c.stats.wrongType()
+}
+
+func (c *TieredCache) Delete(key string) (deleted bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err = c.entry(key); err != nil {
+		return false, err
+	}
+	if err = c.remove(key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *TieredCache) Clear() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dirty = make(map[string]*Entry)
+	c.versions = make(map[string]uint64)
+	c.l1.Clear()
+	return c.l2.Clear()
+}
+
+// Delete all items with the given tag from both tiers, returning the amount of deleted items.
+func (c *TieredCache) InvalidateTag(tag string) (deleted int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.flush(); err != nil {
+		return 0, err
+	}
+	c.l1.InvalidateTag(tag)
+	return c.l2.InvalidateTag(tag)
+}
+
+// Retrieve the keys from the second tier, after flushing the pending writes.
+func (c *TieredCache) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flush()
+	return c.l2.Keys()
+}
+
+// Scan the keys of the second tier, after flushing the pending writes.
+func (c *TieredCache) Scan(cursor string, match string, count int) (keys []string, next string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.flush(); err != nil {
+		return nil, "", err
+	}
+	return c.l2.Scan(cursor, match, count)
+}
+
+func (c *TieredCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flush()
+	return c.l2.Len()
+}
+
+func (c *TieredCache) Has(key string) (ttl time.Duration, has bool) {
+	if ttl, has = c.l1.Has(key); has {
+		return ttl, true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.dirty[key]; ok {
+		if e == nil || expiredAt(e.Expires, time.Now()) {
+			return 0, false
+		}
+		return e.TTL(), true
+	}
+	return c.l2.Has(key)
+}
+
+// Returns the statistics of the cache, after flushing the pending writes.
+//
+// Reads and writes are counted by the tiered cache, the other statistics are those of the second tier.
+func (c *TieredCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flush()
+	var stats = c.l2.Stats()
+	var counted = c.stats.stats()
+	stats.Hits, stats.Misses, stats.Sets = counted.Hits, counted.Misses, counted.Sets
+	return stats
+}
+
+// Dump the second tier to bytes, after flushing the pending writes.
+func (c *TieredCache) Dump() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	return c.l2.Dump()
+}
+
+// Load the second tier from bytes, the items in memory are dropped.
+func (c *TieredCache) Load(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dirty = make(map[string]*Entry)
+	c.versions = make(map[string]uint64)
+	c.l1.Clear()
+	return c.l2.Load(data)
+}
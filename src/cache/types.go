@@ -0,0 +1,71 @@
+package cache
+
+import "encoding/binary"
+
+// The type of the value stored under a key.
+//
+// Values of every type are stored as bytes, the commands of a type encode and decode them.
+type ValueType uint8
+
+const (
+	StringValue ValueType = iota
+	HashValue
+	ListValue
+	SetValue
+	SortedSetValue
+)
+
+// Set on the type of an item whose value is compressed.
+//
+// The flag is stored with the type of the item by every cache,
+// a CompressedCache removes it and decompresses the value before the item is used.
+const compressedFlag ValueType = 1 << 7
+
+var valueTypeNames = map[ValueType]string{
+	StringValue:    "string",
+	HashValue:      "hash",
+	ListValue:      "list",
+	SetValue:       "set",
+	SortedSetValue: "sorted set",
+}
+
+func (t ValueType) String() string {
+	return valueTypeNames[t]
+}
+
+// Encode values into a single value, every value is prefixed with its length as a uvarint.
+func encodeValues(values [][]byte) []byte {
+	var size int
+	for _, value := range values {
+		size += binary.MaxVarintLen64 + len(value)
+	}
+	var b = make([]byte, 0, size)
+	for _, value := range values {
+		b = binary.AppendUvarint(b, uint64(len(value)))
+		b = append(b, value...)
+	}
+	return b
+}
+
+// Decode a value encoded with encodeValues.
+func decodeValues(data []byte) ([][]byte, error) {
+	var values = make([][]byte, 0)
+	for len(data) > 0 {
+		var size, n = binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return nil, ErrCorruptValue
+		}
+		data = data[n:]
+		values = append(values, data[:size:size])
+		data = data[size:]
+	}
+	return values, nil
+}
+
+// Check the type of an entry, a nil entry has every type.
+func checkType(e *Entry, typ ValueType) error {
+	if e != nil && e.Type != typ {
+		return ErrWrongType
+	}
+	return nil
+}
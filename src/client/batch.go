@@ -0,0 +1,215 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// An item to set with SetMany.
+type KeyValue struct {
+	// The key of the item.
+	Key string
+	// The value of the item, serialized like the value passed to Set.
+	Value any
+	// The TTL of the item, a TTL <= 0 stores an item which never expires.
+	TTL time.Duration
+	// The tags of the item.
+	Tags []string
+}
+
+// The result of a single key of a batch request.
+type Result struct {
+	// The key the result is for.
+	Key string
+	// The item stored under the key, only set by GetMany if the item was found.
+	Item Item
+	// The error for the key, nil if the key succeeded.
+	//
+	// Errors known to the cache can be checked with errors.Is, like cache.ErrItemNotFound.
+	Err error
+}
+
+// Turn an error of a key in the reply to a batch request into an error, nil if it is empty.
+func batchError(message string) error {
+	if message == "" {
+		return nil
+	}
+	return serverError([]byte(message))
+}
+
+// Check if the keys of a batch request are valid, a batch request needs at least one key.
+func validKeys(keys []string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys given")
+	}
+	for _, key := range keys {
+		if err := cache.IsValidKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the errors of every key in the reply to a batch request, as results.
+func batchResults(keys []string, value []byte) ([]Result, error) {
+	var errs, err = protocols.DecodeStrings(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) != len(keys) {
+		return nil, protocols.ErrInvalidFormat
+	}
+	var results = make([]Result, len(keys))
+	for i, key := range keys {
+		results[i] = Result{
+			Key: key,
+			Err: batchError(errs[i]),
+		}
+	}
+	return results, nil
+}
+
+// Get multiple items from the cache in a single request.
+//
+// Returns a result for every key, in the order of the keys.
+// Keys which were not found have an error matching cache.ErrItemNotFound.
+// The values are returned as they are stored, they can be decoded with the serializer of the client.
+func (c *CacheClient) GetMany(keys ...string) ([]Result, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := validKeys(keys); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeMGET,
+		Value: protocols.EncodeStrings(keys...),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	records, err := protocols.DecodeList(message.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) != len(keys) {
+		return nil, protocols.ErrInvalidFormat
+	}
+
+	var results = make([]Result, len(keys))
+	for i, record := range records {
+		var fields, err = protocols.DecodeList(record)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != 5 {
+			return nil, protocols.ErrInvalidFormat
+		}
+		results[i].Key = keys[i]
+		if results[i].Err = batchError(string(fields[0])); results[i].Err != nil {
+			continue
+		}
+		ttl, err := strconv.ParseInt(string(fields[2]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		version, err := strconv.ParseUint(string(fields[3]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := protocols.DecodeStrings(fields[4])
+		if err != nil {
+			return nil, err
+		}
+		if len(tags) == 0 {
+			tags = nil
+		}
+		results[i].Item = &cacheItem{
+			value:   fields[1],
+			ttl:     time.Duration(ttl),
+			version: version,
+			tags:    tags,
+		}
+	}
+	return results, nil
+}
+
+// Set multiple items in the cache in a single request.
+//
+// Returns a result for every item, in the order of the items.
+// If a serializer has been set, the values will be serialized.
+// Otherwise, the values must be a []byte or string.
+func (c *CacheClient) SetMany(items ...KeyValue) ([]Result, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items to set")
+	}
+
+	var keys = make([]string, len(items))
+	var records = make([][]byte, len(items))
+	for i, item := range items {
+		if err := cache.IsValidKey(item.Key); err != nil {
+			return nil, err
+		}
+		for _, tag := range item.Tags {
+			if err := cache.IsValidTag(tag); err != nil {
+				return nil, err
+			}
+		}
+		var v, err = c.serialize(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = item.Key
+		records[i] = protocols.EncodeList(
+			[]byte(item.Key),
+			v,
+			[]byte(strconv.FormatInt(int64(item.TTL), 10)),
+			protocols.EncodeStrings(item.Tags...),
+		)
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeMSET,
+		Value: protocols.EncodeList(records...),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	return batchResults(keys, message.Value)
+}
+
+// Delete multiple items from the cache in a single request.
+//
+// Returns a result for every key, in the order of the keys.
+// Keys which did not exist have an error matching cache.ErrItemNotFound.
+func (c *CacheClient) DeleteMany(keys ...string) ([]Result, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := validKeys(keys); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeMDELETE,
+		Value: protocols.EncodeStrings(keys...),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	return batchResults(keys, message.Value)
+}
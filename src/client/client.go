@@ -1,407 +1,887 @@
-package client
-
-import (
-	"bytes"
-	"fmt"
-	"net"
-	"reflect"
-	"strings"
-	"time"
-
-	"github.com/Nigel2392/netcache/src/cache"
-	"github.com/Nigel2392/netcache/src/protocols"
-)
-
-func init() {
-	// here to make sure the cache client implements the cache interface
-	var _ = Cache(&CacheClient{})
-}
-
-type cacheItem struct {
-	// The value of the item.
-	value interface{}
-
-	// The expiration time of the item.
-	ttl time.Duration
-}
-
-// Get the value of the item.
-func (i *cacheItem) Value() interface{} {
-	return i.value
-}
-
-// Get the expiration time of the item.
-func (i *cacheItem) TTL() time.Duration {
-	return i.ttl
-}
-
-type CacheClient struct {
-	// The address of the server.
-	ServerAddr string
-
-	// The connection to the server.
-	pool *connectionPool
-
-	// The serializer to use for values.
-	Serializer protocols.Serializer
-
-	timeout time.Duration
-
-	// the amount of connections to keep open
-	connections int
-}
-
-// Create a new cache client.
-func New(serverAddr string, serializer protocols.Serializer, timeout time.Duration, connections int) *CacheClient {
-	var c = &CacheClient{
-		ServerAddr: serverAddr,
-	}
-
-	if serializer != nil {
-		c.Serializer = serializer
-	} else {
-		c.Serializer = &protocols.GobSerializer{}
-	}
-
-	if timeout != 0 {
-		c.timeout = timeout
-	} else {
-		c.timeout = 5 * time.Second
-	}
-
-	if connections != 0 {
-		c.connections = connections
-	} else {
-		c.connections = 10
-	}
-
-	return c
-}
-
-// Connect to the cache.
-func (c *CacheClient) Connect() error {
-	var err error
-	var pool *connectionPool
-
-	if c == nil {
-		return fmt.Errorf("cache client is nil")
-	}
-
-	if c.connections <= 0 {
-		c.connections = 4
-	}
-
-	pool, err = newPool(c.ServerAddr, c.connections)
-	if err != nil {
-		// Set the client to nil, return the error.
-		var valueOf = reflect.ValueOf(c)
-		valueOf.Elem().Set(
-			reflect.Zero(
-				valueOf.Elem().Type(),
-			),
-		)
-		return err
-	}
-	c.pool = pool
-	return nil
-}
-
-// Close the connection to the cache.
-func (c *CacheClient) Close() error {
-	if c == nil {
-		return nil
-	}
-	for i := 0; i < c.connections; i++ {
-		var conn = c.pool.get(c.timeout)
-		if conn == nil {
-			continue
-		}
-		if err := conn.Close(); err != nil {
-			return err
-		}
-
-	}
-	return nil
-}
-
-// Get an item from the cache.
-//
-// Destination is only used if a serializer has been set.
-func (c *CacheClient) Get(key string, dst any) (Item, error) {
-	if c == nil {
-		return nil, fmt.Errorf("cache client is nil")
-	}
-	if err := cache.IsValidKey(key); err != nil {
-		return nil, err
-	}
-
-	var message = &protocols.Message{
-		Type: protocols.TypeGET,
-		Key:  key,
-	}
-
-	var conn = c.pool.get(c.timeout)
-	defer c.pool.put(conn)
-	_, err := message.WriteTo(conn)
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = message.ReadFrom(conn)
-	if err != nil {
-		return nil, err
-	}
-
-	if message.Type == protocols.TypeERROR {
-		return nil, fmt.Errorf("error from server: %s", message.Value)
-	} else if message.Type != protocols.TypeGET {
-		return nil, fmt.Errorf("unexpected message type from server instead of GET message: %d", message.Type)
-	}
-
-	err = c.listenForEnd(conn)
-	if err != nil {
-		return nil, err
-	}
-
-	if err != nil {
-		return nil, err
-	}
-
-	var v any
-	if dst != nil && c.Serializer != nil {
-		v = dst
-		err = c.Serializer.Deserialize(v, message.Value)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		v = message.Value
-	}
-
-	return &cacheItem{
-		value: v,
-		ttl:   message.TTL,
-	}, nil
-}
-
-// Set an item in the cache.
-//
-// If a serializer has been set, the value will be serialized.
-//
-// Otherwise, the value must be a []byte or string.
-func (c *CacheClient) Set(key string, value any, ttl time.Duration) error {
-	if c == nil {
-		return fmt.Errorf("cache client is nil")
-	}
-	if err := cache.IsValidKey(key); err != nil {
-		return err
-	}
-
-	var v []byte
-	var err error
-	if c.Serializer == nil {
-		val, ok := value.([]byte)
-		if !ok {
-			val, ok := value.(string)
-			if !ok {
-				return fmt.Errorf("no serializer set and value is not a []byte or string")
-			}
-			v = []byte(val)
-		} else {
-			v = val
-		}
-	} else {
-		v, err = c.Serializer.Serialize(value)
-		if err != nil {
-			return err
-		}
-	}
-
-	var message = &protocols.Message{
-		Type:  protocols.TypeSET,
-		Key:   key,
-		Value: v,
-		TTL:   ttl,
-	}
-
-	var conn = c.pool.get(c.timeout)
-	defer c.pool.put(conn)
-	_, err = message.WriteTo(conn)
-	if err != nil {
-		return err
-	}
-
-	return c.listenForEnd(conn)
-}
-
-func (c *CacheClient) Ping() error {
-	if c == nil {
-		return fmt.Errorf("cache client is nil")
-	}
-	var message = &protocols.Message{
-		Type: protocols.TypePING,
-	}
-
-	var conn = c.pool.get(c.timeout)
-	defer c.pool.put(conn)
-	_, err := message.WriteTo(conn)
-	if err != nil {
-		return err
-	}
-	var pong = new(protocols.Message)
-	_, err = pong.ReadFrom(conn)
-	if err != nil {
-		return err
-	}
-	if pong.Type != protocols.TypePONG {
-		return fmt.Errorf("unexpected message type from server instead of PONG message: %d", message.Type)
-	}
-	return nil
-}
-
-// Delete an item from the cache.
-func (c *CacheClient) Delete(key string) error {
-	if c == nil {
-		return fmt.Errorf("cache client is nil")
-	}
-	if err := cache.IsValidKey(key); err != nil {
-		return err
-	}
-
-	var message = &protocols.Message{
-		Type: protocols.TypeDELETE,
-		Key:  key,
-	}
-
-	var conn = c.pool.get(c.timeout)
-	defer c.pool.put(conn)
-	var _, err = message.WriteTo(conn)
-	if err != nil {
-		return err
-	}
-	return c.listenForEnd(conn)
-}
-
-// Clear the cache.
-func (c *CacheClient) Clear() error {
-	if c == nil {
-		return fmt.Errorf("cache client is nil")
-	}
-	var message = &protocols.Message{
-		Type: protocols.TypeCLEAR,
-	}
-
-	var conn = c.pool.get(c.timeout)
-	defer c.pool.put(conn)
-	var _, err = message.WriteTo(conn)
-	if err != nil {
-		return err
-	}
-	return c.listenForEnd(conn)
-}
-
-// Check if the cache has an item.
-func (c *CacheClient) Has(key string) (bool, error) {
-	if c == nil {
-		return false, fmt.Errorf("cache client is nil")
-	}
-	if err := cache.IsValidKey(key); err != nil {
-		return false, err
-	}
-
-	var message = &protocols.Message{
-		Type: protocols.TypeHAS,
-		Key:  key,
-	}
-	var conn = c.pool.get(c.timeout)
-	defer c.pool.put(conn)
-	_, err := message.WriteTo(conn)
-	if err != nil {
-		return false, err
-	}
-
-	_, err = message.ReadFrom(conn)
-	if err != nil {
-		return false, err
-	}
-
-	if message.Type == protocols.TypeERROR {
-		return false, fmt.Errorf("error from server: %s", message.Value)
-	} else if message.Type != protocols.TypeHAS {
-		return false, fmt.Errorf("unexpected message type from server instead of HAS message: %d", message.Type)
-	}
-
-	var b bool
-	err = c.Serializer.Deserialize(&b, message.Value)
-	if err != nil {
-		return false, err
-	}
-
-	err = c.listenForEnd(conn)
-
-	if err != nil {
-		return false, err
-	}
-
-	return true, nil
-}
-
-// Retrieve the keys in the cache.
-func (c *CacheClient) Keys() ([]string, error) {
-	if c == nil {
-		return nil, fmt.Errorf("cache client is nil")
-	}
-	var message = &protocols.Message{
-		Type: protocols.TypeKEYS,
-	}
-
-	var conn = c.pool.get(c.timeout)
-	defer c.pool.put(conn)
-	_, err := message.WriteTo(conn)
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = message.ReadFrom(conn)
-	if err != nil {
-		return nil, err
-	}
-
-	if message.Type == protocols.TypeERROR {
-		return nil, fmt.Errorf("error from server: %s", message.Value)
-	}
-	err = c.listenForEnd(conn)
-	if err != nil {
-		return nil, err
-	}
-
-	if err != nil {
-		return nil, err
-	}
-
-	message.Value = bytes.Trim(message.Value, ",")
-	var keys []string = strings.Split(string(message.Value), ",")
-	for i, key := range keys {
-		key = strings.TrimSpace(key)
-		if err := cache.IsValidKey(key); err != nil {
-
-		}
-		keys[i] = key
-	}
-
-	return keys, nil
-}
-
-func (c *CacheClient) listenForEnd(conn net.Conn) error {
-	var message = new(protocols.Message)
-	_, err := message.ReadFrom(conn)
-	if err != nil {
-		return err
-	}
-	if message.Type == protocols.TypeERROR {
-		return fmt.Errorf("error from server: %s", message.Value)
-	} else if message.Type != protocols.TypeEND {
-		return fmt.Errorf("unexpected message from server instead of END message: %v, %d", message, message.Type)
-	}
-	return nil
-}
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+func init() {
+	// here to make sure the cache client implements the cache interface
+	var _ = Cache(&CacheClient{})
+}
+
+type cacheItem struct {
+	// The value of the item.
+	value interface{}
+
+	// The expiration time of the item.
+	ttl time.Duration
+
+	// The version of the item.
+	version uint64
+
+	// The tags of the item.
+	tags []string
+}
+
+// Get the value of the item.
+func (i *cacheItem) Value() interface{} {
+	return i.value
+}
+
+// Get the expiration time of the item.
+func (i *cacheItem) TTL() time.Duration {
+	return i.ttl
+}
+
+// Get the version of the item.
+func (i *cacheItem) Version() uint64 {
+	return i.version
+}
+
+// Get the tags of the item.
+func (i *cacheItem) Tags() []string {
+	return i.tags
+}
+
+type CacheClient struct {
+	// The address of the server.
+	ServerAddr string
+
+	// The connection to the server.
+	pool *connectionPool
+
+	// The serializer to use for values.
+	Serializer protocols.Serializer
+
+	// The namespace to select, the default namespace of the server is used if empty.
+	//
+	// Must be set before connecting.
+	Namespace string
+
+	timeout time.Duration
+
+	// the amount of connections to keep open
+	connections int
+}
+
+// Create a new cache client.
+func New(serverAddr string, serializer protocols.Serializer, timeout time.Duration, connections int) *CacheClient {
+	var c = &CacheClient{
+		ServerAddr: serverAddr,
+	}
+
+	if serializer != nil {
+		c.Serializer = serializer
+	} else {
+		c.Serializer = &protocols.GobSerializer{}
+	}
+
+	if timeout != 0 {
+		c.timeout = timeout
+	} else {
+		c.timeout = 5 * time.Second
+	}
+
+	if connections != 0 {
+		c.connections = connections
+	} else {
+		c.connections = 10
+	}
+
+	return c
+}
+
+// Connect to the cache.
+func (c *CacheClient) Connect() error {
+	var err error
+	var pool *connectionPool
+
+	if c == nil {
+		return fmt.Errorf("cache client is nil")
+	}
+
+	if c.connections <= 0 {
+		c.connections = 4
+	}
+
+	var setup func(net.Conn) error
+	if c.Namespace != "" {
+		if err = cache.IsValidNamespace(c.Namespace); err != nil {
+			return err
+		}
+		setup = c.selectNamespace
+	}
+
+	pool, err = newPool(c.ServerAddr, c.connections, setup)
+	if err != nil {
+		// Set the client to nil, return the error.
+		var valueOf = reflect.ValueOf(c)
+		valueOf.Elem().Set(
+			reflect.Zero(
+				valueOf.Elem().Type(),
+			),
+		)
+		return err
+	}
+	c.pool = pool
+	return nil
+}
+
+// Select the namespace of the client on a new connection.
+func (c *CacheClient) selectNamespace(conn net.Conn) error {
+	var message = &protocols.Message{
+		Type: protocols.TypeSELECT,
+		Key:  c.Namespace,
+	}
+
+	var timeout = c.timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	var _, err = message.WriteTo(conn)
+	if err != nil {
+		return err
+	}
+
+	_, err = message.ReadFrom(conn)
+	if err != nil {
+		return err
+	}
+
+	if message.Type == protocols.TypeERROR {
+		return serverError(message.Value)
+	} else if message.Type != protocols.TypeSELECT {
+		return fmt.Errorf("unexpected message type from server instead of SELECT message: %d", message.Type)
+	}
+
+	return c.listenForEnd(conn)
+}
+
+// Close the connection to the cache.
+func (c *CacheClient) Close() error {
+	if c == nil {
+		return nil
+	}
+	for i := 0; i < c.connections; i++ {
+		var conn = c.pool.get(c.timeout)
+		if conn == nil {
+			continue
+		}
+		if err := conn.Close(); err != nil {
+			return err
+		}
+
+	}
+	return nil
+}
+
+// Get an item from the cache.
+//
+// Destination is only used if a serializer has been set.
+func (c *CacheClient) Get(key string, dst any) (Item, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeGET,
+		Key:  key,
+	}
+
+	var conn = c.pool.get(c.timeout)
+	defer c.pool.put(conn)
+	_, err := message.WriteTo(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = message.ReadFrom(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Type == protocols.TypeERROR {
+		return nil, serverError(message.Value)
+	} else if message.Type != protocols.TypeGET {
+		return nil, fmt.Errorf("unexpected message type from server instead of GET message: %d", message.Type)
+	}
+
+	err = c.listenForEnd(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.item(message, dst)
+}
+
+// Turn a message received from the server into an item.
+//
+// Destination is only used if a serializer has been set.
+func (c *CacheClient) item(message *protocols.Message, dst any) (Item, error) {
+	var v, err = c.deserialize(message.Value, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cacheItem{
+		value:   v,
+		ttl:     message.TTL,
+		version: message.Version,
+		tags:    message.Tags,
+	}, nil
+}
+
+// Set an item in the cache.
+//
+// A ttl <= 0 stores an item which never expires.
+// The item can be invalidated by any of its tags with InvalidateTag.
+// If a serializer has been set, the value will be serialized.
+//
+// Otherwise, the value must be a []byte or string.
+func (c *CacheClient) Set(key string, value any, ttl time.Duration, tags ...string) error {
+	if c == nil {
+		return fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := cache.IsValidTag(tag); err != nil {
+			return err
+		}
+	}
+
+	var v, err = c.serialize(value)
+	if err != nil {
+		return err
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeSET,
+		Key:   key,
+		Value: v,
+		TTL:   ttl,
+		Tags:  tags,
+	}
+
+	var conn = c.pool.get(c.timeout)
+	defer c.pool.put(conn)
+	_, err = message.WriteTo(conn)
+	if err != nil {
+		return err
+	}
+
+	return c.listenForEnd(conn)
+}
+
+// Set an item in the cache, but only if the version of the stored item matches the given version.
+//
+// The version of an item is returned by Get, a version of zero only matches if the key does not exist.
+// Returns the version of the new item, or an error matching cache.ErrVersionMismatch if the versions do not match.
+func (c *CacheClient) CompareAndSwap(key string, value any, ttl time.Duration, version uint64) (uint64, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+
+	var v, err = c.serialize(value)
+	if err != nil {
+		return 0, err
+	}
+
+	var message = &protocols.Message{
+		Type:    protocols.TypeCAS,
+		Key:     key,
+		Value:   v,
+		TTL:     ttl,
+		Version: version,
+	}
+
+	message, err = c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return message.Version, nil
+}
+
+// Set an item in the cache, but only if the key does not exist.
+//
+// Reports whether the item was set.
+func (c *CacheClient) SetNX(key string, value any, ttl time.Duration) (bool, error) {
+	return c.setIf(protocols.TypeSETNX, key, value, ttl)
+}
+
+// Set an item in the cache, but only if the key already exists.
+//
+// Reports whether the item was replaced.
+func (c *CacheClient) Replace(key string, value any, ttl time.Duration) (bool, error) {
+	return c.setIf(protocols.TypeREPLACE, key, value, ttl)
+}
+
+func (c *CacheClient) setIf(typ protocols.MessageType, key string, value any, ttl time.Duration) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return false, err
+	}
+
+	var v, err = c.serialize(value)
+	if err != nil {
+		return false, err
+	}
+
+	var message = &protocols.Message{
+		Type:  typ,
+		Key:   key,
+		Value: v,
+		TTL:   ttl,
+	}
+
+	message, err = c.request(message)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(string(message.Value))
+}
+
+// Set an item in the cache, returning the item it replaced.
+//
+// The returned item is nil if the key did not exist.
+// Destination is only used if a serializer has been set.
+func (c *CacheClient) GetAndSet(key string, value any, ttl time.Duration, dst any) (Item, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var v, err = c.serialize(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeGETSET,
+		Key:   key,
+		Value: v,
+		TTL:   ttl,
+	}
+
+	message, err = c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	// Stored items always have a version.
+	if message.Version == 0 {
+		return nil, nil
+	}
+	return c.item(message, dst)
+}
+
+// Delete an item from the cache, returning the deleted item.
+//
+// Returns an error matching cache.ErrItemNotFound if the key does not exist.
+// Destination is only used if a serializer has been set.
+func (c *CacheClient) GetAndDelete(key string, dst any) (Item, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeGETDEL,
+		Key:  key,
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	return c.item(message, dst)
+}
+
+// Set a new TTL for the key, relative to now.
+//
+// A TTL of cache.NoExpiry makes the key persistent.
+func (c *CacheClient) Touch(key string, ttl time.Duration) error {
+	return c.expire(&protocols.Message{
+		Type: protocols.TypeTOUCH,
+		Key:  key,
+		TTL:  ttl,
+	})
+}
+
+// Set the time at which the key expires.
+//
+// A zero time makes the key persistent, a time in the past deletes the key.
+func (c *CacheClient) Expire(key string, at time.Time) error {
+	var nanos int64
+	if !at.IsZero() {
+		nanos = at.UnixNano()
+	}
+	return c.expire(&protocols.Message{
+		Type:  protocols.TypeEXPIRE,
+		Key:   key,
+		Value: []byte(strconv.FormatInt(nanos, 10)),
+	})
+}
+
+// Make the key persistent, so it never expires.
+func (c *CacheClient) Persist(key string) error {
+	return c.expire(&protocols.Message{
+		Type: protocols.TypePERSIST,
+		Key:  key,
+	})
+}
+
+func (c *CacheClient) expire(message *protocols.Message) error {
+	if c == nil {
+		return fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(message.Key); err != nil {
+		return err
+	}
+
+	var conn = c.pool.get(c.timeout)
+	defer c.pool.put(conn)
+	var _, err = message.WriteTo(conn)
+	if err != nil {
+		return err
+	}
+	return c.listenForEnd(conn)
+}
+
+// Get the remaining TTL of the key.
+//
+// Returns cache.NoExpiry if the key never expires.
+func (c *CacheClient) TTL(key string) (time.Duration, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeTTL,
+		Key:  key,
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return message.TTL, nil
+}
+
+// Deserialize a value received from the server into the destination.
+//
+// The raw value is returned if no destination or serializer has been set.
+func (c *CacheClient) deserialize(value []byte, dst any) (any, error) {
+	if dst == nil || c.Serializer == nil {
+		return value, nil
+	}
+	if err := c.Serializer.Deserialize(dst, value); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// Serialize a value to be sent to the server.
+//
+// If no serializer has been set, the value must be a []byte or string.
+func (c *CacheClient) serialize(value any) ([]byte, error) {
+	if c.Serializer != nil {
+		return c.Serializer.Serialize(value)
+	}
+	switch val := value.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		return []byte(val), nil
+	}
+	return nil, fmt.Errorf("no serializer set and value is not a []byte or string")
+}
+
+func (c *CacheClient) Ping() error {
+	if c == nil {
+		return fmt.Errorf("cache client is nil")
+	}
+	var message = &protocols.Message{
+		Type: protocols.TypePING,
+	}
+
+	var conn = c.pool.get(c.timeout)
+	defer c.pool.put(conn)
+	_, err := message.WriteTo(conn)
+	if err != nil {
+		return err
+	}
+	var pong = new(protocols.Message)
+	_, err = pong.ReadFrom(conn)
+	if err != nil {
+		return err
+	}
+	if pong.Type != protocols.TypePONG {
+		return fmt.Errorf("unexpected message type from server instead of PONG message: %d", message.Type)
+	}
+	return nil
+}
+
+// Delete an item from the cache.
+func (c *CacheClient) Delete(key string) error {
+	if c == nil {
+		return fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeDELETE,
+		Key:  key,
+	}
+
+	var conn = c.pool.get(c.timeout)
+	defer c.pool.put(conn)
+	var _, err = message.WriteTo(conn)
+	if err != nil {
+		return err
+	}
+	return c.listenForEnd(conn)
+}
+
+// Clear the cache.
+func (c *CacheClient) Clear() error {
+	if c == nil {
+		return fmt.Errorf("cache client is nil")
+	}
+	var message = &protocols.Message{
+		Type: protocols.TypeCLEAR,
+	}
+
+	var conn = c.pool.get(c.timeout)
+	defer c.pool.put(conn)
+	var _, err = message.WriteTo(conn)
+	if err != nil {
+		return err
+	}
+	return c.listenForEnd(conn)
+}
+
+// Delete all items with the given tag, returning the amount of deleted items.
+func (c *CacheClient) InvalidateTag(tag string) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidTag(tag); err != nil {
+		return 0, err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeINVALIDATE,
+		Key:  tag,
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
+
+// Statistics of the cache of the selected namespace, and of the server.
+type Stats struct {
+	cache.Stats
+	// The amount of clients connected to the server.
+	Clients int64
+}
+
+// Get the statistics of the cache of the selected namespace, and of the server.
+//
+// The compression ratio is calculated from the compression statistics, see cache.CompressionStats.
+func (c *CacheClient) Stats() (*Stats, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeINFO,
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := protocols.DecodeStrings(message.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields)%2 != 0 {
+		return nil, protocols.ErrInvalidFormat
+	}
+
+	var stats = &Stats{}
+	var counters = map[string]*int64{
+		"clients":                   &stats.Clients,
+		"items":                     &stats.Items,
+		"bytes":                     &stats.Bytes,
+		"hits":                      &stats.Hits,
+		"misses":                    &stats.Misses,
+		"sets":                      &stats.Sets,
+		"deletes":                   &stats.Deletes,
+		"expirations":               &stats.Expirations,
+		"evictions":                 &stats.Evictions,
+		"cleared":                   &stats.Cleared,
+		"compressed_values":         &stats.Compression.Values,
+		"compressed_original_bytes": &stats.Compression.OriginalBytes,
+		"compressed_bytes":          &stats.Compression.CompressedBytes,
+	}
+	// Statistics this client does not know about are skipped, so newer servers can add them.
+	for i := 0; i < len(fields); i += 2 {
+		var counter, ok = counters[fields[i]]
+		if !ok {
+			continue
+		}
+		if *counter, err = strconv.ParseInt(fields[i+1], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// Check if the cache has an item.
+func (c *CacheClient) Has(key string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return false, err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeHAS,
+		Key:  key,
+	}
+	var conn = c.pool.get(c.timeout)
+	defer c.pool.put(conn)
+	_, err := message.WriteTo(conn)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = message.ReadFrom(conn)
+	if err != nil {
+		return false, err
+	}
+
+	if message.Type == protocols.TypeERROR {
+		return false, serverError(message.Value)
+	} else if message.Type != protocols.TypeHAS {
+		return false, fmt.Errorf("unexpected message type from server instead of HAS message: %d", message.Type)
+	}
+
+	var b bool
+	err = c.Serializer.Deserialize(&b, message.Value)
+	if err != nil {
+		return false, err
+	}
+
+	err = c.listenForEnd(conn)
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Retrieve the keys in the cache.
+func (c *CacheClient) Keys() ([]string, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	var message = &protocols.Message{
+		Type: protocols.TypeKEYS,
+	}
+
+	var conn = c.pool.get(c.timeout)
+	defer c.pool.put(conn)
+	_, err := message.WriteTo(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = message.ReadFrom(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Type == protocols.TypeERROR {
+		return nil, serverError(message.Value)
+	}
+	err = c.listenForEnd(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	message.Value = bytes.Trim(message.Value, ",")
+	var keys []string = strings.Split(string(message.Value), ",")
+	for i, key := range keys {
+		key = strings.TrimSpace(key)
+		if err := cache.IsValidKey(key); err != nil {
+
+		}
+		keys[i] = key
+	}
+
+	return keys, nil
+}
+
+// Scan the keys in the cache.
+//
+// Returns up to count keys after the cursor which match the glob pattern, in order.
+// Pass the returned cursor to the next call to continue, an empty cursor is returned when the scan is complete.
+func (c *CacheClient) Scan(cursor string, match string, count int) (keys []string, next string, err error) {
+	if c == nil {
+		return nil, "", fmt.Errorf("cache client is nil")
+	}
+	var message = &protocols.Message{
+		Type:  protocols.TypeSCAN,
+		Key:   cursor,
+		Value: protocols.EncodeStrings(match, strconv.Itoa(count)),
+	}
+
+	message, err = c.request(message)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys, err = protocols.DecodeStrings(message.Value)
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, message.Key, nil
+}
+
+// Atomically increment the integer stored under the key, returning the new value.
+//
+// If the key does not exist, it is created with the initial value and ttl before it is incremented.
+func (c *CacheClient) Incr(key string, delta int64, initial int64, ttl time.Duration) (int64, error) {
+	return c.incr(protocols.TypeINCR, key, delta, initial, ttl)
+}
+
+// Atomically decrement the integer stored under the key, returning the new value.
+//
+// If the key does not exist, it is created with the initial value and ttl before it is decremented.
+func (c *CacheClient) Decr(key string, delta int64, initial int64, ttl time.Duration) (int64, error) {
+	return c.incr(protocols.TypeDECR, key, delta, initial, ttl)
+}
+
+func (c *CacheClient) incr(typ protocols.MessageType, key string, delta int64, initial int64, ttl time.Duration) (int64, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+
+	var message = &protocols.Message{
+		Type:  typ,
+		Key:   key,
+		TTL:   ttl,
+		Value: protocols.EncodeStrings(strconv.FormatInt(delta, 10), strconv.FormatInt(initial, 10)),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(message.Value), 10, 64)
+}
+
+// Send a request to the server and read the response.
+//
+// The response must be of the same type as the request, and is followed by an END message.
+func (c *CacheClient) request(message *protocols.Message) (*protocols.Message, error) {
+	return c.requestWithin(message, c.timeout)
+}
+
+// Send a request to the server and read the response, with the given deadline for the connection.
+//
+// Used by requests which block on the server, and may take longer than the timeout of the client.
+func (c *CacheClient) requestWithin(message *protocols.Message, timeout time.Duration) (*protocols.Message, error) {
+	var conn = c.pool.get(timeout)
+	defer c.pool.put(conn)
+	var _, err = message.WriteTo(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var response = new(protocols.Message)
+	_, err = response.ReadFrom(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Type == protocols.TypeERROR {
+		return nil, serverError(response.Value)
+	} else if response.Type != message.Type {
+		return nil, fmt.Errorf("unexpected message type from server instead of %s message: %d", message.Type, response.Type)
+	}
+
+	err = c.listenForEnd(conn)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Turn an error message from the server into an error.
+//
+// Errors known to the cache are wrapped, so they can be checked with errors.Is.
+func serverError(message []byte) error {
+	if err, ok := cache.LookupError(string(message)); ok {
+		return fmt.Errorf("error from server: %w", err)
+	}
+	return fmt.Errorf("error from server: %s", message)
+}
+
+func (c *CacheClient) listenForEnd(conn net.Conn) error {
+	var message = new(protocols.Message)
+	_, err := message.ReadFrom(conn)
+	if err != nil {
+		return err
+	}
+	if message.Type == protocols.TypeERROR {
+		return serverError(message.Value)
+	} else if message.Type != protocols.TypeEND {
+		return fmt.Errorf("unexpected message from server instead of END message: %v, %d", message, message.Type)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// Set fields of the hash stored under the key, returning the amount of added fields.
+//
+// If a serializer has been set, the values will be serialized.
+// Otherwise, the values must be a []byte or string.
+func (c *CacheClient) HSet(key string, fields map[string]any) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("no fields to set")
+	}
+
+	var values = make([][]byte, 0, len(fields)*2)
+	for name, value := range fields {
+		var v, err = c.serialize(value)
+		if err != nil {
+			return 0, err
+		}
+		values = append(values, []byte(name), v)
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeHSET,
+		Key:   key,
+		Value: protocols.EncodeList(values...),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
+
+// Get a field of the hash stored under the key.
+//
+// Destination is only used if a serializer has been set, otherwise the raw value is returned.
+func (c *CacheClient) HGet(key string, field string, dst any) (any, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeHGET,
+		Key:   key,
+		Value: []byte(field),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	return c.deserialize(message.Value, dst)
+}
+
+// Delete fields of the hash stored under the key, returning the amount of deleted fields.
+func (c *CacheClient) HDel(key string, fields ...string) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeHDEL,
+		Key:   key,
+		Value: protocols.EncodeStrings(fields...),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
+
+// Get all fields of the hash stored under the key.
+//
+// The values are returned as they are stored, they can be decoded with the serializer of the client.
+func (c *CacheClient) HGetAll(key string) (map[string][]byte, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeHGETALL,
+		Key:  key,
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	values, err := protocols.DecodeList(message.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, protocols.ErrInvalidFormat
+	}
+	var fields = make(map[string][]byte, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		fields[string(values[i])] = values[i+1]
+	}
+	return fields, nil
+}
+
+// Returns the amount of fields of the hash stored under the key.
+func (c *CacheClient) HLen(key string) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeHLEN,
+		Key:  key,
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
+
+// Atomically add delta to the integer stored in a field of the hash, returning the new value.
+func (c *CacheClient) HIncrBy(key string, field string, delta int64) (int64, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeHINCRBY,
+		Key:   key,
+		Value: protocols.EncodeStrings(field, strconv.FormatInt(delta, 10)),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(message.Value), 10, 64)
+}
@@ -1,31 +1,125 @@
-package client
-
-import "time"
-
-// A item to be used inside of a cache.
-type Item interface {
-	// Get the value of the item.
-	Value() interface{}
-	// Get the expiration time of the item.
-	TTL() time.Duration
-}
-
-// A cache to store items in.
-type Cache interface {
-	// Connect to the cache.
-	Connect() error
-	// Get an item from the cache.
-	Get(key string, dst any) (Item, error)
-	// Set an item in the cache.
-	Set(key string, value any, ttl time.Duration) error
-	// Delete an item from the cache.
-	Delete(key string) error
-	// Clear the cache.
-	Clear() error
-	// Check if the cache has an item.
-	Has(key string) (bool, error)
-	// Keys returns all keys in the cache.
-	Keys() ([]string, error)
-	// Ping the cache.
-	Ping() error
-}
+package client
+
+import (
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+)
+
+// A item to be used inside of a cache.
+type Item interface {
+	// Get the value of the item.
+	Value() interface{}
+	// Get the expiration time of the item.
+	TTL() time.Duration
+	// Get the version of the item, used for CompareAndSwap.
+	Version() uint64
+	// Get the tags of the item.
+	Tags() []string
+}
+
+// A cache to store items in.
+type Cache interface {
+	// Connect to the cache.
+	Connect() error
+	// Get an item from the cache.
+	Get(key string, dst any) (Item, error)
+	// Set an item in the cache, optionally with tags.
+	Set(key string, value any, ttl time.Duration, tags ...string) error
+	// Delete an item from the cache.
+	Delete(key string) error
+	// Get multiple items from the cache in a single request.
+	GetMany(keys ...string) ([]Result, error)
+	// Set multiple items in the cache in a single request.
+	SetMany(items ...KeyValue) ([]Result, error)
+	// Delete multiple items from the cache in a single request.
+	DeleteMany(keys ...string) ([]Result, error)
+	// Clear the cache.
+	Clear() error
+	// Delete all items with the given tag.
+	InvalidateTag(tag string) (int, error)
+	// Check if the cache has an item.
+	Has(key string) (bool, error)
+	// Keys returns all keys in the cache.
+	Keys() ([]string, error)
+	// Scan returns a page of keys matching the glob pattern.
+	Scan(cursor string, match string, count int) (keys []string, next string, err error)
+	// Atomically increment an integer in the cache.
+	Incr(key string, delta int64, initial int64, ttl time.Duration) (int64, error)
+	// Atomically decrement an integer in the cache.
+	Decr(key string, delta int64, initial int64, ttl time.Duration) (int64, error)
+	// Set an item in the cache if its version matches.
+	CompareAndSwap(key string, value any, ttl time.Duration, version uint64) (uint64, error)
+	// Set an item in the cache if the key does not exist.
+	SetNX(key string, value any, ttl time.Duration) (bool, error)
+	// Set an item in the cache if the key already exists.
+	Replace(key string, value any, ttl time.Duration) (bool, error)
+	// Set an item in the cache, returning the item it replaced.
+	GetAndSet(key string, value any, ttl time.Duration, dst any) (Item, error)
+	// Delete an item from the cache, returning the deleted item.
+	GetAndDelete(key string, dst any) (Item, error)
+	// Set a new TTL for a key.
+	Touch(key string, ttl time.Duration) error
+	// Set the time at which a key expires.
+	Expire(key string, at time.Time) error
+	// Make a key persistent.
+	Persist(key string) error
+	// Get the remaining TTL of a key.
+	TTL(key string) (time.Duration, error)
+	// Set fields of a hash.
+	HSet(key string, fields map[string]any) (int, error)
+	// Get a field of a hash.
+	HGet(key string, field string, dst any) (any, error)
+	// Delete fields of a hash.
+	HDel(key string, fields ...string) (int, error)
+	// Get all fields of a hash.
+	HGetAll(key string) (map[string][]byte, error)
+	// Get the amount of fields of a hash.
+	HLen(key string) (int, error)
+	// Atomically increment an integer field of a hash.
+	HIncrBy(key string, field string, delta int64) (int64, error)
+	// Push values to the head of a list.
+	LPush(key string, values ...any) (int, error)
+	// Push values to the tail of a list.
+	RPush(key string, values ...any) (int, error)
+	// Pop the value at the head of a list.
+	LPop(key string, dst any) (any, error)
+	// Pop the value at the tail of a list.
+	RPop(key string, dst any) (any, error)
+	// Pop the value at the head of a list, waiting for a value.
+	BLPop(key string, timeout time.Duration, dst any) (any, error)
+	// Pop the value at the tail of a list, waiting for a value.
+	BRPop(key string, timeout time.Duration, dst any) (any, error)
+	// Get a range of values of a list.
+	LRange(key string, start int, stop int) ([][]byte, error)
+	// Get the length of a list.
+	LLen(key string) (int, error)
+	// Add members to a set.
+	SAdd(key string, members ...string) (int, error)
+	// Remove members from a set.
+	SRem(key string, members ...string) (int, error)
+	// Check if a member is in a set.
+	SIsMember(key string, member string) (bool, error)
+	// Get the members of a set.
+	SMembers(key string) ([]string, error)
+	// Get the members which are in all of the sets.
+	SInter(keys ...string) ([]string, error)
+	// Get the members which are in any of the sets.
+	SUnion(keys ...string) ([]string, error)
+	// Add members to a sorted set.
+	ZAdd(key string, members ...cache.ScoredMember) (int, error)
+	// Atomically increment the score of a member of a sorted set.
+	ZIncrBy(key string, member string, delta float64) (float64, error)
+	// Get a range of members of a sorted set by rank.
+	ZRange(key string, start int, stop int) ([]cache.ScoredMember, error)
+	// Get a range of members of a sorted set by score.
+	ZRangeByScore(key string, min float64, max float64) ([]cache.ScoredMember, error)
+	// Remove a range of members of a sorted set by rank.
+	ZRemRangeByRank(key string, start int, stop int) (int, error)
+	// Remove a range of members of a sorted set by score.
+	ZRemRangeByScore(key string, min float64, max float64) (int, error)
+	// Get the statistics of the cache and the server.
+	Stats() (*Stats, error)
+	// Ping the cache.
+	Ping() error
+}
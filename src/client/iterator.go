@@ -0,0 +1,56 @@
+package client
+
+// Iterates over the keys in the cache, fetching them page by page.
+//
+// Usage:
+//
+//	var it = client.Iterate("session-*", 100)
+//	for it.Next() {
+//		fmt.Println(it.Key())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type KeyIterator struct {
+	client *CacheClient
+	match  string
+	count  int
+	cursor string
+	keys   []string
+	key    string
+	done   bool
+	err    error
+}
+
+// Iterate over the keys in the cache matching the glob pattern,
+// fetching count keys per request.
+func (c *CacheClient) Iterate(match string, count int) *KeyIterator {
+	return &KeyIterator{
+		client: c,
+		match:  match,
+		count:  count,
+	}
+}
+
+// Advance to the next key, returns false when there are no more keys or an error occurred.
+func (it *KeyIterator) Next() bool {
+	for len(it.keys) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.keys, it.cursor, it.err = it.client.Scan(it.cursor, it.match, it.count)
+		it.done = it.cursor == ""
+	}
+	it.key, it.keys = it.keys[0], it.keys[1:]
+	return true
+}
+
+// The current key.
+func (it *KeyIterator) Key() string {
+	return it.key
+}
+
+// The error which stopped the iteration, if any.
+func (it *KeyIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// Push values to the head of the list stored under the key, returning the length of the list.
+//
+// The values are pushed one after the other, so the last value ends up at the head of the list.
+// If a serializer has been set, the values will be serialized.
+// Otherwise, the values must be a []byte or string.
+func (c *CacheClient) LPush(key string, values ...any) (int, error) {
+	return c.push(protocols.TypeLPUSH, key, values)
+}
+
+// Push values to the tail of the list stored under the key, returning the length of the list.
+//
+// If a serializer has been set, the values will be serialized.
+// Otherwise, the values must be a []byte or string.
+func (c *CacheClient) RPush(key string, values ...any) (int, error) {
+	return c.push(protocols.TypeRPUSH, key, values)
+}
+
+func (c *CacheClient) push(typ protocols.MessageType, key string, values []any) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, fmt.Errorf("no values to push")
+	}
+
+	var encoded = make([][]byte, 0, len(values))
+	for _, value := range values {
+		var v, err = c.serialize(value)
+		if err != nil {
+			return 0, err
+		}
+		encoded = append(encoded, v)
+	}
+
+	var message = &protocols.Message{
+		Type:  typ,
+		Key:   key,
+		Value: protocols.EncodeList(encoded...),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
+
+// Pop the value at the head of the list stored under the key.
+//
+// Destination is only used if a serializer has been set, otherwise the raw value is returned.
+func (c *CacheClient) LPop(key string, dst any) (any, error) {
+	return c.pop(protocols.TypeLPOP, key, 0, dst)
+}
+
+// Pop the value at the tail of the list stored under the key.
+//
+// Destination is only used if a serializer has been set, otherwise the raw value is returned.
+func (c *CacheClient) RPop(key string, dst any) (any, error) {
+	return c.pop(protocols.TypeRPOP, key, 0, dst)
+}
+
+// Pop the value at the head of the list stored under the key, waiting up to the timeout for a value.
+//
+// Clients waiting on the same list are served in the order they started waiting.
+// Destination is only used if a serializer has been set, otherwise the raw value is returned.
+func (c *CacheClient) BLPop(key string, timeout time.Duration, dst any) (any, error) {
+	return c.pop(protocols.TypeBLPOP, key, timeout, dst)
+}
+
+// Pop the value at the tail of the list stored under the key, waiting up to the timeout for a value.
+//
+// Clients waiting on the same list are served in the order they started waiting.
+// Destination is only used if a serializer has been set, otherwise the raw value is returned.
+func (c *CacheClient) BRPop(key string, timeout time.Duration, dst any) (any, error) {
+	return c.pop(protocols.TypeBRPOP, key, timeout, dst)
+}
+
+func (c *CacheClient) pop(typ protocols.MessageType, key string, timeout time.Duration, dst any) (any, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type: typ,
+		Key:  key,
+		TTL:  timeout,
+	}
+
+	// The connection must stay open while the server waits for a value.
+	var deadline = c.timeout
+	if timeout > 0 {
+		if deadline <= 0 {
+			deadline = 5 * time.Second
+		}
+		deadline += timeout
+	}
+
+	message, err := c.requestWithin(message, deadline)
+	if err != nil {
+		return nil, err
+	}
+	return c.deserialize(message.Value, dst)
+}
+
+// Returns the values of the list stored under the key from start to stop, inclusive.
+//
+// Negative indices count from the end of the list, -1 is the last value.
+// The values are returned as they are stored, they can be decoded with the serializer of the client.
+func (c *CacheClient) LRange(key string, start int, stop int) ([][]byte, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeLRANGE,
+		Key:   key,
+		Value: protocols.EncodeStrings(strconv.Itoa(start), strconv.Itoa(stop)),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	return protocols.DecodeList(message.Value)
+}
+
+// Returns the length of the list stored under the key.
+func (c *CacheClient) LLen(key string) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeLLEN,
+		Key:  key,
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
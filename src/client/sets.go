@@ -0,0 +1,122 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// Add members to the set stored under the key, returning the amount of members which were added.
+func (c *CacheClient) SAdd(key string, members ...string) (int, error) {
+	return c.setMembers(protocols.TypeSADD, key, members)
+}
+
+// Remove members from the set stored under the key, returning the amount of removed members.
+func (c *CacheClient) SRem(key string, members ...string) (int, error) {
+	return c.setMembers(protocols.TypeSREM, key, members)
+}
+
+func (c *CacheClient) setMembers(typ protocols.MessageType, key string, members []string) (int, error) {
+	if c == nil {
+		return 0, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return 0, err
+	}
+	if len(members) == 0 {
+		return 0, fmt.Errorf("no members given")
+	}
+
+	var message = &protocols.Message{
+		Type:  typ,
+		Key:   key,
+		Value: protocols.EncodeStrings(members...),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
+
+// Reports whether the member is in the set stored under the key.
+func (c *CacheClient) SIsMember(key string, member string) (bool, error) {
+	if c == nil {
+		return false, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return false, err
+	}
+
+	var message = &protocols.Message{
+		Type:  protocols.TypeSISMEMBER,
+		Key:   key,
+		Value: []byte(member),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(string(message.Value))
+}
+
+// Returns the members of the set stored under the key, in sorted order.
+func (c *CacheClient) SMembers(key string) ([]string, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type: protocols.TypeSMEMBERS,
+		Key:  key,
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	return protocols.DecodeStrings(message.Value)
+}
+
+// Returns the members which are in all of the sets stored under the keys, in sorted order.
+func (c *CacheClient) SInter(keys ...string) ([]string, error) {
+	return c.combineSets(protocols.TypeSINTER, keys)
+}
+
+// Returns the members which are in any of the sets stored under the keys, in sorted order.
+func (c *CacheClient) SUnion(keys ...string) ([]string, error) {
+	return c.combineSets(protocols.TypeSUNION, keys)
+}
+
+func (c *CacheClient) combineSets(typ protocols.MessageType, keys []string) ([]string, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys given")
+	}
+	for _, key := range keys {
+		if err := cache.IsValidKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	var message = &protocols.Message{
+		Type:  typ,
+		Key:   keys[0],
+		Value: protocols.EncodeStrings(keys[1:]...),
+	}
+
+	message, err := c.request(message)
+	if err != nil {
+		return nil, err
+	}
+	return protocols.DecodeStrings(message.Value)
+}
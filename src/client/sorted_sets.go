@@ -0,0 +1,115 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// Add members to the sorted set stored under the key, returning the amount of members which were added.
+//
+// The score of members which are already in the sorted set is updated.
+func (c *CacheClient) ZAdd(key string, members ...cache.ScoredMember) (int, error) {
+	if len(members) == 0 {
+		return 0, fmt.Errorf("no members given")
+	}
+	var args = make([]string, 0, len(members)*2)
+	for _, m := range members {
+		args = append(args, m.Member, formatScore(m.Score))
+	}
+	var message, err = c.sortedSetRequest(protocols.TypeZADD, key, args...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
+
+// Atomically add delta to the score of a member of the sorted set, returning the new score.
+func (c *CacheClient) ZIncrBy(key string, member string, delta float64) (float64, error) {
+	var message, err = c.sortedSetRequest(protocols.TypeZINCRBY, key, member, formatScore(delta))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(message.Value), 64)
+}
+
+// Returns the members of the sorted set stored under the key from rank start to stop, inclusive.
+//
+// Members are ranked by ascending score, negative ranks count from the end, -1 is the highest score.
+func (c *CacheClient) ZRange(key string, start int, stop int) ([]cache.ScoredMember, error) {
+	var message, err = c.sortedSetRequest(protocols.TypeZRANGE, key, strconv.Itoa(start), strconv.Itoa(stop))
+	if err != nil {
+		return nil, err
+	}
+	return decodeScoredMembers(message.Value)
+}
+
+// Returns the members of the sorted set stored under the key with a score between min and max, inclusive.
+//
+// Use math.Inf for an unbounded range.
+func (c *CacheClient) ZRangeByScore(key string, min float64, max float64) ([]cache.ScoredMember, error) {
+	var message, err = c.sortedSetRequest(protocols.TypeZRANGEBYSCORE, key, formatScore(min), formatScore(max))
+	if err != nil {
+		return nil, err
+	}
+	return decodeScoredMembers(message.Value)
+}
+
+// Remove the members of the sorted set from rank start to stop, inclusive, returning the amount of removed members.
+func (c *CacheClient) ZRemRangeByRank(key string, start int, stop int) (int, error) {
+	var message, err = c.sortedSetRequest(protocols.TypeZREMRANGEBYRANK, key, strconv.Itoa(start), strconv.Itoa(stop))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
+
+// Remove the members of the sorted set with a score between min and max, inclusive, returning the amount of removed members.
+func (c *CacheClient) ZRemRangeByScore(key string, min float64, max float64) (int, error) {
+	var message, err = c.sortedSetRequest(protocols.TypeZREMRANGEBYSCORE, key, formatScore(min), formatScore(max))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(message.Value))
+}
+
+func (c *CacheClient) sortedSetRequest(typ protocols.MessageType, key string, args ...string) (*protocols.Message, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache client is nil")
+	}
+	if err := cache.IsValidKey(key); err != nil {
+		return nil, err
+	}
+
+	var message = &protocols.Message{
+		Type:  typ,
+		Key:   key,
+		Value: protocols.EncodeStrings(args...),
+	}
+	return c.request(message)
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+func decodeScoredMembers(value []byte) ([]cache.ScoredMember, error) {
+	var args, err = protocols.DecodeStrings(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(args)%2 != 0 {
+		return nil, protocols.ErrInvalidFormat
+	}
+	var members = make([]cache.ScoredMember, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		var score, err = strconv.ParseFloat(args[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, cache.ScoredMember{Member: args[i], Score: score})
+	}
+	return members, nil
+}
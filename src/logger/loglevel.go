@@ -1,70 +1,70 @@
-package logger
-
-import "strings"
-
-type Loglevel int
-
-const (
-	CRITICAL Loglevel = iota + 1
-	ERROR
-	WARNING
-	INFO
-	DEBUG
-	TEST
-)
-
-func LoglevelFromString(level string) Loglevel {
-	switch strings.ToUpper(level) {
-	case "CRITICAL":
-		return CRITICAL
-	case "ERROR":
-		return ERROR
-	case "WARNING":
-		return WARNING
-	case "INFO":
-		return INFO
-	case "DEBUG":
-		return DEBUG
-	case "TEST":
-		return TEST
-	}
-	return INFO
-}
-
-func (l Loglevel) String() string {
-	switch l {
-	case CRITICAL:
-		return "CRITICAL"
-	case ERROR:
-		return "ERROR"
-	case WARNING:
-		return "WARNING"
-	case INFO:
-		return "INFO"
-	case DEBUG:
-		return "DEBUG"
-	case TEST:
-		return "TEST"
-	default:
-		return "UNKNOWN"
-	}
-}
-
-// getLogLevelColor returns the color for a loglevel.
-func getLogLevelColor(level Loglevel) string {
-	switch level {
-	case CRITICAL:
-		return ColorLevelError + Underline
-	case ERROR:
-		return ColorLevelError
-	case WARNING:
-		return ColorLevelWarning
-	case INFO:
-		return ColorLevelInfo
-	case DEBUG:
-		return ColorLevelDebug
-	case TEST:
-		return ColorLevelTest
-	}
-	return ColorLevelInfo
-}
+package logger
+
+import "strings"
+
+type Loglevel int
+
+const (
+	CRITICAL Loglevel = iota + 1
+	ERROR
+	WARNING
+	INFO
+	DEBUG
+	TEST
+)
+
+func LoglevelFromString(level string) Loglevel {
+	switch strings.ToUpper(level) {
+	case "CRITICAL":
+		return CRITICAL
+	case "ERROR":
+		return ERROR
+	case "WARNING":
+		return WARNING
+	case "INFO":
+		return INFO
+	case "DEBUG":
+		return DEBUG
+	case "TEST":
+		return TEST
+	}
+	return INFO
+}
+
+func (l Loglevel) String() string {
+	switch l {
+	case CRITICAL:
+		return "CRITICAL"
+	case ERROR:
+		return "ERROR"
+	case WARNING:
+		return "WARNING"
+	case INFO:
+		return "INFO"
+	case DEBUG:
+		return "DEBUG"
+	case TEST:
+		return "TEST"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// getLogLevelColor returns the color for a loglevel.
+func getLogLevelColor(level Loglevel) string {
+	switch level {
+	case CRITICAL:
+		return ColorLevelError + Underline
+	case ERROR:
+		return ColorLevelError
+	case WARNING:
+		return ColorLevelWarning
+	case INFO:
+		return ColorLevelInfo
+	case DEBUG:
+		return ColorLevelDebug
+	case TEST:
+		return ColorLevelTest
+	}
+	return ColorLevelInfo
+}
@@ -0,0 +1,66 @@
+package protocols
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Encode multiple values into a single message value.
+//
+// Every value is prefixed with its length, formatted as a littleEndian int64:
+//
+// Value Length (int64) | Value ([]byte) | Value Length (int64) | Value ([]byte) | ...
+func EncodeList(values ...[]byte) []byte {
+	var b = new(bytes.Buffer)
+	for _, value := range values {
+		binary.Write(b, binary.LittleEndian, int64(len(value)))
+		b.Write(value)
+	}
+	return b.Bytes()
+}
+
+// Decode a message value encoded with EncodeList.
+func DecodeList(data []byte) ([][]byte, error) {
+	var (
+		b      = bytes.NewReader(data)
+		values = make([][]byte, 0)
+	)
+	for b.Len() > 0 {
+		var size int64
+		if err := binary.Read(b, binary.LittleEndian, &size); err != nil {
+			return nil, ErrInvalidFormat
+		}
+		if size < 0 || size > int64(b.Len()) {
+			return nil, ErrInvalidFormat
+		}
+		var value = make([]byte, size)
+		if _, err := io.ReadFull(b, value); err != nil {
+			return nil, ErrUnexpectedEOF
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// Encode multiple strings into a single message value.
+func EncodeStrings(values ...string) []byte {
+	var list = make([][]byte, len(values))
+	for i, value := range values {
+		list[i] = []byte(value)
+	}
+	return EncodeList(list...)
+}
+
+// Decode a message value encoded with EncodeStrings.
+func DecodeStrings(data []byte) ([]string, error) {
+	var list, err = DecodeList(data)
+	if err != nil {
+		return nil, err
+	}
+	var values = make([]string, len(list))
+	for i, value := range list {
+		values[i] = string(value)
+	}
+	return values, nil
+}
@@ -1,54 +1,126 @@
-package protocols_test
-
-import (
-	"bytes"
-	"fmt"
-	"testing"
-	"time"
-
-	"github.com/Nigel2392/netcache/src/protocols"
-)
-
-func TestProtocol(t *testing.T) {
-	var message = &protocols.Message{
-		Type:  protocols.TypeGET,
-		Key:   "kgsjhdfsghjgfdey",
-		Value: []byte("vallkfkngkjsdfbgvsdfgvaue"),
-		TTL:   5 * time.Second,
-	}
-
-	var b bytes.Buffer
-	_, err := message.WriteTo(&b)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	fmt.Println(b.Bytes())
-	fmt.Println(b.String())
-
-	var message2 = new(protocols.Message)
-	_, err = message2.ReadFrom(&b)
-	if err != nil {
-		t.Fatalf("error reading from buffer %s %v", err.Error(), message2)
-	}
-
-	if message.Type != message2.Type {
-		t.Fatalf("type mismatch %d != %d", message.Type, message2.Type)
-	}
-
-	if message.Key != message2.Key {
-		t.Fatalf("key mismatch %s != %s", message.Key, message2.Key)
-	}
-
-	if string(message.Value) != string(message2.Value) {
-		t.Fatalf("value mismatch %s != %s", string(message.Value), string(message2.Value))
-	}
-
-	if message.TTL != message2.TTL {
-		t.Fatalf("ttl mismatch %d != %d", message.TTL, message2.TTL)
-	}
-
-	t.Log(message2.Key)
-	t.Log(string(message2.Value))
-	t.Log(message2.TTL)
-}
+package protocols_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+func TestProtocol(t *testing.T) {
+	var message = &protocols.Message{
+		Type:  protocols.TypeGET,
+		Key:   "kgsjhdfsghjgfdey",
+		Value: []byte("vallkfkngkjsdfbgvsdfgvaue"),
+		TTL:   5 * time.Second,
+	}
+
+	var b bytes.Buffer
+	_, err := message.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Println(b.Bytes())
+	fmt.Println(b.String())
+
+	var message2 = new(protocols.Message)
+	_, err = message2.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("error reading from buffer %s %v", err.Error(), message2)
+	}
+
+	if message.Type != message2.Type {
+		t.Fatalf("type mismatch %d != %d", message.Type, message2.Type)
+	}
+
+	if message.Key != message2.Key {
+		t.Fatalf("key mismatch %s != %s", message.Key, message2.Key)
+	}
+
+	if string(message.Value) != string(message2.Value) {
+		t.Fatalf("value mismatch %s != %s", string(message.Value), string(message2.Value))
+	}
+
+	if message.TTL != message2.TTL {
+		t.Fatalf("ttl mismatch %d != %d", message.TTL, message2.TTL)
+	}
+
+	t.Log(message2.Key)
+	t.Log(string(message2.Value))
+	t.Log(message2.TTL)
+}
+
+func TestProtocolVersion(t *testing.T) {
+	var b bytes.Buffer
+	for _, version := range []uint64{0, 1, 1 << 40} {
+		var message = &protocols.Message{
+			Type:    protocols.TypeCAS,
+			Key:     "key",
+			Value:   []byte("value"),
+			Version: version,
+		}
+		if _, err := message.WriteTo(&b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, version := range []uint64{0, 1, 1 << 40} {
+		var message = new(protocols.Message)
+		if _, err := message.ReadFrom(&b); err != nil {
+			t.Fatal(err)
+		}
+		if message.Version != version {
+			t.Fatalf("version mismatch %d != %d", message.Version, version)
+		}
+		if message.Key != "key" || string(message.Value) != "value" {
+			t.Fatalf("message mismatch %s %s", message.Key, message.Value)
+		}
+	}
+}
+
+func TestProtocolTags(t *testing.T) {
+	var message = &protocols.Message{
+		Type:  protocols.TypeSET,
+		Key:   "key",
+		Value: []byte("value"),
+		Tags:  []string{"tag1", "tag2"},
+	}
+
+	var b bytes.Buffer
+	if _, err := message.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	var message2 = new(protocols.Message)
+	if _, err := message2.ReadFrom(&b); err != nil {
+		t.Fatal(err)
+	}
+	if message2.Version != 0 || len(message2.Tags) != 2 || message2.Tags[0] != "tag1" || message2.Tags[1] != "tag2" {
+		t.Fatalf("tags mismatch %v (version %d)", message2.Tags, message2.Version)
+	}
+}
+
+func TestList(t *testing.T) {
+	var values = []string{"key1", "", "key3"}
+	var decoded, err = protocols.DecodeStrings(protocols.EncodeStrings(values...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != len(values) {
+		t.Fatalf("length mismatch %d != %d", len(decoded), len(values))
+	}
+
+	for i := range values {
+		if decoded[i] != values[i] {
+			t.Fatalf("value mismatch %s != %s", decoded[i], values[i])
+		}
+	}
+
+	if _, err = protocols.DecodeList([]byte{1, 0, 0}); err == nil {
+		t.Fatal("expected error decoding truncated list")
+	}
+}
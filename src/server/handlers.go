@@ -1,124 +1,434 @@
-package server
-
-import (
-	"net"
-	"strconv"
-	"strings"
-
-	"github.com/Nigel2392/netcache/src/protocols"
-)
-
-func writeErrorMessage(c net.Conn, err error) error {
-	var message = &protocols.Message{
-		Type:  protocols.TypeERROR,
-		Value: []byte(err.Error()),
-	}
-
-	_, err = message.WriteTo(c)
-	return err
-}
-
-func (s *CacheServer) handleGet(c net.Conn, message *protocols.Message) error {
-	if s.logger != nil {
-		s.logger.Debug("getting key")
-	}
-	var value, ttl, err = s.Cache.Get(message.Key)
-	if err != nil {
-		return err
-	}
-	message.Value = value
-	message.TTL = ttl
-	if s.logger != nil {
-		s.logger.Debug("sending response")
-	}
-	_, err = message.WriteTo(c)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (s *CacheServer) handleSet(c net.Conn, message *protocols.Message) error {
-	if s.logger != nil {
-		s.logger.Debug("setting key")
-	}
-	var _, err = s.Cache.Set(message.Key, message.Value, message.TTL)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (s *CacheServer) handleDelete(c net.Conn, message *protocols.Message) error {
-	if s.logger != nil {
-		s.logger.Debug("deleting key")
-	}
-	var _, err = s.Cache.Delete(message.Key)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (s *CacheServer) handleClear(c net.Conn) error {
-	if s.logger != nil {
-		s.logger.Debug("clearing cache")
-	}
-	var err = s.Cache.Clear()
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (s *CacheServer) handleHas(c net.Conn, message *protocols.Message) error {
-	if s.logger != nil {
-		s.logger.Debug("checking if key exists")
-	}
-	var _, has = s.Cache.Has(message.Key)
-	message.Value = []byte(strconv.FormatBool(has))
-	if s.logger != nil {
-		s.logger.Debugf("sending has: %v\n", string(message.Value))
-	}
-	var _, err = message.WriteTo(c)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (s *CacheServer) handleKeys(c net.Conn) error {
-	if s.logger != nil {
-		s.logger.Debug("fetching keys")
-	}
-	var keys = s.Cache.Keys()
-	var message = &protocols.Message{
-		Type:  protocols.TypeKEYS,
-		Value: []byte(strings.Join(keys, ",")),
-	}
-	if s.logger != nil {
-		s.logger.Debugf("sending keys: %v\n", string(message.Value))
-	}
-	var _, err = message.WriteTo(c)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (s *CacheServer) handlePing(c net.Conn) error {
-	if s.logger != nil {
-		s.logger.Debug("pinging")
-	}
-	var message = &protocols.Message{
-		Type: protocols.TypePONG,
-	}
-	if s.logger != nil {
-		s.logger.Debug("sending pong")
-	}
-	var _, err = message.WriteTo(c)
-	if err != nil {
-		return err
-	}
-	return nil
-}
+package server
+
+import (
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+func writeErrorMessage(c net.Conn, err error) error {
+	var message = &protocols.Message{
+		Type:  protocols.TypeERROR,
+		Value: []byte(err.Error()),
+	}
+
+	_, err = message.WriteTo(c)
+	return err
+}
+
+// Check the tags sent by a client, clients check them before sending but any client can connect.
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		if err := cache.IsValidTag(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CacheServer) handleGet(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("getting key")
+	}
+	var entry, err = c.cache.GetEntry(message.Key)
+	if err != nil {
+		return err
+	}
+	if entry.Type != cache.StringValue {
+		cache.CountWrongType(c.cache, message.Key)
+		return cache.ErrWrongType
+	}
+	message.Value = entry.Value
+	message.TTL = entry.TTL()
+	message.Version = entry.Version
+	message.Tags = entry.Tags
+	if s.logger != nil {
+		s.logger.Debug("sending response")
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CacheServer) handleSet(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("setting key")
+	}
+	if err := validateTags(message.Tags); err != nil {
+		return err
+	}
+	var _, err = c.cache.Set(message.Key, message.Value, message.TTL, message.Tags...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CacheServer) handleDelete(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("deleting key")
+	}
+	var _, err = c.cache.Delete(message.Key)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CacheServer) handleClear(c *connection) error {
+	if s.logger != nil {
+		s.logger.Debug("clearing cache")
+	}
+	var err = c.cache.Clear()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Handles INVALIDATE messages, the key of the message is the tag to invalidate.
+func (s *CacheServer) handleInvalidate(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("invalidating tag")
+	}
+	var deleted, err = c.cache.InvalidateTag(message.Key)
+	if err != nil {
+		return err
+	}
+	message.Value = []byte(strconv.Itoa(deleted))
+	if s.logger != nil {
+		s.logger.Debugf("sending deleted: %d\n", deleted)
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Handles SELECT messages, the key of the message is the namespace to select.
+func (s *CacheServer) handleSelect(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("selecting namespace")
+	}
+	var selected, err = s.Namespace(message.Key)
+	if err != nil {
+		return err
+	}
+	c.namespace = message.Key
+	c.cache = selected
+	if s.logger != nil {
+		s.logger.Debugf("selected namespace: %s\n", c.namespace)
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CacheServer) handleHas(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("checking if key exists")
+	}
+	var _, has = c.cache.Has(message.Key)
+	message.Value = []byte(strconv.FormatBool(has))
+	if s.logger != nil {
+		s.logger.Debugf("sending has: %v\n", string(message.Value))
+	}
+	var _, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CacheServer) handleKeys(c *connection) error {
+	if s.logger != nil {
+		s.logger.Debug("fetching keys")
+	}
+	var keys = c.cache.Keys()
+	var message = &protocols.Message{
+		Type:  protocols.TypeKEYS,
+		Value: []byte(strings.Join(keys, ",")),
+	}
+	if s.logger != nil {
+		s.logger.Debugf("sending keys: %v\n", string(message.Value))
+	}
+	var _, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CacheServer) handleScan(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("scanning keys")
+	}
+	var args, err = protocols.DecodeStrings(message.Value)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return protocols.ErrInvalidFormat
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return err
+	}
+	keys, next, err := c.cache.Scan(message.Key, args[0], count)
+	if err != nil {
+		return err
+	}
+	message.Key = next
+	message.Value = protocols.EncodeStrings(keys...)
+	if s.logger != nil {
+		s.logger.Debugf("sending %d keys, next cursor: %q\n", len(keys), next)
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Handles both INCR and DECR messages.
+func (s *CacheServer) handleIncr(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("incrementing key")
+	}
+	var args, err = protocols.DecodeStrings(message.Value)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return protocols.ErrInvalidFormat
+	}
+	delta, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return err
+	}
+	initial, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	if message.Type == protocols.TypeDECR {
+		// The smallest integer has no positive counterpart to negate it into.
+		if delta == math.MinInt64 {
+			return cache.ErrIntegerOverflow
+		}
+		delta = -delta
+	}
+	value, err := c.cache.Incr(message.Key, delta, initial, message.TTL)
+	if err != nil {
+		return err
+	}
+	message.Value = []byte(strconv.FormatInt(value, 10))
+	if s.logger != nil {
+		s.logger.Debugf("sending value: %d\n", value)
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CacheServer) handleCAS(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("swapping key")
+	}
+	var version, err = c.cache.CompareAndSwap(message.Key, message.Value, message.TTL, message.Version)
+	if err != nil {
+		return err
+	}
+	message.Value = nil
+	message.Version = version
+	if s.logger != nil {
+		s.logger.Debugf("sending version: %d\n", version)
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Handles both SETNX and REPLACE messages, replies whether the value was set.
+func (s *CacheServer) handleSetIf(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("conditionally setting key")
+	}
+	var set bool
+	var err error
+	if message.Type == protocols.TypeSETNX {
+		set, err = c.cache.SetNX(message.Key, message.Value, message.TTL)
+	} else {
+		set, err = c.cache.Replace(message.Key, message.Value, message.TTL)
+	}
+	if err != nil {
+		return err
+	}
+	message.Value = []byte(strconv.FormatBool(set))
+	if s.logger != nil {
+		s.logger.Debugf("sending set: %v\n", set)
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Handles both GETSET and GETDEL messages, replies with the previous item.
+//
+// A reply to GETSET without a version means the key did not exist.
+func (s *CacheServer) handleGetAnd(c *connection, message *protocols.Message) error {
+	var old *cache.Entry
+	var err error
+	if message.Type == protocols.TypeGETSET {
+		if s.logger != nil {
+			s.logger.Debug("getting and setting key")
+		}
+		old, err = c.cache.GetAndSet(message.Key, message.Value, message.TTL)
+	} else {
+		if s.logger != nil {
+			s.logger.Debug("getting and deleting key")
+		}
+		old, err = c.cache.GetAndDelete(message.Key)
+	}
+	if err != nil {
+		return err
+	}
+	message.Value = nil
+	message.TTL = 0
+	message.Version = 0
+	if old != nil {
+		message.Value = old.Value
+		message.TTL = old.TTL()
+		message.Version = old.Version
+	}
+	if s.logger != nil {
+		s.logger.Debug("sending response")
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Handles TOUCH, EXPIRE and PERSIST messages.
+//
+// The deadline of an EXPIRE message is the value, formatted as unix nanoseconds.
+func (s *CacheServer) handleExpire(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("setting expiry of key")
+	}
+	var err error
+	switch message.Type {
+	case protocols.TypeTOUCH:
+		err = c.cache.Touch(message.Key, message.TTL)
+	case protocols.TypeEXPIRE:
+		var nanos int64
+		nanos, err = strconv.ParseInt(string(message.Value), 10, 64)
+		if err != nil {
+			return err
+		}
+		var at time.Time
+		if nanos != 0 {
+			at = time.Unix(0, nanos)
+		}
+		err = c.cache.Expire(message.Key, at)
+	case protocols.TypePERSIST:
+		err = c.cache.Persist(message.Key)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CacheServer) handleTTL(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("getting ttl of key")
+	}
+	var ttl, has = c.cache.Has(message.Key)
+	if !has {
+		return cache.ErrItemNotFound
+	}
+	message.TTL = ttl
+	if s.logger != nil {
+		s.logger.Debugf("sending ttl: %s\n", ttl)
+	}
+	var _, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Handles INFO messages, the statistics of the selected namespace and of the server are sent as pairs of names and values.
+func (s *CacheServer) handleInfo(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debug("collecting statistics")
+	}
+	var stats = c.cache.Stats()
+	var counters = []struct {
+		name  string
+		value int64
+	}{
+		{"clients", s.Clients()},
+		{"items", stats.Items},
+		{"bytes", stats.Bytes},
+		{"hits", stats.Hits},
+		{"misses", stats.Misses},
+		{"sets", stats.Sets},
+		{"deletes", stats.Deletes},
+		{"expirations", stats.Expirations},
+		{"evictions", stats.Evictions},
+		{"cleared", stats.Cleared},
+		{"compressed_values", stats.Compression.Values},
+		{"compressed_original_bytes", stats.Compression.OriginalBytes},
+		{"compressed_bytes", stats.Compression.CompressedBytes},
+	}
+	var fields = make([]string, 0, len(counters)*2+2)
+	for _, counter := range counters {
+		fields = append(fields, counter.name, strconv.FormatInt(counter.value, 10))
+	}
+	fields = append(fields, "compression_ratio", strconv.FormatFloat(stats.Compression.Ratio(), 'f', 2, 64))
+	message.Value = protocols.EncodeStrings(fields...)
+	if s.logger != nil {
+		s.logger.Debug("sending statistics")
+	}
+	var _, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *CacheServer) handlePing(c *connection) error {
+	if s.logger != nil {
+		s.logger.Debug("pinging")
+	}
+	var message = &protocols.Message{
+		Type: protocols.TypePONG,
+	}
+	if s.logger != nil {
+		s.logger.Debug("sending pong")
+	}
+	var _, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
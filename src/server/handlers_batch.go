@@ -0,0 +1,137 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// An item of an MSET message.
+type batchItem struct {
+	key   string
+	value []byte
+	ttl   time.Duration
+	tags  []string
+}
+
+// Decode a record of an MSET message.
+func decodeBatchItem(record []byte) (batchItem, error) {
+	var fields, err = protocols.DecodeList(record)
+	if err != nil {
+		return batchItem{}, err
+	}
+	if len(fields) != 4 {
+		return batchItem{}, protocols.ErrInvalidFormat
+	}
+	ttl, err := strconv.ParseInt(string(fields[2]), 10, 64)
+	if err != nil {
+		return batchItem{}, err
+	}
+	tags, err := protocols.DecodeStrings(fields[3])
+	if err != nil {
+		return batchItem{}, err
+	}
+	if err = validateTags(tags); err != nil {
+		return batchItem{}, err
+	}
+	return batchItem{
+		key:   string(fields[0]),
+		value: fields[1],
+		ttl:   time.Duration(ttl),
+		tags:  tags,
+	}, nil
+}
+
+// Returns the message of an error for the reply to a batch message, empty if there is no error.
+func batchError(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Handles the batch messages, every key of the message is handled in a single pass and answered in a single reply.
+//
+// The arguments of the messages are encoded in the value:
+//
+//   - MGET: the keys, encoded with EncodeStrings. Replies with a record for every key, in order, encoded with EncodeList.
+//     A record holds the error, value, TTL, version and tags of the item, encoded with EncodeList.
+//     The error is empty if the item was found, the tags are encoded with EncodeStrings.
+//   - MSET: a record for every item, encoded with EncodeList.
+//     A record holds the key, value, TTL and tags of the item, encoded with EncodeList.
+//     Replies with the error of every item, in order, encoded with EncodeStrings.
+//   - MDELETE: the keys, encoded with EncodeStrings. Replies with the error of every key, in order, encoded with EncodeStrings.
+//
+// An error for one key does not stop the other keys from being handled, an empty error means the key succeeded.
+func (s *CacheServer) handleBatch(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debugf("executing %s\n", message.Type)
+	}
+	var err error
+	switch message.Type {
+	case protocols.TypeMGET:
+		var keys []string
+		if keys, err = protocols.DecodeStrings(message.Value); err != nil {
+			return err
+		}
+		var records = make([][]byte, len(keys))
+		for i, key := range keys {
+			var entry, err = c.cache.GetEntry(key)
+			if err == nil && entry.Type != cache.StringValue {
+				cache.CountWrongType(c.cache, key)
+				err = cache.ErrWrongType
+			}
+			if err != nil {
+				records[i] = protocols.EncodeList([]byte(batchError(err)), nil, nil, nil, nil)
+				continue
+			}
+			records[i] = protocols.EncodeList(
+				nil,
+				entry.Value,
+				[]byte(strconv.FormatInt(int64(entry.TTL()), 10)),
+				[]byte(strconv.FormatUint(entry.Version, 10)),
+				protocols.EncodeStrings(entry.Tags...),
+			)
+		}
+		message.Value = protocols.EncodeList(records...)
+	case protocols.TypeMSET:
+		var records [][]byte
+		if records, err = protocols.DecodeList(message.Value); err != nil {
+			return err
+		}
+		// Every record is decoded before any item is set, so a malformed message sets nothing.
+		var items = make([]batchItem, len(records))
+		for i, record := range records {
+			if items[i], err = decodeBatchItem(record); err != nil {
+				return err
+			}
+		}
+		var errs = make([]string, len(items))
+		for i, item := range items {
+			var _, err = c.cache.Set(item.key, item.value, item.ttl, item.tags...)
+			errs[i] = batchError(err)
+		}
+		message.Value = protocols.EncodeStrings(errs...)
+	case protocols.TypeMDELETE:
+		var keys []string
+		if keys, err = protocols.DecodeStrings(message.Value); err != nil {
+			return err
+		}
+		var errs = make([]string, len(keys))
+		for i, key := range keys {
+			var _, err = c.cache.Delete(key)
+			errs[i] = batchError(err)
+		}
+		message.Value = protocols.EncodeStrings(errs...)
+	}
+	if s.logger != nil {
+		s.logger.Debug("sending response")
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// Handles the hash messages.
+//
+// The arguments of the messages are encoded in the value:
+//
+//   - HSET: field/value pairs, encoded with EncodeList. Replies with the amount of added fields.
+//   - HGET: the field. Replies with the value of the field.
+//   - HDEL: the fields, encoded with EncodeStrings. Replies with the amount of deleted fields.
+//   - HGETALL: nothing. Replies with field/value pairs, encoded with EncodeList.
+//   - HLEN: nothing. Replies with the amount of fields.
+//   - HINCRBY: the field and delta, encoded with EncodeStrings. Replies with the new value.
+func (s *CacheServer) handleHash(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debugf("executing %s\n", message.Type)
+	}
+	var err error
+	switch message.Type {
+	case protocols.TypeHSET:
+		var values [][]byte
+		if values, err = protocols.DecodeList(message.Value); err != nil {
+			return err
+		}
+		if len(values) == 0 || len(values)%2 != 0 {
+			return protocols.ErrInvalidFormat
+		}
+		var fields = make(map[string][]byte, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			fields[string(values[i])] = values[i+1]
+		}
+		var added int
+		if added, err = c.cache.HSet(message.Key, fields); err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.Itoa(added))
+	case protocols.TypeHGET:
+		if message.Value, err = c.cache.HGet(message.Key, string(message.Value)); err != nil {
+			return err
+		}
+	case protocols.TypeHDEL:
+		var fields []string
+		if fields, err = protocols.DecodeStrings(message.Value); err != nil {
+			return err
+		}
+		var deleted int
+		if deleted, err = c.cache.HDel(message.Key, fields...); err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.Itoa(deleted))
+	case protocols.TypeHGETALL:
+		var fields map[string][]byte
+		if fields, err = c.cache.HGetAll(message.Key); err != nil {
+			return err
+		}
+		var names = make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var values = make([][]byte, 0, len(fields)*2)
+		for _, name := range names {
+			values = append(values, []byte(name), fields[name])
+		}
+		message.Value = protocols.EncodeList(values...)
+	case protocols.TypeHLEN:
+		var n int
+		if n, err = c.cache.HLen(message.Key); err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.Itoa(n))
+	case protocols.TypeHINCRBY:
+		var args []string
+		if args, err = protocols.DecodeStrings(message.Value); err != nil {
+			return err
+		}
+		if len(args) != 2 {
+			return protocols.ErrInvalidFormat
+		}
+		var delta, value int64
+		if delta, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return err
+		}
+		if value, err = c.cache.HIncrBy(message.Key, args[0], delta); err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.FormatInt(value, 10))
+	}
+	if s.logger != nil {
+		s.logger.Debug("sending response")
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// Handles the list messages.
+//
+// The arguments of the messages are encoded in the value:
+//
+//   - LPUSH, RPUSH: the values, encoded with EncodeList. Replies with the length of the list.
+//   - LPOP, RPOP: nothing. Replies with the popped value.
+//   - LRANGE: the start and stop index, encoded with EncodeStrings. Replies with the values, encoded with EncodeList.
+//   - LLEN: nothing. Replies with the length of the list.
+//   - BLPOP, BRPOP: nothing, the TTL of the message is the time to wait for a value. Replies with the popped value.
+//
+// A client blocked on popping is not noticed to disconnect while it waits, so a value may be popped for a client which is gone.
+// If the reply fails to be written, the value is pushed back to the end of the list it was popped from.
+// A reply which was written to a connection the client already closed is not detected, and the value is lost.
+func (s *CacheServer) handleList(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debugf("executing %s\n", message.Type)
+	}
+	var err error
+	switch message.Type {
+	case protocols.TypeLPUSH, protocols.TypeRPUSH:
+		var values [][]byte
+		if values, err = protocols.DecodeList(message.Value); err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			return protocols.ErrInvalidFormat
+		}
+		var n int
+		if message.Type == protocols.TypeLPUSH {
+			n, err = c.cache.LPush(message.Key, values...)
+		} else {
+			n, err = c.cache.RPush(message.Key, values...)
+		}
+		if err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.Itoa(n))
+	case protocols.TypeLPOP:
+		if message.Value, err = c.cache.LPop(message.Key); err != nil {
+			return err
+		}
+	case protocols.TypeRPOP:
+		if message.Value, err = c.cache.RPop(message.Key); err != nil {
+			return err
+		}
+	case protocols.TypeBLPOP:
+		if message.Value, err = c.cache.BLPop(message.Key, message.TTL); err != nil {
+			return err
+		}
+	case protocols.TypeBRPOP:
+		if message.Value, err = c.cache.BRPop(message.Key, message.TTL); err != nil {
+			return err
+		}
+	case protocols.TypeLRANGE:
+		var args []string
+		if args, err = protocols.DecodeStrings(message.Value); err != nil {
+			return err
+		}
+		if len(args) != 2 {
+			return protocols.ErrInvalidFormat
+		}
+		var start, stop int
+		if start, err = strconv.Atoi(args[0]); err != nil {
+			return err
+		}
+		if stop, err = strconv.Atoi(args[1]); err != nil {
+			return err
+		}
+		var values [][]byte
+		if values, err = c.cache.LRange(message.Key, start, stop); err != nil {
+			return err
+		}
+		message.Value = protocols.EncodeList(values...)
+	case protocols.TypeLLEN:
+		var n int
+		if n, err = c.cache.LLen(message.Key); err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.Itoa(n))
+	}
+	message.TTL = 0
+	if s.logger != nil {
+		s.logger.Debug("sending response")
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		s.pushBack(c, message)
+		return err
+	}
+	return nil
+}
+
+// Push the value popped by a blocking pop back to the end of the list it was popped from, after the reply failed.
+func (s *CacheServer) pushBack(c *connection, message *protocols.Message) {
+	var err error
+	switch message.Type {
+	case protocols.TypeBLPOP:
+		_, err = c.cache.LPush(message.Key, message.Value)
+	case protocols.TypeBRPOP:
+		_, err = c.cache.RPush(message.Key, message.Value)
+	default:
+		return
+	}
+	if err != nil && s.logger != nil {
+		s.logger.Errorf("pushing back the value popped from '%s': %s\n", message.Key, err)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// Handles the set messages.
+//
+// The arguments of the messages are encoded in the value:
+//
+//   - SADD, SREM: the members, encoded with EncodeStrings. Replies with the amount of added or removed members.
+//   - SISMEMBER: the member. Replies with whether the member is in the set.
+//   - SMEMBERS: nothing. Replies with the members, encoded with EncodeStrings.
+//   - SINTER, SUNION: the keys after the key of the message, encoded with EncodeStrings. Replies with the members, encoded with EncodeStrings.
+func (s *CacheServer) handleSets(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debugf("executing %s\n", message.Type)
+	}
+	var err error
+	switch message.Type {
+	case protocols.TypeSADD, protocols.TypeSREM:
+		var members []string
+		if members, err = protocols.DecodeStrings(message.Value); err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			return protocols.ErrInvalidFormat
+		}
+		var n int
+		if message.Type == protocols.TypeSADD {
+			n, err = c.cache.SAdd(message.Key, members...)
+		} else {
+			n, err = c.cache.SRem(message.Key, members...)
+		}
+		if err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.Itoa(n))
+	case protocols.TypeSISMEMBER:
+		var ok bool
+		if ok, err = c.cache.SIsMember(message.Key, string(message.Value)); err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.FormatBool(ok))
+	case protocols.TypeSMEMBERS:
+		var members []string
+		if members, err = c.cache.SMembers(message.Key); err != nil {
+			return err
+		}
+		message.Value = protocols.EncodeStrings(members...)
+	case protocols.TypeSINTER, protocols.TypeSUNION:
+		var keys []string
+		if keys, err = protocols.DecodeStrings(message.Value); err != nil {
+			return err
+		}
+		keys = append([]string{message.Key}, keys...)
+		var members []string
+		if message.Type == protocols.TypeSINTER {
+			members, err = c.cache.SInter(keys...)
+		} else {
+			members, err = c.cache.SUnion(keys...)
+		}
+		if err != nil {
+			return err
+		}
+		message.Value = protocols.EncodeStrings(members...)
+	}
+	if s.logger != nil {
+		s.logger.Debug("sending response")
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
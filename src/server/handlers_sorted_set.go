@@ -0,0 +1,124 @@
+package server
+
+import (
+	"strconv"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+// Handles the sorted set messages.
+//
+// Scores are formatted with strconv.FormatFloat, ranges are inclusive.
+// The arguments of the messages are encoded in the value:
+//
+//   - ZADD: member/score pairs, encoded with EncodeStrings. Replies with the amount of added members.
+//   - ZINCRBY: the member and delta, encoded with EncodeStrings. Replies with the new score.
+//   - ZRANGE: the start and stop rank, encoded with EncodeStrings. Replies with member/score pairs, encoded with EncodeStrings.
+//   - ZRANGEBYSCORE: the min and max score, encoded with EncodeStrings. Replies with member/score pairs, encoded with EncodeStrings.
+//   - ZREMRANGEBYRANK: the start and stop rank, encoded with EncodeStrings. Replies with the amount of removed members.
+//   - ZREMRANGEBYSCORE: the min and max score, encoded with EncodeStrings. Replies with the amount of removed members.
+func (s *CacheServer) handleSortedSets(c *connection, message *protocols.Message) error {
+	if s.logger != nil {
+		s.logger.Debugf("executing %s\n", message.Type)
+	}
+	var args, err = protocols.DecodeStrings(message.Value)
+	if err != nil {
+		return err
+	}
+	switch message.Type {
+	case protocols.TypeZADD:
+		if len(args) == 0 || len(args)%2 != 0 {
+			return protocols.ErrInvalidFormat
+		}
+		var members = make([]cache.ScoredMember, 0, len(args)/2)
+		for i := 0; i < len(args); i += 2 {
+			var score float64
+			if score, err = strconv.ParseFloat(args[i+1], 64); err != nil {
+				return cache.ErrNotFloat
+			}
+			members = append(members, cache.ScoredMember{Member: args[i], Score: score})
+		}
+		var added int
+		if added, err = c.cache.ZAdd(message.Key, members...); err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.Itoa(added))
+	case protocols.TypeZINCRBY:
+		if len(args) != 2 {
+			return protocols.ErrInvalidFormat
+		}
+		var delta, score float64
+		if delta, err = strconv.ParseFloat(args[1], 64); err != nil {
+			return cache.ErrNotFloat
+		}
+		if score, err = c.cache.ZIncrBy(message.Key, args[0], delta); err != nil {
+			return err
+		}
+		message.Value = []byte(strconv.FormatFloat(score, 'g', -1, 64))
+	case protocols.TypeZRANGE, protocols.TypeZREMRANGEBYRANK:
+		if len(args) != 2 {
+			return protocols.ErrInvalidFormat
+		}
+		var start, stop int
+		if start, err = strconv.Atoi(args[0]); err != nil {
+			return err
+		}
+		if stop, err = strconv.Atoi(args[1]); err != nil {
+			return err
+		}
+		if message.Type == protocols.TypeZRANGE {
+			var members []cache.ScoredMember
+			if members, err = c.cache.ZRange(message.Key, start, stop); err != nil {
+				return err
+			}
+			message.Value = encodeScoredMembers(members)
+		} else {
+			var removed int
+			if removed, err = c.cache.ZRemRangeByRank(message.Key, start, stop); err != nil {
+				return err
+			}
+			message.Value = []byte(strconv.Itoa(removed))
+		}
+	case protocols.TypeZRANGEBYSCORE, protocols.TypeZREMRANGEBYSCORE:
+		if len(args) != 2 {
+			return protocols.ErrInvalidFormat
+		}
+		var min, max float64
+		if min, err = strconv.ParseFloat(args[0], 64); err != nil {
+			return cache.ErrNotFloat
+		}
+		if max, err = strconv.ParseFloat(args[1], 64); err != nil {
+			return cache.ErrNotFloat
+		}
+		if message.Type == protocols.TypeZRANGEBYSCORE {
+			var members []cache.ScoredMember
+			if members, err = c.cache.ZRangeByScore(message.Key, min, max); err != nil {
+				return err
+			}
+			message.Value = encodeScoredMembers(members)
+		} else {
+			var removed int
+			if removed, err = c.cache.ZRemRangeByScore(message.Key, min, max); err != nil {
+				return err
+			}
+			message.Value = []byte(strconv.Itoa(removed))
+		}
+	}
+	if s.logger != nil {
+		s.logger.Debug("sending response")
+	}
+	_, err = message.WriteTo(c)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func encodeScoredMembers(members []cache.ScoredMember) []byte {
+	var values = make([]string, 0, len(members)*2)
+	for _, m := range members {
+		values = append(values, m.Member, strconv.FormatFloat(m.Score, 'g', -1, 64))
+	}
+	return protocols.EncodeStrings(values...)
+}
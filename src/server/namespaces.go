@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net"
+	"sort"
+
+	"github.com/Nigel2392/netcache/src/cache"
+)
+
+// Returned when a connection selects a namespace other than the default namespace,
+// while the server has no way to create caches for namespaces.
+var ErrNamespacesDisabled = errors.New("namespaces are not enabled")
+
+// Returned when a connection selects a new namespace, while the server already has the maximum amount of namespaces.
+var ErrTooManyNamespaces = errors.New("too many namespaces")
+
+// The header of dumps which contain all namespaces.
+//
+// Dumps without the header are dumps of a single cache, they are loaded into the default namespace.
+var namespacesHeader = []byte("NETCACHE-NAMESPACES\n")
+
+// A connection to the server, with the namespace it selected.
+type connection struct {
+	net.Conn
+	// The name of the selected namespace.
+	namespace string
+	// The cache of the selected namespace.
+	cache cache.Cache
+}
+
+// Enable namespaces on the server.
+//
+// newCache is called to create the cache of a namespace the first time it is selected,
+// the cache of the default namespace is always the Cache of the server.
+func (s *CacheServer) UseNamespaces(newCache func(namespace string) cache.Cache) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.newCache = newCache
+}
+
+// Limit the amount of namespaces besides the default namespace, a limit <= 0 allows any amount.
+//
+// Every namespace has its own cache, with its own limits and cleanup,
+// so without a limit any client can keep creating caches by selecting new namespaces.
+func (s *CacheServer) LimitNamespaces(max int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxNamespaces = max
+}
+
+// Returns the names of all namespaces, in order.
+func (s *CacheServer) Namespaces() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names = []string{cache.DefaultNamespace}
+	for name := range s.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the cache of a namespace, creating the cache if it does not exist yet.
+func (s *CacheServer) Namespace(name string) (cache.Cache, error) {
+	if err := cache.IsValidNamespace(name); err != nil {
+		return nil, err
+	}
+	if name == cache.DefaultNamespace {
+		return s.Cache, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.namespaces[name]; ok {
+		return c, nil
+	}
+	if s.newCache == nil {
+		return nil, ErrNamespacesDisabled
+	}
+	if s.maxNamespaces > 0 && len(s.namespaces) >= s.maxNamespaces {
+		return nil, ErrTooManyNamespaces
+	}
+	var c = s.newCache(name)
+	if s.namespaces == nil {
+		s.namespaces = make(map[string]cache.Cache)
+	}
+	s.namespaces[name] = c
+	if s.cleanupInterval > 0 {
+		c.Run(s.cleanupInterval)
+	}
+	return c, nil
+}
+
+// Dump the caches of all namespaces.
+//
+// Without any namespaces besides the default namespace, the dump is the dump of the server's Cache.
+func (s *CacheServer) dump() ([]byte, error) {
+	var names = s.Namespaces()
+	if len(names) == 1 {
+		return s.Cache.Dump()
+	}
+
+	var dumps = make(map[string][]byte, len(names))
+	for _, name := range names {
+		var c, err = s.Namespace(name)
+		if err != nil {
+			return nil, err
+		}
+		if dumps[name], err = c.Dump(); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(namespacesHeader)
+	if err := gob.NewEncoder(&buf).Encode(dumps); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Load the caches of the namespaces in a dump.
+func (s *CacheServer) load(data []byte) error {
+	if !bytes.HasPrefix(data, namespacesHeader) {
+		return s.Cache.Load(data)
+	}
+
+	var dumps map[string][]byte
+	var err = gob.NewDecoder(bytes.NewReader(data[len(namespacesHeader):])).Decode(&dumps)
+	if err != nil {
+		return err
+	}
+	for name, dump := range dumps {
+		var c, err = s.Namespace(name)
+		if err != nil {
+			return err
+		}
+		if err = c.Load(dump); err != nil {
+			return err
+		}
+	}
+	return nil
+}
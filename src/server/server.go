@@ -1,325 +1,471 @@
-package server
-
-import (
-	"bytes"
-	"crypto/tls"
-	"errors"
-	"fmt"
-	"net"
-	"os"
-	"os/signal"
-	"path/filepath"
-	"strconv"
-	"time"
-
-	"github.com/Nigel2392/netcache/src/cache"
-	"github.com/Nigel2392/netcache/src/logger"
-	"github.com/Nigel2392/netcache/src/protocols"
-)
-
-type CacheServer struct {
-	// The cache to use.
-	Cache cache.Cache
-	// The address to listen on.
-	address string
-	// The port to listen on.
-	port int
-	// The timeout for requests.
-	timeout time.Duration
-	// The logger to use.
-	logger logger.Logger
-}
-
-// NewCacheServer creates a new cache server.
-func New(address string, port int, timeout time.Duration, c cache.Cache) *CacheServer {
-
-	if c == nil {
-		c = cache.NewMemoryCache()
-	}
-
-	if timeout <= 0 {
-		timeout = time.Minute
-	}
-
-	var s = &CacheServer{
-		Cache:   c,
-		address: address,
-		port:    port,
-		timeout: timeout,
-	}
-
-	return s
-}
-
-func (s *CacheServer) SavePeriodically(init_file string, interval time.Duration) (stop func()) {
-	var t = time.NewTicker(interval)
-	go func() {
-		var errs int
-		var err error
-		for range t.C {
-			err = s.Save(init_file)
-			if err != nil {
-				errs++
-			}
-			if errs > 5 {
-				if s.logger != nil {
-					s.logger.Critical(errors.New("Too many errors saving cache, exiting."))
-				}
-				os.Exit(1)
-			}
-		}
-	}()
-	return t.Stop
-}
-
-// SaveOnInterrupt saves the cache when the program is interrupted.
-func (s *CacheServer) SaveOnInterrupt(init_file string) {
-	var c = make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		<-c
-		s.Save(init_file)
-		os.Exit(0)
-	}()
-}
-
-func (s *CacheServer) Save(init_file string) error {
-	if s.logger != nil {
-		s.logger.Debug("Saving cache...")
-	}
-	var b, err = s.Cache.Dump()
-	if err != nil {
-		if s.logger != nil {
-			s.logger.Critical(fmt.Errorf("Error dumping cache: %s", err))
-		}
-		return err
-	}
-	if s.logger != nil {
-		s.logger.Debug("Writing cache...")
-	}
-
-	var dir = filepath.Dir(init_file)
-	if _, err = os.Stat(dir); os.IsNotExist(err) {
-		if s.logger != nil {
-			s.logger.Debug("Creating directory...")
-		}
-		err = os.MkdirAll(dir, 0777)
-		if err != nil {
-			return err
-		}
-	}
-	var f *os.File
-	if f, err = os.OpenFile(init_file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666); err != nil {
-		return err
-	}
-	if err != nil {
-		if s.logger != nil {
-			s.logger.Critical(fmt.Errorf("Error opening init file: %s", err))
-		}
-		return err
-	}
-	defer f.Close()
-	_, err = f.Write(b)
-	if err != nil {
-		if s.logger != nil {
-			s.logger.Critical(fmt.Errorf("Error writing init file: %s", err))
-		}
-	}
-	return err
-}
-
-// Load loads the cache from the init file.
-func (s *CacheServer) Load(init_file string) error {
-	var f *os.File
-	var err error
-
-	if s.logger != nil {
-		s.logger.Debug("Reading init file...")
-	}
-
-	if f, err = os.Open(init_file); err != nil {
-		if s.logger != nil {
-			s.logger.Critical(fmt.Errorf("Error opening init file: %s", err))
-		}
-		return err
-	}
-
-	var b bytes.Buffer
-	if _, err = b.ReadFrom(f); err != nil {
-		if s.logger != nil {
-			s.logger.Critical(fmt.Errorf("Error reading init file: %s", err))
-		}
-		return err
-	}
-
-	if s.logger != nil {
-		s.logger.Debug("Loading cache...")
-	}
-
-	err = s.Cache.Load(b.Bytes())
-	if err != nil {
-		if s.logger != nil {
-			s.logger.Critical(fmt.Errorf("Error loading cache: %s", err))
-		}
-		return err
-	}
-	return nil
-}
-
-// NewLogger creates a new logger for the server.
-func (s *CacheServer) NewLogger(logger logger.Logger) {
-	s.logger = logger
-}
-
-// Function to run before the server starts to listen.
-func (s *CacheServer) preInit() {
-	if s.logger != nil {
-		s.logger.Info("Starting cache...")
-	}
-	s.Cache.Run(time.Minute / 2)
-	if s.logger != nil {
-		s.logger.Infof("Listening on %s:%d\n", s.address, s.port)
-	}
-}
-
-// ListenAndServe starts the server.
-func (s *CacheServer) ListenAndServe() error {
-	s.preInit()
-	var l, err = net.Listen("tcp", s.address+":"+strconv.Itoa(s.port))
-	if err != nil {
-		return err
-	}
-	defer l.Close()
-	if s.logger != nil {
-		s.logger.Info("Waiting for connections...")
-	}
-	return s.listen(l)
-}
-
-// ListenAndServeTLS starts the server with TLS.
-func (s *CacheServer) ListenAndServeTLS(conf *tls.Config) error {
-	s.preInit()
-	var l, err = tls.Listen("tcp", s.address+":"+strconv.Itoa(s.port), conf)
-	if err != nil {
-		return err
-	}
-	defer l.Close()
-	if s.logger != nil {
-		s.logger.Info("Waiting for TLS connections...")
-	}
-	return s.listen(l)
-}
-
-// Function to run to listen for connections.
-func (s *CacheServer) listen(l net.Listener) error {
-	for {
-		var c, err = l.Accept()
-		if err != nil {
-			if s.logger != nil {
-				s.logger.Errorf("Error accepting connection: %s (%s)\n", err, c.RemoteAddr().String())
-			}
-			return err
-		}
-
-		if s.logger != nil {
-			s.logger.Infof("Connection from %s\n", c.RemoteAddr().String())
-		}
-		go s.handle(c)
-	}
-}
-
-func (s *CacheServer) handle(c net.Conn) {
-	for {
-		var message = new(protocols.Message)
-		if s.logger != nil {
-			s.logger.Debug("Waiting for message...")
-		}
-		_, err := message.ReadFrom(c)
-		if err != nil {
-			if s.logger != nil {
-				s.logger.Warningf("Error reading message: %s, disconnecting. (%s)\n", err, c.RemoteAddr().String())
-			}
-			return
-		}
-		// Handle the message with a set timeout.
-		err = runWithTimeout(func() error {
-			switch message.Type {
-			case protocols.TypeGET:
-				if s.logger != nil {
-					s.logger.Debugf("Received GET request for key %s\n", message.Key)
-				}
-				err = s.handleGet(c, message)
-			case protocols.TypeSET:
-				if s.logger != nil {
-					s.logger.Debugf("Received SET request for key %s\n", message.Key)
-				}
-				err = s.handleSet(c, message)
-			case protocols.TypeDELETE:
-				if s.logger != nil {
-					s.logger.Debugf("Received DELETE request for key %s\n", message.Key)
-				}
-				err = s.handleDelete(c, message)
-			case protocols.TypeCLEAR:
-				if s.logger != nil {
-					s.logger.Debug("Received CLEAR request")
-				}
-				err = s.handleClear(c)
-			case protocols.TypeHAS:
-				if s.logger != nil {
-					s.logger.Debugf("Received HAS request for key %s\n", message.Key)
-				}
-				err = s.handleHas(c, message)
-			case protocols.TypePING:
-				if s.logger != nil {
-					s.logger.Debug("Received PING request")
-				}
-				err = s.handlePing(c)
-			case protocols.TypeKEYS:
-				if s.logger != nil {
-					s.logger.Debug("Received KEYS request")
-				}
-				err = s.handleKeys(c)
-			}
-			if err != nil {
-				err = writeErrorMessage(c, err)
-				if err != nil {
-					if s.logger != nil {
-						s.logger.Warningf("Error writing error message: %s, disconnecting. (%s)\n", err, c.RemoteAddr().String())
-					}
-					return err
-				}
-				return nil
-			}
-			s.logger.Debug("Writing end message...")
-			err = protocols.WriteEnd(c)
-			if err != nil {
-				if s.logger != nil {
-					s.logger.Warningf("Error writing end message: %s, disconnecting. (%s)\n", err, c.RemoteAddr().String())
-				}
-				return err
-			}
-			return nil
-		}, s.timeout)
-		if err != nil {
-			return
-		}
-	}
-}
-
-func runWithTimeout(f func() error, timeout time.Duration) error {
-	if timeout <= 0 {
-		f()
-		return nil
-	}
-	var done = make(chan error)
-	defer close(done)
-	go func() {
-		done <- f()
-	}()
-	select {
-	case <-time.After(timeout):
-		return errors.New("timeout")
-	case err := <-done:
-		return err
-	}
-}
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/logger"
+	"github.com/Nigel2392/netcache/src/protocols"
+)
+
+type CacheServer struct {
+	// The cache to use.
+	Cache cache.Cache
+	// The address to listen on.
+	address string
+	// The port to listen on.
+	port int
+	// The timeout for requests.
+	timeout time.Duration
+	// The logger to use.
+	logger logger.Logger
+
+	// Guards the namespaces.
+	mu sync.Mutex
+	// The caches of the namespaces other than the default namespace.
+	namespaces map[string]cache.Cache
+	// Creates the cache of a namespace, nil if namespaces are not enabled.
+	newCache func(namespace string) cache.Cache
+	// The maximum amount of namespaces besides the default namespace, zero for no limit.
+	maxNamespaces int
+	// The cleanup interval of the caches, zero until the server is started.
+	cleanupInterval time.Duration
+	// Encrypts the init file, nil if it is stored as it is.
+	keyring *cache.Keyring
+	// The amount of connected clients.
+	clients atomic.Int64
+}
+
+// NewCacheServer creates a new cache server.
+func New(address string, port int, timeout time.Duration, c cache.Cache) *CacheServer {
+
+	if c == nil {
+		c = cache.NewMemoryCache()
+	}
+
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+
+	var s = &CacheServer{
+		Cache:   c,
+		address: address,
+		port:    port,
+		timeout: timeout,
+	}
+
+	return s
+}
+
+// UseKeyring encrypts the init file with the current key of the keyring.
+//
+// Init files written with an old key, or before encryption was enabled, can still be loaded.
+func (s *CacheServer) UseKeyring(k *cache.Keyring) {
+	s.keyring = k
+}
+
+func (s *CacheServer) SavePeriodically(init_file string, interval time.Duration) (stop func()) {
+	var t = time.NewTicker(interval)
+	go func() {
+		var errs int
+		var err error
+		for range t.C {
+			err = s.Save(init_file)
+			if err != nil {
+				errs++
+			}
+			if errs > 5 {
+				if s.logger != nil {
+					s.logger.Critical(errors.New("Too many errors saving cache, exiting."))
+				}
+				os.Exit(1)
+			}
+		}
+	}()
+	return t.Stop
+}
+
+// SaveOnInterrupt saves the cache when the program is interrupted.
+func (s *CacheServer) SaveOnInterrupt(init_file string) {
+	var c = make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		s.Save(init_file)
+		os.Exit(0)
+	}()
+}
+
+func (s *CacheServer) Save(init_file string) error {
+	if s.logger != nil {
+		s.logger.Debug("Saving cache...")
+	}
+	var b, err = s.dump()
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Critical(fmt.Errorf("Error dumping cache: %s", err))
+		}
+		return err
+	}
+	if b, err = s.keyring.Encrypt(b, nil); err != nil {
+		if s.logger != nil {
+			s.logger.Critical(fmt.Errorf("Error encrypting cache: %s", err))
+		}
+		return err
+	}
+	if s.logger != nil {
+		s.logger.Debug("Writing cache...")
+	}
+
+	var dir = filepath.Dir(init_file)
+	if _, err = os.Stat(dir); os.IsNotExist(err) {
+		if s.logger != nil {
+			s.logger.Debug("Creating directory...")
+		}
+		err = os.MkdirAll(dir, 0777)
+		if err != nil {
+			return err
+		}
+	}
+	var f *os.File
+	if f, err = os.OpenFile(init_file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666); err != nil {
+		return err
+	}
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Critical(fmt.Errorf("Error opening init file: %s", err))
+		}
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(b)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Critical(fmt.Errorf("Error writing init file: %s", err))
+		}
+	}
+	return err
+}
+
+// Load loads the cache from the init file.
+func (s *CacheServer) Load(init_file string) error {
+	var f *os.File
+	var err error
+
+	if s.logger != nil {
+		s.logger.Debug("Reading init file...")
+	}
+
+	if f, err = os.Open(init_file); err != nil {
+		if s.logger != nil {
+			s.logger.Critical(fmt.Errorf("Error opening init file: %s", err))
+		}
+		return err
+	}
+
+	var b bytes.Buffer
+	if _, err = b.ReadFrom(f); err != nil {
+		if s.logger != nil {
+			s.logger.Critical(fmt.Errorf("Error reading init file: %s", err))
+		}
+		return err
+	}
+
+	data, err := s.keyring.Decrypt(b.Bytes(), nil)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Critical(fmt.Errorf("Error decrypting init file: %s", err))
+		}
+		return err
+	}
+
+	if s.logger != nil {
+		s.logger.Debug("Loading cache...")
+	}
+
+	err = s.load(data)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Critical(fmt.Errorf("Error loading cache: %s", err))
+		}
+		return err
+	}
+	return nil
+}
+
+// NewLogger creates a new logger for the server.
+func (s *CacheServer) NewLogger(logger logger.Logger) {
+	s.logger = logger
+}
+
+// Function to run before the server starts to listen.
+func (s *CacheServer) preInit() {
+	if s.logger != nil {
+		s.logger.Info("Starting cache...")
+	}
+	s.mu.Lock()
+	s.cleanupInterval = time.Minute / 2
+	for _, c := range s.namespaces {
+		c.Run(s.cleanupInterval)
+	}
+	s.mu.Unlock()
+	s.Cache.Run(s.cleanupInterval)
+	if s.logger != nil {
+		s.logger.Infof("Listening on %s:%d\n", s.address, s.port)
+	}
+}
+
+// ListenAndServe starts the server.
+func (s *CacheServer) ListenAndServe() error {
+	s.preInit()
+	var l, err = net.Listen("tcp", s.address+":"+strconv.Itoa(s.port))
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	if s.logger != nil {
+		s.logger.Info("Waiting for connections...")
+	}
+	return s.listen(l)
+}
+
+// ListenAndServeTLS starts the server with TLS.
+func (s *CacheServer) ListenAndServeTLS(conf *tls.Config) error {
+	s.preInit()
+	var l, err = tls.Listen("tcp", s.address+":"+strconv.Itoa(s.port), conf)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	if s.logger != nil {
+		s.logger.Info("Waiting for TLS connections...")
+	}
+	return s.listen(l)
+}
+
+// Function to run to listen for connections.
+func (s *CacheServer) listen(l net.Listener) error {
+	for {
+		var c, err = l.Accept()
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Errorf("Error accepting connection: %s (%s)\n", err, c.RemoteAddr().String())
+			}
+			return err
+		}
+
+		if s.logger != nil {
+			s.logger.Infof("Connection from %s\n", c.RemoteAddr().String())
+		}
+		go s.handle(c)
+	}
+}
+
+// Clients returns the amount of clients connected to the server.
+func (s *CacheServer) Clients() int64 {
+	return s.clients.Load()
+}
+
+func (s *CacheServer) handle(conn net.Conn) {
+	s.clients.Add(1)
+	defer s.clients.Add(-1)
+	var c = &connection{
+		Conn:      conn,
+		namespace: cache.DefaultNamespace,
+		cache:     s.Cache,
+	}
+	for {
+		var message = new(protocols.Message)
+		if s.logger != nil {
+			s.logger.Debug("Waiting for message...")
+		}
+		_, err := message.ReadFrom(c)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Warningf("Error reading message: %s, disconnecting. (%s)\n", err, c.RemoteAddr().String())
+			}
+			return
+		}
+		// Handle the message with a set timeout.
+		err = runWithTimeout(func() error {
+			switch message.Type {
+			case protocols.TypeGET:
+				if s.logger != nil {
+					s.logger.Debugf("Received GET request for key %s\n", message.Key)
+				}
+				err = s.handleGet(c, message)
+			case protocols.TypeSET:
+				if s.logger != nil {
+					s.logger.Debugf("Received SET request for key %s\n", message.Key)
+				}
+				err = s.handleSet(c, message)
+			case protocols.TypeDELETE:
+				if s.logger != nil {
+					s.logger.Debugf("Received DELETE request for key %s\n", message.Key)
+				}
+				err = s.handleDelete(c, message)
+			case protocols.TypeCLEAR:
+				if s.logger != nil {
+					s.logger.Debug("Received CLEAR request")
+				}
+				err = s.handleClear(c)
+			case protocols.TypeHSET, protocols.TypeHGET, protocols.TypeHDEL, protocols.TypeHGETALL, protocols.TypeHLEN, protocols.TypeHINCRBY:
+				if s.logger != nil {
+					s.logger.Debugf("Received %s request for key %s\n", message.Type, message.Key)
+				}
+				err = s.handleHash(c, message)
+			case protocols.TypeLPUSH, protocols.TypeRPUSH, protocols.TypeLPOP, protocols.TypeRPOP, protocols.TypeLRANGE, protocols.TypeLLEN, protocols.TypeBLPOP, protocols.TypeBRPOP:
+				if s.logger != nil {
+					s.logger.Debugf("Received %s request for key %s\n", message.Type, message.Key)
+				}
+				err = s.handleList(c, message)
+			case protocols.TypeSADD, protocols.TypeSREM, protocols.TypeSISMEMBER, protocols.TypeSMEMBERS, protocols.TypeSINTER, protocols.TypeSUNION:
+				if s.logger != nil {
+					s.logger.Debugf("Received %s request for key %s\n", message.Type, message.Key)
+				}
+				err = s.handleSets(c, message)
+			case protocols.TypeZADD, protocols.TypeZINCRBY, protocols.TypeZRANGE, protocols.TypeZRANGEBYSCORE, protocols.TypeZREMRANGEBYRANK, protocols.TypeZREMRANGEBYSCORE:
+				if s.logger != nil {
+					s.logger.Debugf("Received %s request for key %s\n", message.Type, message.Key)
+				}
+				err = s.handleSortedSets(c, message)
+			case protocols.TypeSELECT:
+				if s.logger != nil {
+					s.logger.Debugf("Received SELECT request for namespace %s\n", message.Key)
+				}
+				err = s.handleSelect(c, message)
+			case protocols.TypeINVALIDATE:
+				if s.logger != nil {
+					s.logger.Debugf("Received INVALIDATE request for tag %s\n", message.Key)
+				}
+				err = s.handleInvalidate(c, message)
+			case protocols.TypeHAS:
+				if s.logger != nil {
+					s.logger.Debugf("Received HAS request for key %s\n", message.Key)
+				}
+				err = s.handleHas(c, message)
+			case protocols.TypeMGET, protocols.TypeMSET, protocols.TypeMDELETE:
+				if s.logger != nil {
+					s.logger.Debugf("Received %s request\n", message.Type)
+				}
+				err = s.handleBatch(c, message)
+			case protocols.TypeINFO:
+				if s.logger != nil {
+					s.logger.Debug("Received INFO request")
+				}
+				err = s.handleInfo(c, message)
+			case protocols.TypePING:
+				if s.logger != nil {
+					s.logger.Debug("Received PING request")
+				}
+				err = s.handlePing(c)
+			case protocols.TypeKEYS:
+				if s.logger != nil {
+					s.logger.Debug("Received KEYS request")
+				}
+				err = s.handleKeys(c)
+			case protocols.TypeSCAN:
+				if s.logger != nil {
+					s.logger.Debugf("Received SCAN request from cursor %q\n", message.Key)
+				}
+				err = s.handleScan(c, message)
+			case protocols.TypeINCR, protocols.TypeDECR:
+				if s.logger != nil {
+					s.logger.Debugf("Received %s request for key %s\n", message.Type, message.Key)
+				}
+				err = s.handleIncr(c, message)
+			case protocols.TypeCAS:
+				if s.logger != nil {
+					s.logger.Debugf("Received CAS request for key %s at version %d\n", message.Key, message.Version)
+				}
+				err = s.handleCAS(c, message)
+			case protocols.TypeSETNX, protocols.TypeREPLACE:
+				if s.logger != nil {
+					s.logger.Debugf("Received %s request for key %s\n", message.Type, message.Key)
+				}
+				err = s.handleSetIf(c, message)
+			case protocols.TypeGETSET, protocols.TypeGETDEL:
+				if s.logger != nil {
+					s.logger.Debugf("Received %s request for key %s\n", message.Type, message.Key)
+				}
+				err = s.handleGetAnd(c, message)
+			case protocols.TypeTOUCH, protocols.TypeEXPIRE, protocols.TypePERSIST:
+				if s.logger != nil {
+					s.logger.Debugf("Received %s request for key %s\n", message.Type, message.Key)
+				}
+				err = s.handleExpire(c, message)
+			case protocols.TypeTTL:
+				if s.logger != nil {
+					s.logger.Debugf("Received TTL request for key %s\n", message.Key)
+				}
+				err = s.handleTTL(c, message)
+			}
+			if err != nil {
+				err = writeErrorMessage(c, err)
+				if err != nil {
+					if s.logger != nil {
+						s.logger.Warningf("Error writing error message: %s, disconnecting. (%s)\n", err, c.RemoteAddr().String())
+					}
+					return err
+				}
+				return nil
+			}
+			if s.logger != nil {
+				s.logger.Debug("Writing end message...")
+			}
+			err = protocols.WriteEnd(c)
+			if err != nil {
+				if s.logger != nil {
+					s.logger.Warningf("Error writing end message: %s, disconnecting. (%s)\n", err, c.RemoteAddr().String())
+				}
+				return err
+			}
+			return nil
+		}, s.requestTimeout(message))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Returns the timeout for handling the message.
+//
+// Blocking messages may wait up to their own timeout, which is added to the timeout of the server.
+func (s *CacheServer) requestTimeout(message *protocols.Message) time.Duration {
+	switch message.Type {
+	case protocols.TypeBLPOP, protocols.TypeBRPOP:
+		if message.TTL > 0 {
+			return s.timeout + message.TTL
+		}
+	}
+	return s.timeout
+}
+
+func runWithTimeout(f func() error, timeout time.Duration) error {
+	if timeout <= 0 {
+		f()
+		return nil
+	}
+	// Buffered, so f can still finish after the timeout.
+	var done = make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case <-time.After(timeout):
+		return errors.New("timeout")
+	case err := <-done:
+		return err
+	}
+}
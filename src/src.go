@@ -1 +1 @@
-package src
+package src
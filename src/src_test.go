@@ -1,213 +1,724 @@
-package src_test
-
-import (
-	"encoding/gob"
-	"encoding/json"
-	"os"
-	"testing"
-	"time"
-
-	"github.com/Nigel2392/netcache/src/cache"
-	"github.com/Nigel2392/netcache/src/client"
-	"github.com/Nigel2392/netcache/src/logger"
-	"github.com/Nigel2392/netcache/src/protocols"
-	"github.com/Nigel2392/netcache/src/server"
-)
-
-var cacheServer = server.New("localhost", 13323, time.Second*1, cache.NewFileCache("./server-cache-test")) // short timeout for testing (localhost)
-var cacheClient = client.CacheClient{ServerAddr: "localhost:13323", Serializer: &protocols.XmlSerializer{}}
-
-type testitem struct {
-	Value   string `json:"value" xml:"value"` // interface{} for testing
-	Keyable string `json:"keyable" xml:"keyable"`
-}
-
-func TestCacheServer(t *testing.T) {
-	cacheServer.NewLogger(logger.Newlogger(logger.DEBUG, os.Stdout))
-	go cacheServer.ListenAndServe()
-
-	gob.Register(testitem{})
-
-	time.Sleep(1 * time.Second)
-
-	var err = cacheClient.Connect()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	t.Log("LOG: Connected, setting items...")
-
-	var items map[string]testitem = map[string]testitem{
-		"key1": {Value: "value1", Keyable: "key1"},
-		"key2": {Value: "value2", Keyable: "key2"},
-		"key3": {Value: "value3", Keyable: "key3"},
-		"key4": {Value: "value4", Keyable: "key4"},
-		"key5": {Value: "value5", Keyable: "key5"},
-	}
-
-	for key, item := range items {
-		err = cacheClient.Set(key, item, 5*time.Second)
-		if err != nil {
-			t.Fatal(err)
-		} else {
-			t.Log("LOG: set", key, item)
-		}
-	}
-
-	for key, item := range items {
-		var value testitem
-		_, err = cacheClient.Get(key, &value)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if value.Keyable != item.Keyable || value.Value != item.Value {
-			t.Fatalf("value mismatch %s != %s or %s != %s", value.Keyable, item.Keyable, value.Value, item.Value)
-		}
-	}
-
-	for key := range items {
-		err = cacheClient.Delete(key)
-		if err != nil {
-			t.Fatal(err)
-		} else {
-			t.Log("LOG: deleted", key)
-		}
-	}
-
-	for key := range items {
-		var value testitem
-		_, err = cacheClient.Get(key, &value)
-		if err == nil {
-			t.Fatalf("item not deleted %s", key)
-		} else {
-			t.Log("LOG: after delete, should error -", err)
-		}
-	}
-
-	for key, item := range items {
-		err = cacheClient.Set(key, item, 5*time.Second)
-		if err != nil {
-			t.Fatal(err)
-		} else {
-			t.Log("LOG: set", key, item)
-		}
-	}
-
-	keys, err := cacheClient.Keys()
-	if err != nil {
-		t.Fatal(err)
-	} else {
-		for _, item := range items {
-			var found bool
-			for _, key := range keys {
-				if key == item.Keyable {
-					found = true
-					break
-				}
-			}
-			if !found {
-				t.Fatalf("key not found %s", item.Keyable)
-			}
-		}
-	}
-	t.Log("LOG: waiting for items to expire")
-	time.Sleep(6 * time.Second)
-	t.Log("LOG: done waiting")
-
-	for key := range items {
-		var value testitem
-		_, err = cacheClient.Get(key, &value)
-		if err == nil {
-			t.Fatalf("item not expired %s", key)
-		} else {
-			t.Log("LOG: after expiry, should error -", err)
-		}
-	}
-
-	err = cacheClient.Clear()
-	if err != nil {
-		t.Fatal(err)
-	} else {
-		t.Log("LOG: cleared")
-	}
-
-	cacheClient.Close()
-}
-
-func TestCacheDumpLoad(t *testing.T) {
-	var c = cache.NewMemoryCache()
-	var newServer = server.New("localhost", 13324, time.Second*1, c) // short timeout for testing (localhost)
-	newServer.NewLogger(logger.Newlogger(logger.DEBUG, os.Stdout))
-
-	gob.Register(testitem{})
-
-	t.Log("LOG: Setting items")
-	newServer.Cache.Run(1 * time.Second)
-
-	var items map[string]testitem = map[string]testitem{
-		"key1": {Value: "value1", Keyable: "key1"},
-		"key2": {Value: "value2", Keyable: "key2"},
-		"key3": {Value: "value3", Keyable: "key3"},
-		"key4": {Value: "value4", Keyable: "key4"},
-		"key5": {Value: "value5", Keyable: "key5"},
-	}
-	var err error
-	for key, item := range items {
-		var bytes, err = json.Marshal(item)
-
-		t.Log("LOG: encoded", key, item)
-
-		_, err = newServer.Cache.Set(key, bytes, 5*time.Second)
-		if err != nil {
-			t.Fatal(err)
-		} else {
-			t.Log("LOG: set", key, item)
-		}
-	}
-
-	if len(newServer.Cache.Keys()) != len(items) {
-		t.Fatalf("key count mismatch %d != %d", len(newServer.Cache.Keys()), len(items))
-	}
-
-	t.Log("LOG: Saving cache...")
-
-	err = newServer.Save("./server-cache-test/dump.netcache")
-	if err != nil {
-		t.Fatal(err)
-		return
-	} else {
-		t.Log("LOG: saved")
-	}
-
-	t.Log("Loading cache...")
-
-	newServer.Cache.Close()
-	newServer.Cache = cache.NewMemoryCache()
-	newServer.Cache.Run(1 * time.Second)
-
-	err = newServer.Load("./server-cache-test/dump.netcache")
-	if err != nil {
-		t.Fatal(err)
-	} else {
-		t.Log("LOG: loaded")
-	}
-
-	if len(newServer.Cache.Keys()) != len(items) {
-		t.Fatalf("key count mismatch %d != %d", len(newServer.Cache.Keys()), len(items))
-	}
-
-	for key, item := range items {
-		var value testitem
-		var v, _, err = newServer.Cache.Get(key)
-		if err != nil {
-			t.Fatal(err)
-		}
-		err = json.Unmarshal(v, &value)
-		if err != nil {
-			t.Fatal(err)
-		}
-		if value.Keyable != item.Keyable || value.Value != item.Value {
-			t.Fatalf("value mismatch %s != %s or %s != %s", value.Keyable, item.Keyable, value.Value, item.Value)
-		}
-	}
-}
+package src_test
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Nigel2392/netcache/src/cache"
+	"github.com/Nigel2392/netcache/src/client"
+	"github.com/Nigel2392/netcache/src/logger"
+	"github.com/Nigel2392/netcache/src/protocols"
+	"github.com/Nigel2392/netcache/src/server"
+)
+
+var cacheServer = server.New("localhost", 13323, time.Second*1, cache.NewFileCache("./server-cache-test")) // short timeout for testing (localhost)
+var cacheClient = client.CacheClient{ServerAddr: "localhost:13323", Serializer: &protocols.XmlSerializer{}}
+
+type testitem struct {
+	Value   string `json:"value" xml:"value"` // interface{} for testing
+	Keyable string `json:"keyable" xml:"keyable"`
+}
+
+func TestCacheServer(t *testing.T) {
+	cacheServer.NewLogger(logger.Newlogger(logger.DEBUG, os.Stdout))
+	go cacheServer.ListenAndServe()
+
+	gob.Register(testitem{})
+
+	time.Sleep(1 * time.Second)
+
+	var err = cacheClient.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("LOG: Connected, setting items...")
+
+	var items map[string]testitem = map[string]testitem{
+		"key1": {Value: "value1", Keyable: "key1"},
+		"key2": {Value: "value2", Keyable: "key2"},
+		"key3": {Value: "value3", Keyable: "key3"},
+		"key4": {Value: "value4", Keyable: "key4"},
+		"key5": {Value: "value5", Keyable: "key5"},
+	}
+
+	for key, item := range items {
+		err = cacheClient.Set(key, item, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		} else {
+			t.Log("LOG: set", key, item)
+		}
+	}
+
+	for key, item := range items {
+		var value testitem
+		_, err = cacheClient.Get(key, &value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.Keyable != item.Keyable || value.Value != item.Value {
+			t.Fatalf("value mismatch %s != %s or %s != %s", value.Keyable, item.Keyable, value.Value, item.Value)
+		}
+	}
+
+	for key := range items {
+		err = cacheClient.Delete(key)
+		if err != nil {
+			t.Fatal(err)
+		} else {
+			t.Log("LOG: deleted", key)
+		}
+	}
+
+	for key := range items {
+		var value testitem
+		_, err = cacheClient.Get(key, &value)
+		if err == nil {
+			t.Fatalf("item not deleted %s", key)
+		} else {
+			t.Log("LOG: after delete, should error -", err)
+		}
+	}
+
+	for key, item := range items {
+		err = cacheClient.Set(key, item, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		} else {
+			t.Log("LOG: set", key, item)
+		}
+	}
+
+	keys, err := cacheClient.Keys()
+	if err != nil {
+		t.Fatal(err)
+	} else {
+		for _, item := range items {
+			var found bool
+			for _, key := range keys {
+				if key == item.Keyable {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Fatalf("key not found %s", item.Keyable)
+			}
+		}
+	}
+	var scanned []string
+	var it = cacheClient.Iterate("key*", 2)
+	for it.Next() {
+		scanned = append(scanned, it.Key())
+	}
+	if err = it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != len(items) {
+		t.Fatalf("scanned key count mismatch %d != %d", len(scanned), len(items))
+	}
+
+	value, err := cacheClient.Incr("counter", 5, 10, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 15 {
+		t.Fatalf("counter mismatch %d != 15", value)
+	}
+	value, err = cacheClient.Decr("counter", 20, 0, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != -5 {
+		t.Fatalf("counter mismatch %d != -5", value)
+	}
+	if _, err = cacheClient.Decr("negated", math.MinInt64, 1, 5*time.Second); !errors.Is(err, cache.ErrIntegerOverflow) {
+		t.Fatalf("expected ErrIntegerOverflow, got %v", err)
+	}
+
+	item, err := cacheClient.Get("key1", &testitem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := cacheClient.CompareAndSwap("key1", items["key2"], 5*time.Second, item.Version())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cacheClient.CompareAndSwap("key1", items["key1"], 5*time.Second, item.Version()); !errors.Is(err, cache.ErrVersionMismatch) {
+		t.Fatalf("expected version mismatch, got %v", err)
+	}
+	if _, err = cacheClient.CompareAndSwap("key1", items["key1"], 5*time.Second, version); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := cacheClient.SetNX("token", "value", 5*time.Second)
+	if err != nil || !set {
+		t.Fatalf("expected token to be set, got %v %v", set, err)
+	}
+	if set, err = cacheClient.SetNX("token", "value", 5*time.Second); err != nil || set {
+		t.Fatalf("expected token not to be set again, got %v %v", set, err)
+	}
+	if set, err = cacheClient.Replace("missing", "value", 5*time.Second); err != nil || set {
+		t.Fatalf("expected missing key not to be replaced, got %v %v", set, err)
+	}
+	var old string
+	if item, err = cacheClient.GetAndDelete("token", &old); err != nil {
+		t.Fatal(err)
+	}
+	if old != "value" {
+		t.Fatalf("token mismatch %s != value", old)
+	}
+	if _, err = cacheClient.GetAndDelete("token", &old); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Fatalf("expected item not found, got %v", err)
+	}
+
+	if err = cacheClient.Set("persistent", "value", cache.NoExpiry); err != nil {
+		t.Fatal(err)
+	}
+	ttl, err := cacheClient.TTL("persistent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != cache.NoExpiry {
+		t.Fatalf("expected no expiry, got %s", ttl)
+	}
+	if err = cacheClient.Touch("key5", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err = cacheClient.Persist("key5"); err != nil {
+		t.Fatal(err)
+	}
+	if err = cacheClient.Expire("key5", time.Now().Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, err = cacheClient.TTL("key5"); err != nil || ttl <= 0 || ttl > 2*time.Second {
+		t.Fatalf("expected ttl of 2 seconds, got %s %v", ttl, err)
+	}
+	if _, err = cacheClient.TTL("missing"); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Fatalf("expected item not found, got %v", err)
+	}
+
+	if err = cacheClient.Set("fragment", "value", 5*time.Second, "entity.1"); err != nil {
+		t.Fatal(err)
+	}
+	if item, err = cacheClient.Get("fragment", &old); err != nil {
+		t.Fatal(err)
+	}
+	if tags := item.Tags(); len(tags) != 1 || tags[0] != "entity.1" {
+		t.Fatalf("tags mismatch %v", tags)
+	}
+	deleted, err := cacheClient.InvalidateTag("entity.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected 1 item deleted, got %d", deleted)
+	}
+
+	if _, err = cacheClient.HSet("profile", map[string]any{"name": "nigel"}); err != nil {
+		t.Fatal(err)
+	}
+	visits, err := cacheClient.HIncrBy("profile", "visits", 2)
+	if err != nil || visits != 2 {
+		t.Fatalf("expected 2 visits, got %d %v", visits, err)
+	}
+	var name string
+	if _, err = cacheClient.HGet("profile", "name", &name); err != nil || name != "nigel" {
+		t.Fatalf("expected nigel, got %s %v", name, err)
+	}
+	fields, err := cacheClient.HGetAll("profile")
+	if err != nil || len(fields) != 2 || string(fields["visits"]) != "2" {
+		t.Fatalf("fields mismatch %v %v", fields, err)
+	}
+	if _, err = cacheClient.Get("profile", nil); !errors.Is(err, cache.ErrWrongType) {
+		t.Fatalf("expected wrong type, got %v", err)
+	}
+	if _, err = cacheClient.HDel("profile", "name", "visits"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := cacheClient.RPush("queue", "first", "second"); err != nil || n != 2 {
+		t.Fatalf("expected a length of 2, got %d %v", n, err)
+	}
+	var job string
+	if _, err = cacheClient.LPop("queue", &job); err != nil || job != "first" {
+		t.Fatalf("expected first, got %s %v", job, err)
+	}
+	if values, err := cacheClient.LRange("queue", 0, -1); err != nil || len(values) != 1 {
+		t.Fatalf("expected 1 value, got %d %v", len(values), err)
+	}
+	if _, err = cacheClient.RPop("queue", &job); err != nil || job != "second" {
+		t.Fatalf("expected second, got %s %v", job, err)
+	}
+	if _, err = cacheClient.BLPop("queue", 100*time.Millisecond, &job); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Fatalf("expected item not found, got %v", err)
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cacheClient.RPush("queue", "third")
+	}()
+	if _, err = cacheClient.BLPop("queue", 5*time.Second, &job); err != nil || job != "third" {
+		t.Fatalf("expected third, got %s %v", job, err)
+	}
+
+	if _, err = cacheClient.SAdd("visitors.mon", "alice", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cacheClient.SAdd("visitors.tue", "bob", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := cacheClient.SIsMember("visitors.mon", "alice"); err != nil || !ok {
+		t.Fatalf("expected alice to be a member, got %v %v", ok, err)
+	}
+	if members, err := cacheClient.SInter("visitors.mon", "visitors.tue"); err != nil || len(members) != 1 || members[0] != "bob" {
+		t.Fatalf("expected bob, got %v %v", members, err)
+	}
+	if members, err := cacheClient.SUnion("visitors.mon", "visitors.tue"); err != nil || len(members) != 3 {
+		t.Fatalf("expected 3 members, got %v %v", members, err)
+	}
+	if _, err = cacheClient.SRem("visitors.mon", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if members, err := cacheClient.SMembers("visitors.mon"); err != nil || len(members) != 1 {
+		t.Fatalf("expected 1 member, got %v %v", members, err)
+	}
+
+	if _, err = cacheClient.ZAdd("leaderboard", cache.ScoredMember{Member: "alice", Score: 3}, cache.ScoredMember{Member: "bob", Score: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if score, err := cacheClient.ZIncrBy("leaderboard", "bob", 4.5); err != nil || score != 5.5 {
+		t.Fatalf("expected a score of 5.5, got %v %v", score, err)
+	}
+	if members, err := cacheClient.ZRange("leaderboard", -1, -1); err != nil || len(members) != 1 || members[0].Member != "bob" {
+		t.Fatalf("expected bob to lead, got %v %v", members, err)
+	}
+	if members, err := cacheClient.ZRangeByScore("leaderboard", math.Inf(-1), 3); err != nil || len(members) != 1 || members[0].Member != "alice" {
+		t.Fatalf("expected alice, got %v %v", members, err)
+	}
+	if removed, err := cacheClient.ZRemRangeByScore("leaderboard", 0, 4); err != nil || removed != 1 {
+		t.Fatalf("expected 1 member removed, got %d %v", removed, err)
+	}
+	if removed, err := cacheClient.ZRemRangeByRank("leaderboard", 0, -1); err != nil || removed != 1 {
+		t.Fatalf("expected 1 member removed, got %d %v", removed, err)
+	}
+
+	t.Log("LOG: waiting for items to expire")
+	time.Sleep(6 * time.Second)
+	t.Log("LOG: done waiting")
+
+	for key := range items {
+		var value testitem
+		_, err = cacheClient.Get(key, &value)
+		if err == nil {
+			t.Fatalf("item not expired %s", key)
+		} else {
+			t.Log("LOG: after expiry, should error -", err)
+		}
+	}
+
+	if _, err = cacheClient.Get("persistent", nil); err != nil {
+		t.Fatalf("persistent item expired: %v", err)
+	}
+
+	err = cacheClient.Clear()
+	if err != nil {
+		t.Fatal(err)
+	} else {
+		t.Log("LOG: cleared")
+	}
+
+	cacheClient.Close()
+}
+
+func TestCacheDumpLoad(t *testing.T) {
+	var c = cache.NewMemoryCache()
+	var newServer = server.New("localhost", 13324, time.Second*1, c) // short timeout for testing (localhost)
+	newServer.NewLogger(logger.Newlogger(logger.DEBUG, os.Stdout))
+
+	gob.Register(testitem{})
+
+	t.Log("LOG: Setting items")
+	newServer.Cache.Run(1 * time.Second)
+
+	var items map[string]testitem = map[string]testitem{
+		"key1": {Value: "value1", Keyable: "key1"},
+		"key2": {Value: "value2", Keyable: "key2"},
+		"key3": {Value: "value3", Keyable: "key3"},
+		"key4": {Value: "value4", Keyable: "key4"},
+		"key5": {Value: "value5", Keyable: "key5"},
+	}
+	var err error
+	for key, item := range items {
+		var bytes, err = json.Marshal(item)
+
+		t.Log("LOG: encoded", key, item)
+
+		_, err = newServer.Cache.Set(key, bytes, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		} else {
+			t.Log("LOG: set", key, item)
+		}
+	}
+
+	if len(newServer.Cache.Keys()) != len(items) {
+		t.Fatalf("key count mismatch %d != %d", len(newServer.Cache.Keys()), len(items))
+	}
+
+	t.Log("LOG: Saving cache...")
+
+	err = newServer.Save("./server-cache-test/dump.netcache")
+	if err != nil {
+		t.Fatal(err)
+		return
+	} else {
+		t.Log("LOG: saved")
+	}
+
+	t.Log("Loading cache...")
+
+	newServer.Cache.Close()
+	newServer.Cache = cache.NewMemoryCache()
+	newServer.Cache.Run(1 * time.Second)
+
+	err = newServer.Load("./server-cache-test/dump.netcache")
+	if err != nil {
+		t.Fatal(err)
+	} else {
+		t.Log("LOG: loaded")
+	}
+
+	if len(newServer.Cache.Keys()) != len(items) {
+		t.Fatalf("key count mismatch %d != %d", len(newServer.Cache.Keys()), len(items))
+	}
+
+	for key, item := range items {
+		var value testitem
+		var v, _, err = newServer.Cache.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.Unmarshal(v, &value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.Keyable != item.Keyable || value.Value != item.Value {
+			t.Fatalf("value mismatch %s != %s or %s != %s", value.Keyable, item.Keyable, value.Value, item.Value)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	var newServer = server.New("localhost", 13325, time.Second*1, cache.NewMemoryCache())
+	newServer.UseNamespaces(func(namespace string) cache.Cache {
+		return cache.NewMemoryCache()
+	})
+	go newServer.ListenAndServe()
+
+	time.Sleep(500 * time.Millisecond)
+
+	var staging = client.CacheClient{ServerAddr: "localhost:13325", Namespace: "staging"}
+	var testClient = client.CacheClient{ServerAddr: "localhost:13325", Namespace: "test"}
+	for _, c := range []*client.CacheClient{&staging, &testClient} {
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if err := c.Set("key1", c.Namespace, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := testClient.Set("key2", "value", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []*client.CacheClient{&staging, &testClient} {
+		var item, err = c.Get("key1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(item.Value().([]byte)) != c.Namespace {
+			t.Fatalf("value mismatch %s != %s", item.Value(), c.Namespace)
+		}
+	}
+
+	if err := staging.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := staging.Keys(); len(keys) != 1 || keys[0] != "" {
+		t.Fatalf("expected staging to be cleared, got %v", keys)
+	}
+	testingCache, err := newServer.Namespace("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testingCache.Len() != 2 {
+		t.Fatalf("expected 2 items in the test namespace, got %d", testingCache.Len())
+	}
+	if newServer.Cache.Len() != 0 {
+		t.Fatalf("expected the default namespace to be empty, got %d", newServer.Cache.Len())
+	}
+
+	var dump = filepath.Join(t.TempDir(), "dump.netcache")
+	if err = newServer.Save(dump); err != nil {
+		t.Fatal(err)
+	}
+	var loadedServer = server.New("localhost", 13326, time.Second*1, cache.NewMemoryCache())
+	loadedServer.UseNamespaces(func(namespace string) cache.Cache {
+		return cache.NewMemoryCache()
+	})
+	if err = loadedServer.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	if names := loadedServer.Namespaces(); len(names) != 3 {
+		t.Fatalf("expected 3 namespaces, got %v", names)
+	}
+	loadedCache, err := loadedServer.Namespace("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _, err := loadedCache.Get("key1"); err != nil || string(value) != "test" {
+		t.Fatalf("expected test, got %s %v", value, err)
+	}
+
+	loadedServer.LimitNamespaces(2)
+	if _, err = loadedServer.Namespace("production"); !errors.Is(err, server.ErrTooManyNamespaces) {
+		t.Fatalf("expected too many namespaces, got %v", err)
+	}
+	if _, err = loadedServer.Namespace("staging"); err != nil {
+		t.Fatalf("expected existing namespaces to be selectable, got %v", err)
+	}
+
+	var disabled = server.New("localhost", 13327, time.Second*1, nil)
+	if _, err = disabled.Namespace("test"); !errors.Is(err, server.ErrNamespacesDisabled) {
+		t.Fatalf("expected namespaces to be disabled, got %v", err)
+	}
+}
+
+func TestEncryptedDump(t *testing.T) {
+	var oldKeyring, _ = cache.KeyringFromString("000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f")
+	var newServer = server.New("localhost", 13328, time.Second*1, cache.NewMemoryCache())
+	newServer.UseKeyring(oldKeyring)
+	if _, err := newServer.Cache.Set("key1", []byte("personal data"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var dump = filepath.Join(t.TempDir(), "dump.netcache")
+	if err := newServer.Save(dump); err != nil {
+		t.Fatal(err)
+	}
+	var data, err = os.ReadFile(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cache.IsEncrypted(data) {
+		t.Fatal("expected the dump to be encrypted")
+	}
+
+	// Dumps written with an old key can be loaded after a key rotation.
+	rotated, err := cache.KeyringFromString("AAECAwQFBgcICQoLDA0ODw==\n000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loadedServer = server.New("localhost", 13329, time.Second*1, cache.NewMemoryCache())
+	loadedServer.UseKeyring(rotated)
+	if err = loadedServer.Load(dump); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, err := loadedServer.Cache.Get("key1"); err != nil || string(value) != "personal data" {
+		t.Fatalf("expected personal data, got %s %v", value, err)
+	}
+
+	var noKeys = server.New("localhost", 13330, time.Second*1, cache.NewMemoryCache())
+	if err = noKeys.Load(dump); !errors.Is(err, cache.ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+}
+
+func TestServerStats(t *testing.T) {
+	var compressed, err = cache.NewCompressedCache(cache.NewMemoryCache(), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var newServer = server.New("localhost", 13331, time.Second*1, compressed)
+	go newServer.ListenAndServe()
+
+	time.Sleep(500 * time.Millisecond)
+
+	var c = client.CacheClient{ServerAddr: "localhost:13331"}
+	if err = c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var large = make([]byte, 1024)
+	if err = c.Set("key1", large, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Set("key2", "value", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Get("key1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Get("missing", nil); err == nil {
+		t.Fatal("expected missing key to be missing")
+	}
+	if err = c.Delete("key2"); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Sets != 2 || stats.Deletes != 1 || stats.Items != 1 {
+		t.Fatalf("unexpected statistics %+v", stats)
+	}
+	if stats.Clients < 1 {
+		t.Fatalf("expected a connected client, got %d", stats.Clients)
+	}
+	if stats.Compression.Values != 1 || stats.Compression.Ratio() <= 1 {
+		t.Fatalf("expected the value to be compressed, got %+v", stats.Compression)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var newServer = server.New("localhost", 13332, time.Second*1, cache.NewMemoryCache())
+	go newServer.ListenAndServe()
+
+	time.Sleep(500 * time.Millisecond)
+
+	var c = client.CacheClient{ServerAddr: "localhost:13332"}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	results, err := c.SetMany(
+		client.KeyValue{Key: "key1", Value: "value1", TTL: time.Minute, Tags: []string{"tag1"}},
+		client.KeyValue{Key: "key2", Value: "value2"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("error setting %s: %s", result.Key, result.Err)
+		}
+	}
+
+	if _, err = c.HSet("hash", map[string]any{"field": "value"}); err != nil {
+		t.Fatal(err)
+	}
+	results, err = c.GetMany("key1", "missing", "key2", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+	if results[0].Err != nil || string(results[0].Item.Value().([]byte)) != "value1" {
+		t.Fatalf("unexpected result for key1: %+v", results[0])
+	}
+	if results[0].Item.TTL() <= 0 || results[0].Item.Version() == 0 || len(results[0].Item.Tags()) != 1 {
+		t.Fatalf("expected the metadata of key1, got %+v", results[0].Item)
+	}
+	if !errors.Is(results[1].Err, cache.ErrItemNotFound) || results[1].Item != nil {
+		t.Fatalf("expected missing key to be missing, got %+v", results[1])
+	}
+	if results[2].Err != nil || string(results[2].Item.Value().([]byte)) != "value2" || results[2].Item.Tags() != nil {
+		t.Fatalf("unexpected result for key2: %+v", results[2])
+	}
+	if !errors.Is(results[3].Err, cache.ErrWrongType) {
+		t.Fatalf("expected hash to be the wrong type, got %+v", results[3])
+	}
+
+	results, err = c.DeleteMany("key1", "missing", "key2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || !errors.Is(results[1].Err, cache.ErrItemNotFound) || results[2].Err != nil {
+		t.Fatalf("unexpected delete results %+v", results)
+	}
+	if _, err = c.Get("key1", nil); !errors.Is(err, cache.ErrItemNotFound) {
+		t.Fatalf("expected key1 to be deleted, got %v", err)
+	}
+
+	if _, err = c.GetMany(); err == nil {
+		t.Fatal("expected an error for a request without keys")
+	}
+}
+
+func TestInvalidTags(t *testing.T) {
+	var newServer = server.New("localhost", 13333, time.Second*1, cache.NewMemoryCache())
+	go newServer.ListenAndServe()
+
+	time.Sleep(500 * time.Millisecond)
+
+	// The client checks tags before sending them, so the messages are written to the connection directly.
+	var conn, err = net.Dial("tcp", "localhost:13333")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var send = func(message *protocols.Message) *protocols.Message {
+		t.Helper()
+		if _, err := message.WriteTo(conn); err != nil {
+			t.Fatal(err)
+		}
+		var reply = &protocols.Message{}
+		if _, err := reply.ReadFrom(conn); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	var reply = send(&protocols.Message{Type: protocols.TypeSET, Key: "tagged", Value: []byte("value"), Tags: []string{""}})
+	if reply.Type != protocols.TypeERROR {
+		t.Fatalf("expected an error for an empty tag, got %s", reply.Type)
+	}
+	var record = protocols.EncodeList([]byte("tagged"), []byte("value"), []byte("0"), protocols.EncodeStrings("invalid tag!"))
+	reply = send(&protocols.Message{Type: protocols.TypeMSET, Value: protocols.EncodeList(record)})
+	if reply.Type != protocols.TypeERROR {
+		t.Fatalf("expected an error for an invalid tag, got %s", reply.Type)
+	}
+	if _, has := newServer.Cache.Has("tagged"); has {
+		t.Fatal("expected the item with invalid tags not to be set")
+	}
+}
+
+func TestBlockingPopDisconnected(t *testing.T) {
+	var newServer = server.New("localhost", 13334, time.Second*1, cache.NewMemoryCache())
+	go newServer.ListenAndServe()
+
+	time.Sleep(500 * time.Millisecond)
+
+	var conn, err = net.Dial("tcp", "localhost:13334")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = (&protocols.Message{Type: protocols.TypeBLPOP, Key: "queue", TTL: 5 * time.Second}).WriteTo(conn); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	// The connection is reset on close, so the reply to the blocked pop fails to be written.
+	conn.(*net.TCPConn).SetLinger(0)
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err = newServer.Cache.RPush("queue", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if values, err := newServer.Cache.LRange("queue", 0, -1); err != nil || len(values) != 1 || string(values[0]) != "value" {
+		t.Fatalf("expected the value to be pushed back, got %q %v", values, err)
+	}
+}